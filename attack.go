@@ -1,5 +1,7 @@
 package main
 
+import "math/bits"
+
 /*
 These constants remove bits from a bitboard on the A and H file respectively.
 For example, if we have a bitboard representing attacks of a queen that looks
@@ -28,152 +30,111 @@ A bitwise AND with notA will remove any attacks on the A file:
 var notA uint64 = 0xfefefefefefefefe
 var notH uint64 = 0x7f7f7f7f7f7f7f7f
 
-/*
-The following declaration is an attack map, which represents the ability of
-pieces to attack each other around the board. This is used for quick lookups -
-we can skip generating attacks for a Queen, for exampe, if we know already that
-its position couldn't possibly attack the King.
-
-This attack map, and the associated method, was created by Jonatan Pettersson.
-See his guide here:
-https://mediocrechess.blogspot.com.au/2006/12/guide-attacked-squares.html
-*/
-var attackNone = 0
-var attackKQR = 1
-var attackQR = 2
-var attackKQBwP = 3
-var attackKQBbP = 4
-var attackQB = 5
-var attackN = 6
-
-var attackArray = []int{
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0,
-	0, 0, 0, 5, 0, 0, 5, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 5, 0,
-	0, 0, 0, 5, 0, 0, 0, 0, 2, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0,
-	5, 0, 0, 0, 2, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0,
-	2, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 6, 2, 6, 5, 0,
-	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 6, 4, 1, 4, 6, 0, 0, 0, 0, 0,
-	0, 2, 2, 2, 2, 2, 2, 1, 0, 1, 2, 2, 2, 2, 2, 2, 0, 0, 0, 0,
-	0, 0, 6, 3, 1, 3, 6, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 6,
-	2, 6, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 2, 0, 0, 5,
-	0, 0, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 2, 0, 0, 0, 5, 0, 0, 0,
-	0, 0, 0, 5, 0, 0, 0, 0, 2, 0, 0, 0, 0, 5, 0, 0, 0, 0, 5, 0,
-	0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 5, 0, 0, 5, 0, 0, 0, 0, 0, 0,
-	2, 0, 0, 0, 0, 0, 0, 5, 0, 0, 0, 0, 0, 0, 0, 0, 0}
-
 /*
 isAttacked determines if a piece is under attack. It takes the current game
 position, the index of the piece in question (in 0x88 form), and the color of
 the attacking side.
 */
 func isAttacked(position position, toMove byte, targetIndex int) bool {
-	/*
-		Declare bitboards for representing the pieces present. While the normal board position is in 0x88 form, these bitboards don't require the extra squares and simple represent an 8x8 grid, meaning that they can fit in a 64-bit integer.
-
-		attackMap represents the squares currently under attack. empty represents squares with no pieces. The other bitboards hold the positions of sliding pieces.
-	*/
-	var attackMap uint64
-	var empty uint64
-	var queens uint64
-	var rooks uint64
-	var bishops uint64
-
-	// Loop through every index on the board, skipping over indices that fall
-	// outside the visible playing area.
-	for i := 0; i < BoardSize; i++ {
-		if isOnBoard(i) {
-			// Extract the piece in the current index.
-			piece := position.board[i]
-
-			// If there is a piece present, but it isn't on the attacking side,
-			// we can skip the iteration.
-			if piece.exists() && piece.color() != toMove {
-				continue
+	occupied := position.occupied[0] | position.occupied[1]
+
+	return attackersOf(&position, int(map0x88ToStandard(targetIndex)), occupied, toMove) != 0
+}
+
+/*
+Find the pieces of the attacking colour which attack a standard square, given
+the occupied squares. The occupied squares may differ from the position's, to
+see the attacks once pieces have moved.
+
+Rather than generating the attacks of every attacking piece, it works backwards
+from the target: a piece of each type on the target would attack the same
+squares that a piece of that type can attack the target from, so the target is
+attacked if one of the attacking side's pieces stands on one of them. Pawns are
+the exception, since they attack forwards, so the target is looked up as a pawn
+of the other colour.
+*/
+func attackersOf(position *position, square int, occupied uint64, attackingColor byte) uint64 {
+	attackers := &position.pieces[sideIndex(attackingColor)]
+
+	return pawnAttackTable[sideIndex(opposingColor(attackingColor))][square]&attackers[Pawn] |
+		knightAttackTable[square]&attackers[Knight] |
+		kingAttackTable[square]&attackers[King] |
+		bishopAttacksFrom(square, occupied)&(attackers[Bishop]|attackers[Queen]) |
+		rookAttacksFrom(square, occupied)&(attackers[Rook]|attackers[Queen])
+}
+
+/*
+An attackMap holds every attack of one side's pieces. attacked is the set of
+squares the side attacks, and counts holds the number of its pieces attacking
+each square. The attacks are also broken down by the identity of the pieces
+making them, in byPiece, and by the square of the piece making them, in
+bySquare, which is empty for squares without one of the side's pieces.
+
+Sliders attack the first piece in each direction, whatever its colour, so a
+piece defending another attacks its square.
+*/
+type attackMap struct {
+	attacked uint64
+	byPiece  [8]uint64
+	bySquare [64]uint64
+	counts   [64]int8
+}
+
+// Find the attack map of a colour, given the bitboards of each side's pieces,
+// indexed by side and piece identity, and the occupied squares.
+func generateAttackMap(pieces *[2][8]uint64, occupied uint64, color byte) attackMap {
+	var attacks attackMap
+
+	side := sideIndex(color)
+
+	for _, identity := range [...]piece{Pawn, Knight, Bishop, Rook, Queen, King} {
+		for remaining := pieces[side][identity]; remaining != 0; remaining &= remaining - 1 {
+			square := bits.TrailingZeros64(remaining)
+
+			var attacked uint64
+			if identity == Pawn {
+				attacked = pawnAttackTable[side][square]
+			} else {
+				attacked = attacksFrom(identity, square, occupied)
 			}
 
-			// Look up the pieces that can attack the target from this index,
-			// using the attack array declared above. The lookup returns a
-			// constant representing the set of possible pieces.
-			canAttack := attackArray[targetIndex-i+128]
-
-			// Convert the index in 0x88 form to the standard 8x8 form.
-			index := map0x88ToStandard(i)
-
-			/*
-				Moves are generated differently depending on the type of piece.
-
-				Non-sliding pieces can simply be checked against the canAttack
-				constant generated previously. If they are found to be
-				attacking, we can return early and save computations.
-
-				Sliding pieces are first checked against this constant, which
-				saves costly move generation if it's impossible for them to ever
-				attack the target square. If they could attack it, they are
-				added to the relevant bitboard for later generation.
-			*/
-			switch piece.identity() {
-			case Queen:
-				if canAttack == attackNone || canAttack == attackN {
-					continue
-				} else {
-					queens |= 1 << index
-				}
-			case Bishop:
-				if !(canAttack == attackKQBbP || canAttack == attackKQBwP || canAttack == attackQB) {
-					continue
-				} else {
-					bishops |= 1 << index
-				}
-			case Rook:
-				if !(canAttack == attackKQR || canAttack == attackQR) {
-					continue
-				} else {
-					rooks |= 1 << index
-				}
-			case Knight:
-				if canAttack == attackN {
-					return true
-				}
-			case Pawn:
-				if (toMove == White && canAttack == attackKQBwP) || (toMove == Black && canAttack == attackKQBbP) {
-					return true
-				}
-			case King:
-				if canAttack == attackKQR || canAttack == attackKQBbP || canAttack == attackKQBwP {
-					return true
-				}
-			default:
-				empty |= 1 << index
+			attacks.bySquare[square] = attacked
+			attacks.byPiece[identity] |= attacked
+			attacks.attacked |= attacked
+
+			for ; attacked != 0; attacked &= attacked - 1 {
+				attacks.counts[bits.TrailingZeros64(attacked)]++
 			}
 		}
 	}
 
-	/*
-		Now that the bitboards have been filled by sliding pieces, we can generate
-		the attack map. To do this, we use the Dumb7Fill algorithm, implemented
-		based on the site https://chessprogramming.wikispaces.com/Dumb7Fill.
+	return attacks
+}
 
-		For each direction a sliding piece could move, these moves are generated,
-		following a three step process:
+// Find the attack maps of both sides, indexed by side.
+func generateAttackMaps(pieces *[2][8]uint64, occupied uint64) [2]attackMap {
+	return [2]attackMap{generateAttackMap(pieces, occupied, White), generateAttackMap(pieces, occupied, Black)}
+}
 
-		    1. The pieces that can make that move have their bitboards combined with bitwise OR. For example, only queens and rooks can attack directly east, so we only combine their bitboards.
+// Find the least valuable of the side's pieces which attacks a square, given
+// the bitboards of the side's pieces, returning its square and identity. The
+// square is -1 if none do.
+func (attacks *attackMap) leastValuableAttacker(pieces *[8]uint64, square int) (int, piece) {
+	target := uint64(1) << square
 
-		    2. The bitboard is shifted according to the algorithm, which moves the pieces in the relevant direction until they hit a non-empty square (which blocks the attack.)
+	for _, identity := range [...]piece{Pawn, Knight, Bishop, Rook, Queen, King} {
+		if attacks.byPiece[identity]&target == 0 {
+			continue
+		}
 
-		    3. These moves are combined with the overall attack map using bitwise OR.
-	*/
-	attackMap |= southAttacks(queens|rooks, empty)
-	attackMap |= northAttacks(queens|rooks, empty)
-	attackMap |= eastAttacks(queens|rooks, empty)
-	attackMap |= westAttacks(queens|rooks, empty)
-	attackMap |= northEastAttacks(queens|bishops, empty)
-	attackMap |= northWestAttacks(queens|bishops, empty)
-	attackMap |= southEastAttacks(queens|bishops, empty)
-	attackMap |= southWestAttacks(queens|bishops, empty)
+		for remaining := pieces[identity]; remaining != 0; remaining &= remaining - 1 {
+			if from := bits.TrailingZeros64(remaining); attacks.bySquare[from]&target != 0 {
+				return from, identity
+			}
+		}
+	}
 
-	// Finally, we check whether the target index is attacked in the attack map
-	// and return true if possible.
-	return attackMap&(1<<map0x88ToStandard(targetIndex)) != 0
+	return -1, 0
 }
 
 func map0x88ToStandard(index int) uint {
@@ -182,6 +143,54 @@ func map0x88ToStandard(index int) uint {
 	return uint(rank*8 + file)
 }
 
+// Convert a standard 8x8 square to a 0x88 index.
+func standardTo0x88(square int) int {
+	return (square/8)*16 + square%8
+}
+
+// Given a bitboard of pawns of the given colour, return the bitboard of squares
+// they attack.
+func pawnAttacks(pawns uint64, color byte) uint64 {
+	if color == White {
+		return ((pawns << 9) & notA) | ((pawns << 7) & notH)
+	}
+
+	return ((pawns >> 7) & notA) | ((pawns >> 9) & notH)
+}
+
+// Given a bitboard of knights, return the bitboard of squares they attack.
+func knightAttacks(knights uint64) uint64 {
+	notAB := notA & (notA << 1)
+	notGH := notH & (notH >> 1)
+
+	attacks := ((knights << 17) & notA) | ((knights << 15) & notH)
+	attacks |= ((knights << 10) & notAB) | ((knights << 6) & notGH)
+	attacks |= ((knights >> 15) & notA) | ((knights >> 17) & notH)
+	attacks |= ((knights >> 6) & notAB) | ((knights >> 10) & notGH)
+
+	return attacks
+}
+
+// Given a bitboard of kings, return the bitboard of squares they attack.
+func kingAttacks(kings uint64) uint64 {
+	attacks := ((kings << 1) & notA) | ((kings >> 1) & notH)
+	row := kings | attacks
+
+	return attacks | (row << 8) | (row >> 8)
+}
+
+// Given a bitboard of pieces sliding along ranks and files, and a bitboard of
+// empty squares, return the bitboard of squares they attack.
+func rookAttacks(rooks uint64, empty uint64) uint64 {
+	return northAttacks(rooks, empty) | southAttacks(rooks, empty) | eastAttacks(rooks, empty) | westAttacks(rooks, empty)
+}
+
+// Given a bitboard of pieces sliding along diagonals, and a bitboard of empty
+// squares, return the bitboard of squares they attack.
+func bishopAttacks(bishops uint64, empty uint64) uint64 {
+	return northEastAttacks(bishops, empty) | northWestAttacks(bishops, empty) | southEastAttacks(bishops, empty) | southWestAttacks(bishops, empty)
+}
+
 func southAttacks(start uint64, empty uint64) uint64 {
 	var flood uint64
 
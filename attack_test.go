@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math/bits"
+	"testing"
+)
+
+/*
+moveOffsets maps each piece to the directions it can move on the 0x88 board.
+For example, the king can move left, with an index offset of -1, or directly
+upwards, with a move offset of 16.
+*/
+var moveOffsets = map[piece][]int{
+	King:   {15, 16, 17, -1, 1, -15, -16, -17},
+	Queen:  {15, 16, 17, -1, 1, -15, -16, -17},
+	Bishop: {15, 17, -15, -17},
+	Rook:   {16, -16, 1, -1},
+	Knight: {14, 31, 33, 18, -14, -31, -33, -18},
+}
+
+// Check the bitboard attack generators against the 0x88 move offsets, for a
+// single piece on every square of an otherwise empty board.
+func TestPieceAttacks(t *testing.T) {
+	generators := map[piece]func(uint64) uint64{
+		King:   kingAttacks,
+		Knight: knightAttacks,
+		Rook: func(r uint64) uint64 {
+			return rookAttacks(r, ^r)
+		},
+		Bishop: func(b uint64) uint64 {
+			return bishopAttacks(b, ^b)
+		},
+	}
+
+	for identity, generator := range generators {
+		for i := 0; i < BoardSize; i++ {
+			if !isOnBoard(i) {
+				continue
+			}
+
+			var expected uint64
+			for _, offset := range moveOffsets[identity] {
+				for target := i + offset; isOnBoard(target); target += offset {
+					expected |= 1 << map0x88ToStandard(target)
+
+					if identity == King || identity == Knight {
+						break
+					}
+				}
+			}
+
+			actual := generator(1 << map0x88ToStandard(i))
+
+			if actual != expected {
+				t.Errorf("Attack test failed! (%v on %v)\nExpected: %x\nActual: %x\n", pieceToString(identity), indexToSquare(byte(i)), expected, actual)
+			}
+		}
+	}
+}
+
+func TestAttackMapCounts(t *testing.T) {
+	cases := []struct {
+		name     string
+		fen      string
+		square   string
+		color    byte
+		expected int
+	}{
+		{"Knight and pawns", startPosition, "f3", White, 3},
+		{"Pawns behind a blocked bishop", startPosition, "d3", White, 2},
+		{"Undefended square", startPosition, "e4", White, 0},
+		{"Rooks doubled on a file", "4k3/8/8/8/8/8/3R4/3RK3 w - - 0 1", "d8", White, 1},
+		{"Rook defending a rook", "4k3/8/8/8/8/8/3R4/3RK3 w - - 0 1", "d2", White, 2},
+		{"Black pawns", "4k3/8/8/3p1p2/8/8/8/4K3 w - - 0 1", "e4", Black, 2},
+	}
+
+	for _, test := range cases {
+		position := mustFromFEN(test.fen)
+		attacks := generateAttackMap(&position.pieces, position.occupied[0]|position.occupied[1], test.color)
+
+		index, _ := squareToIndex(test.square)
+		square := map0x88ToStandard(index)
+
+		if actual := int(attacks.counts[square]); actual != test.expected {
+			t.Errorf("Attack map count test failed! (%v)\nFEN: %v\nSquare: %v\nExpected: %v\nActual: %v\n", test.name, test.fen, test.square, test.expected, actual)
+		}
+	}
+}
+
+// Check that the attack maps agree with the attackers of every square, found
+// separately.
+func TestAttackMapsMatchAttackers(t *testing.T) {
+	fens := []string{
+		startPosition,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+	}
+
+	for _, fen := range fens {
+		position := mustFromFEN(fen)
+		occupied := position.occupied[0] | position.occupied[1]
+		attacks := generateAttackMaps(&position.pieces, occupied)
+
+		for side, color := range [2]byte{White, Black} {
+			for square := 0; square < 64; square++ {
+				attackers := attackersOf(&position, square, occupied, color)
+				target := uint64(1) << uint(square)
+
+				if int(attacks[side].counts[square]) != bits.OnesCount64(attackers) || (attacks[side].attacked&target != 0) != (attackers != 0) {
+					t.Errorf("Attack map test failed!\nFEN: %v\nSide: %v\nSquare: %v\nExpected attackers: %x\nActual count: %v\n", fen, side, square, attackers, attacks[side].counts[square])
+				}
+
+				var byPiece uint64
+				for _, bitboard := range attacks[side].byPiece {
+					byPiece |= bitboard & target
+				}
+
+				if byPiece != attacks[side].attacked&target {
+					t.Errorf("Attack map breakdown test failed!\nFEN: %v\nSide: %v\nSquare: %v\n", fen, side, square)
+				}
+
+				for from := attackers; from != 0; from &= from - 1 {
+					if attacks[side].bySquare[bits.TrailingZeros64(from)]&target == 0 {
+						t.Errorf("Attack map square test failed!\nFEN: %v\nSide: %v\nSquare: %v\nAttacker: %v\n", fen, side, square, bits.TrailingZeros64(from))
+					}
+				}
+			}
+		}
+	}
+}
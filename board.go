@@ -19,7 +19,15 @@ to the right of the main board, like so:
 The bottom left hand corner is index 0, while the top right hand corner is 127.
 
 0x88 form has the advantage of allowing very fast checks to see if a position is
-on the board, which is used in move generation.
+on the board.
+
+pieces holds a bitboard of each side's pieces of each type, indexed by side and
+piece identity, and occupied the squares of all of each side's pieces. Bitboards
+use the standard 8x8 form, with a1 as bit 0 and h8 as bit 63. They are kept in
+step with board, which answers what is on a square, while the bitboards answer
+where the pieces are, and are used for attacks and move generation. kings holds
+the standard square of each side's king, or -1 if it has none, so that it can be
+found without searching the board.
 
 castling is a byte that represents castling rights for both players. Only the
 lower 4 bits are used, with 1 indicating castling is allowed.
@@ -37,6 +45,11 @@ Black king+-+ |
               |
 Black queen+--+
 
+castlingKings holds the index each king castles from, and castlingRooks the
+index of the rook of each castling right, in the same order as the bits of
+castling. In standard chess these are the e file and the corners, but in
+Chess960 the king and rooks can start on any file.
+
 toMove is the colour of the player who is next to move.
 
 enPassantTarget is the index of a square where there is an en passant
@@ -44,22 +57,44 @@ opportunity. If a pawn was double pushed in the previous turn, its jumped
 position will appear as the en passant target.
 
 halfmove and fullmove represent the time elapsed in the game.
+
+pawnKey is a Zobrist hash of the pawns on the board, and nothing else. It is
+used to look up cached pawn structure evaluations.
+
+material and pieceSquare hold the material and piece-square scores of each
+side's pieces, and phase the game phase, before it is capped at totalPhase.
+They are kept up to date as pieces move, so that the evaluation doesn't need to
+find them.
+
+accumulator holds the hidden layer of the neural network evaluation for each
+side, which is only kept up to date while a network is loaded.
 */
 type position struct {
 	board           [128]piece
+	pieces          [2][8]uint64
+	occupied        [2]uint64
+	kings           [2]int
 	castling        byte
+	castlingKings   [2]byte
+	castlingRooks   [4]byte
 	toMove          byte
 	enPassantTarget byte
 	halfmove        byte
 	fullmove        int
+	pawnKey         uint64
+	material        [2]score
+	pieceSquare     [2]score
+	phase           int
+	accumulator     accumulator
 }
 
 // Constant used to determine whether an index is off the board.
 const offBoard = 0x88
 
-// Set castling rights in the castle byte.
-func setCastle(castling byte, side int, color byte, canCastle bool) byte {
-	var offset uint8
+// Find the bit of a castling right in the castle byte, which is also the index
+// of its rook in castlingRooks.
+func castleOffset(side int, color byte) int {
+	offset := 0
 
 	if side == QueenCastle {
 		offset++
@@ -69,6 +104,13 @@ func setCastle(castling byte, side int, color byte, canCastle bool) byte {
 		offset += 2
 	}
 
+	return offset
+}
+
+// Set castling rights in the castle byte.
+func setCastle(castling byte, side int, color byte, canCastle bool) byte {
+	offset := castleOffset(side, color)
+
 	if canCastle {
 		castling |= 1 << offset
 	} else {
@@ -80,17 +122,18 @@ func setCastle(castling byte, side int, color byte, canCastle bool) byte {
 
 // Get castling rights from the castle byte.
 func getCastle(castling byte, side int, color byte) bool {
-	var offset uint8
-
-	if side == QueenCastle {
-		offset++
-	}
+	return (castling&(1<<castleOffset(side, color)) != 0)
+}
 
-	if color == Black {
-		offset += 2
-	}
+// Convert a colour to an index (0 for white, 1 for black), for use with arrays
+// that store information for each side.
+func sideIndex(color byte) int {
+	return int(color >> 6)
+}
 
-	return (castling&(1<<offset) != 0)
+// Find the colour of the opposing player.
+func opposingColor(color byte) byte {
+	return color ^ Black
 }
 
 // Returns true if the index is on the physical board, false otherwise, using
@@ -129,13 +172,3 @@ func isOnFinalRank(index int, color byte) bool {
 func isOnStartingRow(index int, color byte) bool {
 	return isOnRelativeRank(index, color, 1)
 }
-
-// Given the index of an attacking pawn, and a direction of movement (1 for
-// white, -1 for black), returns whether the pawn can attack the current en
-// passant target, if it exists.
-func isEnPassantTarget(position position, index int, direction int) bool {
-	leftTarget := 15 * direction
-	rightTarget := 17 * direction
-
-	return position.enPassantTarget != NoEnPassant && (position.enPassantTarget == byte(index+leftTarget) || position.enPassantTarget == byte(index+rightTarget))
-}
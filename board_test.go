@@ -12,10 +12,28 @@ func TestFEN(t *testing.T) {
 
 		"rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b Kkq - 1 2",
 		"rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b - - 1 2",
+
+		// Chess960, where a file is only given for an inner rook
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9",
+		"1r2k3/8/8/8/8/8/8/RR2K2R w KBq - 0 1",
+		"r1krr3/8/8/8/8/8/8/1K3RRR w Gd - 0 1",
+	}
+
+	// Shredder-FEN castling rights are converted.
+	shredder := map[string]string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1":          "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9": "bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w KQkq - 2 9",
+		"1r2k3/8/8/8/8/8/8/RR2K2R w HBb - 0 1":                              "1r2k3/8/8/8/8/8/8/RR2K2R w KBq - 0 1",
+	}
+
+	for fen, expected := range shredder {
+		if convertedFen := toFEN(mustFromFEN(fen)); convertedFen != expected {
+			t.Errorf("Shredder-FEN conversion failed!\nInput: %v\nExpected: %v\nOutput: %v\n", fen, expected, convertedFen)
+		}
 	}
 
 	for _, fen := range cases {
-		convertedPosition := fromFEN(fen)
+		convertedPosition := mustFromFEN(fen)
 		convertedFen := toFEN(convertedPosition)
 
 		if convertedFen != fen {
@@ -23,3 +41,60 @@ func TestFEN(t *testing.T) {
 		}
 	}
 }
+
+func TestFENErrors(t *testing.T) {
+	var tests = []struct {
+		fen      string
+		expected string
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP w KQkq - 0 1", "expected 8 ranks, got 7"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR", "expected 4 to 6 fields, got 1"},
+		{"rnbqkbnr/pppppppp/9/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "unknown piece '9' in rank 6"},
+		{"rnbqkbnr/ppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rank 7 has 7 squares"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNRR w KQkq - 0 1", "rank 1 has 9 squares"},
+		{"rnbqkbnr/pppppppp/44/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rank 6 has two numbers in a row"},
+		{"rnbqkbnr/ppppxppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "unknown piece 'x' in rank 7"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR x KQkq - 0 1", "invalid side to move \"x\""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQxq - 0 1", "invalid castling rights \"KQxq\""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KKkq - 0 1", "castling right K is repeated"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq e9 0 1", "invalid en passant target \"e9\""},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - -1 1", "halfmove clock \"-1\" is not a number from 0 to 255"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 0", "fullmove number \"0\" is not a number from 1 to 10000"},
+		{"rnbq1bnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQ - 0 1", "black has 0 kings"},
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBKKBNR w kq - 0 1", "white has 2 kings"},
+		{"rnbqkbnP/pppppppp/8/8/8/8/PPPPPPP1/RNBQKBNR w KQq - 0 1", "pawn on h8"},
+		{"4k3/8/8/8/8/8/8/4K2r b - - 0 1", "the side not to move is in check"},
+		{"4k3/8/8/8/8/8/8/4K3 w K - 0 1", "impossible castling rights K"},
+		{"r3k3/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "impossible castling rights KQkq"},
+		{"4k3/8/8/8/8/8/8/4K2R w E - 0 1", "invalid castling rights \"E\""},
+		{"4k3/8/8/8/8/8/8/R3K2R w HK - 0 1", "castling right K is repeated"},
+		{"4k3/8/8/8/8/8/8/R3K3 w C - 0 1", "impossible castling rights C"},
+		{"4k3/8/8/8/8/8/8/4K2R w h - 0 1", "impossible castling rights k"},
+		{"4k3/8/8/8/4P3/8/8/4K3 w - e3 0 1", "impossible en passant target e3"},
+		{"4k3/8/8/8/4P3/8/8/4K3 b - d3 0 1", "impossible en passant target d3"},
+	}
+
+	for _, test := range tests {
+		if _, err := fromFEN(test.fen); err == nil || err.Error() != test.expected {
+			t.Errorf("FEN error test failed!\nFEN: %v\nExpected: %v\nGot: %v\n", test.fen, test.expected, err)
+		}
+	}
+
+	// The clocks can be left out.
+	for _, fen := range []string{"4k3/8/8/8/4P3/8/8/4K3 b - e3", "4k3/8/8/8/4P3/8/8/4K3 b - e3 0"} {
+		if position, err := fromFEN(fen); err != nil || toFEN(position) != "4k3/8/8/8/4P3/8/8/4K3 b - e3 0 1" {
+			t.Errorf("FEN error test failed!\nFEN: %v\nGot: %v (%v)\n", fen, toFEN(position), err)
+		}
+	}
+}
+
+// Convert a FEN to a position without checking that it is legal, for tests of
+// parts of the engine which don't need kings on the board.
+func mustParseFEN(fen string) position {
+	position, err := parseFEN(fen)
+	if err != nil {
+		panic(err)
+	}
+
+	return position
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+)
+
+/*
+An opening book holds moves to play in the positions of the opening, so that
+the engine doesn't need to search them, and varies its play between games.
+
+Books are read in the Polyglot format: a sequence of polyglotEntrySize byte
+entries, sorted by key, each of which is:
+
+	bytes 0-7:   the Polyglot key of the position
+	bytes 8-9:   the move, encoded as in encodePolyglotMove
+	bytes 10-11: the weight of the move, relative to the others in the position
+	bytes 12-15: learning data, which is ignored
+
+All numbers are big endian. A position can have several entries, one for each
+move.
+*/
+type polyglotEntry struct {
+	key    uint64
+	move   uint16
+	weight uint16
+	learn  uint32
+}
+
+type openingBook struct {
+	entries []polyglotEntry
+}
+
+const polyglotEntrySize = 16
+
+/*
+The loaded book, or nil if there isn't one, and the options controlling it.
+The book is only used if ownBook is set, and then for the first bookDepth moves
+of the game. If bookRandom is set, moves are chosen at random in proportion to
+their weights, and otherwise the move with the highest weight is always played.
+*/
+var book *openingBook
+var ownBook bool
+var bookDepth = 20
+var bookRandom = true
+
+// Load a Polyglot book from a file.
+func loadBook(path string) (*openingBook, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data)%polyglotEntrySize != 0 {
+		return nil, errors.New("book is not a whole number of entries")
+	}
+
+	book := &openingBook{entries: make([]polyglotEntry, len(data)/polyglotEntrySize)}
+
+	for i := range book.entries {
+		entry := data[i*polyglotEntrySize : (i+1)*polyglotEntrySize]
+
+		book.entries[i] = polyglotEntry{
+			key:    binary.BigEndian.Uint64(entry[0:8]),
+			move:   binary.BigEndian.Uint16(entry[8:10]),
+			weight: binary.BigEndian.Uint16(entry[10:12]),
+			learn:  binary.BigEndian.Uint32(entry[12:16]),
+		}
+	}
+
+	return book, nil
+}
+
+// Find the entries of a position's key. The entries are sorted, so they can be
+// found by binary search.
+func (book *openingBook) lookup(key uint64) []polyglotEntry {
+	start := sort.Search(len(book.entries), func(i int) bool {
+		return book.entries[i].key >= key
+	})
+
+	end := start
+	for end < len(book.entries) && book.entries[end].key == key {
+		end++
+	}
+
+	return book.entries[start:end]
+}
+
+/*
+Choose a move from the book for a position, returning false if it has none.
+Moves with a weight of 0 are never played, and neither are moves which aren't
+legal in the position, in case of a collision between keys. If random is set,
+the move is chosen with a probability proportional to its weight, and otherwise
+the move with the highest weight is chosen.
+*/
+func (book *openingBook) pickMove(position position, random *rand.Rand) (move, bool) {
+	var moves []move
+	var weights []int
+	total := 0
+
+	for _, entry := range book.lookup(polyglotKey(position)) {
+		move, ok := decodePolyglotMove(position, entry.move)
+
+		if ok && entry.weight > 0 {
+			moves = append(moves, move)
+			weights = append(weights, int(entry.weight))
+			total += int(entry.weight)
+		}
+	}
+
+	if len(moves) == 0 {
+		return 0, false
+	}
+
+	if random == nil {
+		best := 0
+		for i, weight := range weights {
+			if weight > weights[best] {
+				best = i
+			}
+		}
+
+		return moves[best], true
+	}
+
+	choice := random.Intn(total)
+	for i, weight := range weights {
+		if choice < weight {
+			return moves[i], true
+		}
+
+		choice -= weight
+	}
+
+	return moves[len(moves)-1], true
+}
+
+// The source of randomness for choosing book moves.
+var bookRandomSource = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// Find the move the engine should play from its book, if it is enabled and has
+// a move for the position.
+func probeBook(position position) (move, bool) {
+	if !ownBook || book == nil || position.fullmove > bookDepth {
+		return 0, false
+	}
+
+	var random *rand.Rand
+	if bookRandom {
+		random = bookRandomSource
+	}
+
+	return book.pickMove(position, random)
+}
+
+// Load the book used by the engine, or unload it if no file is given.
+func setBookFile(path string) error {
+	if path == "" || path == "<empty>" {
+		book = nil
+		return nil
+	}
+
+	loaded, err := loadBook(path)
+	if err != nil {
+		return err
+	}
+
+	book = loaded
+	return nil
+}
+
+// Save a book to a file in the Polyglot format. Its entries must already be
+// sorted by key.
+func saveBook(path string, book *openingBook) error {
+	data := make([]byte, 0, len(book.entries)*polyglotEntrySize)
+
+	for _, entry := range book.entries {
+		var packed [polyglotEntrySize]byte
+
+		binary.BigEndian.PutUint64(packed[0:8], entry.key)
+		binary.BigEndian.PutUint16(packed[8:10], entry.move)
+		binary.BigEndian.PutUint16(packed[10:12], entry.weight)
+		binary.BigEndian.PutUint32(packed[12:16], entry.learn)
+
+		data = append(data, packed[:]...)
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpeningBook(t *testing.T) {
+	start := mustFromFEN(startPosition)
+	key := polyglotKey(start)
+
+	// e2e4 and d2d4 from the start, with a never played a2a3, and an entry for
+	// another position on either side.
+	entries := []polyglotEntry{
+		{key - 1, 12<<6 | 28, 100, 0},
+		{key, 12<<6 | 28, 30, 0},
+		{key, 11<<6 | 27, 10, 0},
+		{key, 8<<6 | 16, 0, 0},
+		{key + 1, 11<<6 | 27, 100, 0},
+	}
+
+	var data []byte
+	for _, entry := range entries {
+		var packed [polyglotEntrySize]byte
+		binary.BigEndian.PutUint64(packed[0:8], entry.key)
+		binary.BigEndian.PutUint16(packed[8:10], entry.move)
+		binary.BigEndian.PutUint16(packed[10:12], entry.weight)
+		binary.BigEndian.PutUint32(packed[12:16], entry.learn)
+		data = append(data, packed[:]...)
+	}
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	book, err := loadBook(path)
+	if err != nil {
+		t.Fatalf("Opening book test failed!\nCould not load book: %v\n", err)
+	}
+
+	if found := book.lookup(key); len(found) != 3 {
+		t.Errorf("Opening book test failed!\nExpected 3 entries, got %v\n", len(found))
+	}
+
+	if move, ok := book.pickMove(start, nil); !ok || encodePolyglotMove(start, move) != 12<<6|28 {
+		t.Errorf("Opening book test failed!\nExpected the highest weighted move e2e4\n")
+	}
+
+	// Moves are chosen in proportion to their weights.
+	counts := make(map[uint16]int)
+	random := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 4000; i++ {
+		move, _ := book.pickMove(start, random)
+		counts[encodePolyglotMove(start, move)]++
+	}
+
+	if counts[8<<6|16] != 0 || counts[12<<6|28] < 2800 || counts[12<<6|28] > 3200 {
+		t.Errorf("Opening book test failed!\nMoves not chosen by weight: %v\n", counts)
+	}
+
+	if _, ok := book.pickMove(mustFromFEN("4k3/8/8/8/8/8/8/4K3 w - - 0 1"), nil); ok {
+		t.Errorf("Opening book test failed!\nFound a move for a position not in the book\n")
+	}
+}
@@ -21,7 +21,17 @@ type globalData struct {
 	bestMove string
 }
 
-var engineData globalData
+// The engine starts from the initial position, so that commands which use the
+// position, like go and eval, are safe before the interface sends one.
+var engineData = newEngineData()
+
+func newEngineData() globalData {
+	return globalData{position: mustFromFEN(startPosition)}
+}
+
+// Whether the interface has enabled Chess960, which changes how castles are
+// written in UCI moves.
+var chess960 bool
 
 /* Store the global options set via Universal Chess Interface commands for the
 engine to follow during runtime.
@@ -105,6 +115,8 @@ func handleCommand(command string) bool {
 		// TODO
 	case "isready":
 		sendCommand("readyok")
+	case "setoption":
+		setOption(args)
 	case "ucinewgame":
 		handleNewGame()
 	case "position":
@@ -113,6 +125,8 @@ func handleCommand(command string) bool {
 		startAnalysis(args)
 	case "stop":
 		stopAnalysis()
+	case "eval":
+		explainEvaluation(args)
 	case "quit":
 		return false
 	}
@@ -124,12 +138,102 @@ func handleCommand(command string) bool {
 func handleUCI() {
 	sendCommand("id", "name", EngineName)
 	sendCommand("id", "author", EngineAuthor)
+	sendCommand("option", "name", "EvalFile", "type", "string", "default", "<empty>")
+	sendCommand("option", "name", "Use", "NNUE", "type", "check", "default", "false")
+	sendCommand("option", "name", "SyzygyPath", "type", "string", "default", "<empty>")
+	sendCommand("option", "name", "OwnBook", "type", "check", "default", "false")
+	sendCommand("option", "name", "BookFile", "type", "string", "default", "<empty>")
+	sendCommand("option", "name", "BookDepth", "type", "spin", "default", strconv.Itoa(bookDepth), "min", "1", "max", "100")
+	sendCommand("option", "name", "BookRandom", "type", "check", "default", "true")
+	sendCommand("option", "name", "UCI_Chess960", "type", "check", "default", "false")
 	sendCommand("uciok")
 }
 
+// Set an engine option, given a command of the form "setoption name <id> value
+// <x>". Option names are case insensitive, and both names and values may
+// contain spaces.
+func setOption(args []string) {
+	nameIndex := argumentPresent("name", args)
+	valueIndex := argumentPresent("value", args)
+
+	if nameIndex == -1 {
+		return
+	}
+
+	var name string
+	var value string
+	if valueIndex == -1 {
+		name = strings.Join(args[nameIndex+1:], " ")
+	} else {
+		name = strings.Join(args[nameIndex+1:valueIndex], " ")
+		value = strings.Join(args[valueIndex+1:], " ")
+	}
+
+	switch strings.ToLower(name) {
+	case "evalfile":
+		setEvalFile(value)
+	case "use nnue":
+		useNNUE = strings.ToLower(value) == "true"
+	case "syzygypath":
+		count := setSyzygyPath(value)
+		sendCommand("info", "string", "Found", strconv.Itoa(count), "tablebases")
+	case "ownbook":
+		ownBook = strings.ToLower(value) == "true"
+	case "bookfile":
+		if err := setBookFile(value); err != nil {
+			sendCommand("info", "string", "Could not load book:", err.Error())
+		}
+	case "bookdepth":
+		if depth, err := strconv.Atoi(value); err == nil {
+			bookDepth = depth
+		}
+	case "bookrandom":
+		bookRandom = strings.ToLower(value) == "true"
+	case "uci_chess960":
+		chess960 = strings.ToLower(value) == "true"
+	}
+}
+
+// Load an evaluation file, or restore the built-in parameters and unload any
+// network if no file is given.
+func setEvalFile(path string) {
+	if path == "" || path == "<empty>" {
+		setEvalParameters(defaultEvalParameters())
+		setNetwork(nil)
+		return
+	}
+
+	if err := loadEvalFile(path); err != nil {
+		sendCommand("info", "string", "Could not load evaluation file:", err.Error())
+	}
+}
+
+// Load an evaluation file, which may be either a network for the neural network
+// evaluation or the parameters of the hand-written evaluation. Networks are
+// recognised by the magic number at the start of the file.
+func loadEvalFile(path string) error {
+	if isNetworkFile(path) {
+		network, err := loadNetwork(path)
+		if err != nil {
+			return err
+		}
+
+		setNetwork(network)
+		return nil
+	}
+
+	params, err := loadEvalParameters(path)
+	if err != nil {
+		return err
+	}
+
+	setEvalParameters(params)
+	return nil
+}
+
 // Establish a new game in the engine data.
 func handleNewGame() {
-	engineData.position = fromFEN(startPosition)
+	engineData.position = mustFromFEN(startPosition)
 	sendCommand("isready")
 }
 
@@ -137,6 +241,11 @@ func handleNewGame() {
 func setupPosition(args []string) {
 	var fen string
 
+	if len(args) < 2 {
+		sendCommand("info", "string", "Missing position")
+		return
+	}
+
 	// The position can be "startpos", meaning a game's initial starting
 	// position, or a FEN specified by the interface.
 	if args[1] == "startpos" {
@@ -145,11 +254,22 @@ func setupPosition(args []string) {
 		fen = strings.TrimSpace(strings.Join(args[2:], " "))
 	}
 
-	engineData.position = fromFEN(fen)
+	// Any moves follow the FEN.
+	if i := strings.Index(fen, "moves"); i >= 0 {
+		fen = fen[:i]
+	}
+
+	position, err := fromFEN(fen)
+	if err != nil {
+		sendCommand("info", "string", "Invalid FEN:", err.Error())
+		return
+	}
+
+	engineData.position = position
 
 	// For each move specified after the initial FEN, apply the move.
-	if len(args) > 1 {
-		for _, m := range args[:1] {
+	if i := argumentPresent("moves", args); i != -1 {
+		for _, m := range args[i+1:] {
 			engineData.position = applyMove(engineData.position, m)
 		}
 	}
@@ -160,6 +280,13 @@ func setupPosition(args []string) {
 func startAnalysis(args []string) {
 	var options analysisOptions
 
+	// If the book has a move for the position, play it without searching.
+	if bookMove, ok := probeBook(engineData.position); ok {
+		engineData.bestMove = toUCI(engineData.position, bookMove)
+		sendCommand("bestmove", engineData.bestMove)
+		return
+	}
+
 	// Determine the analysis mode, based on the command given, and load
 	// analysis settings.
 	if argumentPresent("infinite", args) != -1 {
@@ -232,7 +359,7 @@ func startAnalysis(args []string) {
 		// For the depth-limited mode, the search tree is simply searched to the
 		// given depth.
 		bestMove := search(engineData.position, options.depth, -100000, 100000)
-		sendCommand("bestmove", toAlgebraic(engineData.position, bestMove))
+		sendCommand("bestmove", toUCI(engineData.position, bestMove))
 
 	}
 }
@@ -254,11 +381,35 @@ func waitToClose(ctx context.Context, ch chan move, cancel context.CancelFunc) {
 // best move to the interface.
 func awaitBestMove(position position, ch chan move) {
 	for move := range ch {
-		engineData.bestMove = toAlgebraic(position, move)
+		engineData.bestMove = toUCI(position, move)
 	}
 	sendCommand("bestmove", engineData.bestMove)
 }
 
+// Print a breakdown of the evaluation of the current position. This isn't part
+// of the UCI protocol, but is useful for debugging. The breakdown is a table by
+// default, or JSON if the command is "eval json".
+func explainEvaluation(args []string) {
+	trace := traceEvaluation(engineData.position)
+
+	if argumentPresent("json", args) != -1 {
+		output, err := trace.toJSON()
+
+		if err != nil {
+			sendDebug(err.Error())
+			return
+		}
+
+		fmt.Println(string(output))
+	} else {
+		fmt.Println(trace.table())
+
+		if useNNUE && canEvaluateNNUE(engineData.position) {
+			fmt.Printf("NNUE evaluation (side to move): %v\n", evaluateNNUE(engineData.position))
+		}
+	}
+}
+
 // Return the current best move of the engine immediately.
 func stopAnalysis() {
 	sendCommand("bestmove", engineData.bestMove)
@@ -276,12 +427,49 @@ func argumentPresent(arg string, args []string) int {
 	return -1
 }
 
-// Apply a move string to the position given.
-// This capability is not yet implemented.
+// Apply a move string to the position given. A move which isn't legal is
+// reported, and the position left as it is.
 func applyMove(position position, move string) position {
+	parsed, err := parseUCIMove(position, move)
+	if err != nil {
+		sendCommand("info", "string", "Invalid move:", err.Error())
+		return position
+	}
+
+	makeMove(&position, parsed)
+
 	return position
 }
 
+// Convert a move to the coordinate notation of UCI, such as e2e4 or e7e8q. A
+// castle is written as the king's move, such as e1g1, unless Chess960 is
+// enabled, when it is written as the king taking its own rook, such as e1h1.
+// This is because a Chess960 king can start beside the square it castles to.
+func toUCI(position position, move move) string {
+	if move.isCastle() {
+		kingOrigin, rookOrigin, kingFinal, _ := castlingSquares(position, move.castleSide(), position.toMove)
+
+		if chess960 {
+			return indexToSquare(byte(kingOrigin)) + indexToSquare(byte(rookOrigin))
+		}
+
+		return indexToSquare(byte(kingOrigin)) + indexToSquare(byte(kingFinal))
+	}
+
+	return strings.ToLower(toAlgebraic(position, move))
+}
+
+// Find the legal move of a position written in UCI notation.
+func parseUCIMove(position position, text string) (move, error) {
+	for _, move := range generateLegalMoves(position) {
+		if toUCI(position, move) == text {
+			return move, nil
+		}
+	}
+
+	return 0, fmt.Errorf("illegal move %v", text)
+}
+
 // Determine if the move is in algebraic form. This feature is not yet
 // implemented.
 func isAlgebraic(move string) bool {
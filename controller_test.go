@@ -0,0 +1,102 @@
+package main
+
+import "testing"
+
+func TestUCIMoves(t *testing.T) {
+	defer func() { chess960 = false }()
+
+	var tests = []struct {
+		fen       string
+		chess960  bool
+		kingside  string
+		queenside string
+	}{
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", false, "e1g1", "e1c1"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", false, "e8g8", "e8c8"},
+		{"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", true, "e1h1", "e1a1"},
+		{"1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3KR1 b KQkq - 0 1", true, "f8g8", "f8b8"},
+	}
+
+	for _, test := range tests {
+		chess960 = test.chess960
+		position := mustFromFEN(test.fen)
+		castles := 0
+
+		for _, move := range generateLegalMoves(position) {
+			text := toUCI(position, move)
+
+			if move.isCastle() {
+				castles++
+			}
+
+			if move.isKingCastle() && text != test.kingside || move.isQueenCastle() && text != test.queenside {
+				t.Errorf("UCI move test failed!\nFEN: %v\nChess960: %v\nCastle written as: %v\n", test.fen, test.chess960, text)
+			}
+
+			if parsed, err := parseUCIMove(position, text); err != nil || parsed != move {
+				t.Errorf("UCI move test failed!\nFEN: %v\nMove: %v\nParsed: %v (%v)\n", test.fen, text, toUCI(position, parsed), err)
+			}
+		}
+
+		if castles != 2 {
+			t.Errorf("UCI move test failed!\nFEN: %v\nExpected 2 castles, got %v\n", test.fen, castles)
+		}
+	}
+
+	chess960 = false
+	if text := toUCI(mustFromFEN("8/4P3/8/8/8/8/k7/4K3 w - - 0 1"), createPromotionMove(100, 116, Queen)); text != "e7e8q" {
+		t.Errorf("UCI move test failed!\nExpected: e7e8q\nGot: %v\n", text)
+	}
+
+	if _, err := parseUCIMove(mustFromFEN(startPosition), "e2e5"); err == nil {
+		t.Errorf("UCI move test failed!\nAccepted an illegal move\n")
+	}
+}
+
+func TestInitialEngineData(t *testing.T) {
+	data := newEngineData()
+
+	if fen := toFEN(data.position); fen != startPosition {
+		t.Errorf("Initial engine data test failed!\nExpected: %v\nGot: %v\n", startPosition, fen)
+	}
+
+	if err := checkIncrementalState(data.position); err != nil {
+		t.Errorf("Initial engine data test failed!\n%v\n", err)
+	}
+
+	if moves := len(generateLegalMoves(data.position)); moves != 20 {
+		t.Errorf("Initial engine data test failed!\nExpected 20 legal moves, got %v\n", moves)
+	}
+}
+
+func TestSetupPosition(t *testing.T) {
+	defer func() {
+		chess960 = false
+		engineData = newEngineData()
+	}()
+
+	var tests = []struct {
+		command  string
+		chess960 bool
+		expected string
+	}{
+		{"position startpos", false, startPosition},
+		{"position startpos moves e2e4 e7e5 g1f3", false, "rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2"},
+		{"position", false, startPosition},
+		{"position fen", false, startPosition},
+		{"position fen r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1 moves e1g1 e8c8", false, "2kr3r/8/8/8/8/8/8/R4RK1 w - - 2 2"},
+		{"position fen 1r3kr1/pppppppp/8/8/8/8/PPPPPPPP/1R3KR1 w KQkq - 0 1 moves f1g1 f8b8", true, "2kr2r1/pppppppp/8/8/8/8/PPPPPPPP/1R3RK1 w - - 2 2"},
+	}
+
+	for _, test := range tests {
+		// Each command starts from a fresh engine, so a command which is
+		// ignored must leave the initial position in place.
+		engineData = newEngineData()
+		chess960 = test.chess960
+		handleCommand(test.command)
+
+		if fen := toFEN(engineData.position); fen != test.expected {
+			t.Errorf("Position setup test failed!\nCommand: %v\nExpected: %v\nGot: %v\n", test.command, test.expected, fen)
+		}
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+)
+
+/*
+The datagen command generates training data for the evaluation by self-play.
+Each game starts with a number of random moves, then the engine plays both sides,
+searching a fixed number of nodes per move. Every quiet position reached is
+recorded with the score of its search and the result of the game, from white's
+perspective.
+
+A position is quiet if the side to move isn't in check and the best move found
+isn't a capture or promotion, so that its score doesn't depend on an exchange
+in progress. Positions with a score beyond datagenScoreLimit are skipped, since
+the game is already decided.
+
+Games are played in parallel, one per goroutine, and written in either the
+plain-text format read by the tune command:
+
+	<fen> | <score> | <result>
+
+or a compact binary format of packedPositionSize bytes per position, described
+at packPosition.
+*/
+type trainingPosition struct {
+	position position
+	score    int
+	result   float64
+}
+
+type datagenOptions struct {
+	games       int
+	nodes       int
+	threads     int
+	randomPlies int
+	maxPlies    int
+	seed        int64
+	format      string
+}
+
+const datagenScoreLimit = 3000
+
+// Run the datagen command, given its command line arguments.
+func runDatagen(args []string) {
+	var options datagenOptions
+
+	flags := flag.NewFlagSet("datagen", flag.ExitOnError)
+	flags.IntVar(&options.games, "games", 100, "Number of games to play")
+	flags.IntVar(&options.nodes, "nodes", 5000, "Number of nodes to search for each move")
+	flags.IntVar(&options.threads, "threads", 1, "Number of games to play at once")
+	flags.IntVar(&options.randomPlies, "randomPlies", 8, "Number of random moves at the start of each game")
+	flags.IntVar(&options.maxPlies, "maxPlies", 400, "Number of moves after which a game is drawn")
+	flags.Int64Var(&options.seed, "seed", 1, "Seed for the random openings")
+	flags.StringVar(&options.format, "format", "binary", "Output format, either binary or text")
+	outputPath := flags.String("output", "training.bin", "Location to write the training data")
+	flags.Parse(args)
+
+	if options.format != "binary" && options.format != "text" {
+		log.Fatal("Unknown format: ", options.format)
+	}
+
+	file, err := os.Create(*outputPath)
+	if err != nil {
+		log.Fatal("Could not create output: ", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	count := 0
+
+	err = generateTrainingData(options, func(games int, positions []trainingPosition) error {
+		for _, trainingPosition := range positions {
+			if err := writeTrainingPosition(writer, trainingPosition, options.format); err != nil {
+				return err
+			}
+		}
+
+		count += len(positions)
+		log.Printf("Game %v/%v, %v positions", games, options.games, count)
+
+		return nil
+	})
+
+	if err == nil {
+		err = writer.Flush()
+	}
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		log.Fatal("Could not write training data: ", err)
+	}
+}
+
+/*
+Play the games, calling output with the positions of each game as it finishes,
+along with the number of games finished so far. output is only ever called from
+one goroutine at a time, and the first error it returns stops the generation.
+*/
+func generateTrainingData(options datagenOptions, output func(int, []trainingPosition) error) error {
+	seeds := make(chan int64)
+	results := make(chan []trainingPosition)
+	done := make(chan struct{})
+
+	var workers sync.WaitGroup
+
+	for i := 0; i < options.threads; i++ {
+		workers.Add(1)
+
+		go func() {
+			defer workers.Done()
+
+			for seed := range seeds {
+				select {
+				case results <- playTrainingGame(options, rand.New(rand.NewSource(seed))):
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(seeds)
+
+		for game := 0; game < options.games; game++ {
+			select {
+			case seeds <- options.seed + int64(game):
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	var err error
+	games := 0
+
+	for positions := range results {
+		if err != nil {
+			continue
+		}
+
+		games++
+
+		if err = output(games, positions); err != nil {
+			close(done)
+		}
+	}
+
+	return err
+}
+
+// Play a single game of self-play, returning its quiet positions labelled with
+// the result.
+func playTrainingGame(options datagenOptions, random *rand.Rand) []trainingPosition {
+	position := mustFromFEN(startPosition)
+
+	// Play the random opening, starting again if it ends the game.
+	for ply := 0; ply < options.randomPlies; ply++ {
+		moves := generateLegalMoves(position)
+
+		if len(moves) == 0 {
+			return playTrainingGame(options, random)
+		}
+
+		makeMove(&position, moves[random.Intn(len(moves))])
+	}
+
+	var positions []trainingPosition
+	repetitions := make(map[string]int)
+	result := 0.5
+
+	for ply := 0; ply < options.maxPlies; ply++ {
+		moves := generateLegalMoves(position)
+		inCheck := isKingInCheck(position, opposingColor(position.toMove))
+
+		if len(moves) == 0 {
+			if inCheck && position.toMove == White {
+				result = 0
+			} else if inCheck {
+				result = 1
+			}
+
+			break
+		}
+
+		repetitionKey := strings.Join(strings.Fields(toFEN(position))[:4], " ")
+		repetitions[repetitionKey]++
+
+		if position.halfmove >= 100 || repetitions[repetitionKey] >= 3 || isInsufficientMaterial(position) {
+			break
+		}
+
+		bestMove, score := searchNodes(position, options.nodes)
+		if position.toMove == Black {
+			score = -score
+		}
+
+		quiet := !inCheck && !bestMove.isCapture() && !bestMove.isPromotion()
+		if quiet && score > -datagenScoreLimit && score < datagenScoreLimit {
+			positions = append(positions, trainingPosition{position: position, score: score})
+		}
+
+		makeMove(&position, bestMove)
+	}
+
+	for i := range positions {
+		positions[i].result = result
+	}
+
+	return positions
+}
+
+// Is there too little material on the board for either side to checkmate? This
+// is true when only the kings remain, or the kings and a single knight or
+// bishop.
+func isInsufficientMaterial(position position) bool {
+	minors := 0
+
+	for i := 0; i < BoardSize; i++ {
+		p := position.board[i]
+
+		if !isOnBoard(i) || !p.exists() || p.is(King) {
+			continue
+		}
+
+		if !p.is(Knight) && !p.is(Bishop) {
+			return false
+		}
+
+		minors++
+	}
+
+	return minors <= 1
+}
+
+// Write a training position in the given format.
+func writeTrainingPosition(writer io.Writer, trainingPosition trainingPosition, format string) error {
+	if format == "binary" {
+		packed := packPosition(trainingPosition)
+		_, err := writer.Write(packed[:])
+		return err
+	}
+
+	_, err := fmt.Fprintf(writer, "%v | %v | %.1f\n", toFEN(trainingPosition.position), trainingPosition.score, trainingPosition.result)
+	return err
+}
+
+const packedPositionSize = 32
+
+// The pieces of the packed format, in the order of their codes.
+var packedPieces = [6]piece{Pawn, Knight, Bishop, Rook, Queen, King}
+
+/*
+Pack a training position into the binary format:
+
+	bytes 0-7:   bitboard of occupied squares
+	bytes 8-23:  a 4-bit code for each occupied square, in order of the squares,
+	             two to a byte with the first in the low bits. The low 3 bits
+	             are the piece's index in packedPieces, and the high bit is set
+	             for black.
+	byte 24:     the castling rights, with the high bit set if black is to move.
+	             Each right is taken to be with the outermost rook on its side.
+	byte 25:     the standard square of the en passant target, or 64 for none
+	byte 26:     the halfmove clock
+	bytes 27-28: the fullmove number
+	bytes 29-30: the score, from white's perspective
+	byte 31:     the result: 0 for a black win, 1 for a draw, 2 for a white win
+
+Numbers are little endian. A legal position has at most 32 pieces, so they all
+fit.
+*/
+func packPosition(trainingPosition trainingPosition) [packedPositionSize]byte {
+	var packed [packedPositionSize]byte
+
+	position := trainingPosition.position
+
+	var occupied uint64
+	pieceCount := 0
+
+	for square := 0; square < 64; square++ {
+		p := position.board[standardTo0x88(square)]
+
+		if !p.exists() {
+			continue
+		}
+
+		var code byte
+		for i, packedPiece := range packedPieces {
+			if p.is(packedPiece) {
+				code = byte(i)
+			}
+		}
+
+		if p.color() == Black {
+			code |= 0x8
+		}
+
+		occupied |= 1 << uint(square)
+		packed[8+pieceCount/2] |= code << uint(4*(pieceCount%2))
+		pieceCount++
+	}
+
+	binary.LittleEndian.PutUint64(packed[0:8], occupied)
+
+	packed[24] = position.castling
+	if position.toMove == Black {
+		packed[24] |= 0x80
+	}
+
+	packed[25] = 64
+	if position.enPassantTarget != NoEnPassant {
+		packed[25] = byte(map0x88ToStandard(int(position.enPassantTarget)))
+	}
+
+	packed[26] = position.halfmove
+	binary.LittleEndian.PutUint16(packed[27:29], uint16(position.fullmove))
+	binary.LittleEndian.PutUint16(packed[29:31], uint16(int16(trainingPosition.score)))
+	packed[31] = byte(trainingPosition.result * 2)
+
+	return packed
+}
+
+// Unpack a training position from the binary format.
+func unpackPosition(packed [packedPositionSize]byte) (trainingPosition, error) {
+	var position position
+
+	occupied := binary.LittleEndian.Uint64(packed[0:8])
+	if bits.OnesCount64(occupied) > 32 {
+		return trainingPosition{}, errors.New("too many pieces")
+	}
+
+	pieceCount := 0
+	for remaining := occupied; remaining != 0; remaining &= remaining - 1 {
+		square := bits.TrailingZeros64(remaining)
+		code := packed[8+pieceCount/2] >> uint(4*(pieceCount%2)) & 0xF
+
+		if code&0x7 >= byte(len(packedPieces)) {
+			return trainingPosition{}, fmt.Errorf("invalid piece code %v", code)
+		}
+
+		p := packedPieces[code&0x7]
+		if code&0x8 != 0 {
+			p |= Black
+		}
+
+		position.board[standardTo0x88(square)] = p
+		pieceCount++
+	}
+
+	position.castling = packed[24] & 0xF
+	findCastlingSquares(&position)
+	position.toMove = White
+	if packed[24]&0x80 != 0 {
+		position.toMove = Black
+	}
+
+	position.enPassantTarget = NoEnPassant
+	if packed[25] < 64 {
+		position.enPassantTarget = byte((packed[25]/8)*16 + packed[25]%8)
+	}
+
+	position.halfmove = packed[26]
+	position.fullmove = int(binary.LittleEndian.Uint16(packed[27:29]))
+
+	initialiseIncrementalState(&position)
+
+	score := int(int16(binary.LittleEndian.Uint16(packed[29:31])))
+	result := float64(packed[31]) / 2
+
+	return trainingPosition{position, score, result}, nil
+}
+
+// Read every training position in a file of the binary format.
+func loadPackedPositions(path string) ([]trainingPosition, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	var positions []trainingPosition
+	var packed [packedPositionSize]byte
+
+	for {
+		if _, err := io.ReadFull(reader, packed[:]); err == io.EOF {
+			return positions, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		trainingPosition, err := unpackPosition(packed)
+		if err != nil {
+			return nil, err
+		}
+
+		positions = append(positions, trainingPosition)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestPackPosition(t *testing.T) {
+	var tests = []trainingPosition{
+		{mustFromFEN("rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"), 0, 0.5},
+		{mustFromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b Kq - 3 27"), -250, 0},
+		{mustFromFEN("rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3"), 1500, 1},
+		{mustFromFEN("8/8/8/8/8/8/6k1/4K3 w - - 99 300"), -2999, 0.5},
+	}
+
+	for _, test := range tests {
+		unpacked, err := unpackPosition(packPosition(test))
+
+		if err != nil {
+			t.Errorf("Packing position failed!\nFEN: %v\nError: %v\n", toFEN(test.position), err)
+			continue
+		}
+
+		if unpacked != test {
+			t.Errorf("Packing position failed!\nExpected: %v %v %v\nGot: %v %v %v\n", toFEN(test.position), test.score, test.result, toFEN(unpacked.position), unpacked.score, unpacked.result)
+		}
+	}
+}
+
+func TestTrainingGame(t *testing.T) {
+	options := datagenOptions{nodes: 200, randomPlies: 8, maxPlies: 30}
+
+	first := playTrainingGame(options, rand.New(rand.NewSource(1)))
+	second := playTrainingGame(options, rand.New(rand.NewSource(1)))
+
+	if len(first) == 0 {
+		t.Fatalf("Training game failed!\nNo positions were recorded\n")
+	}
+
+	if len(first) != len(second) {
+		t.Fatalf("Training game failed!\nThe same seed gave %v and %v positions\n", len(first), len(second))
+	}
+
+	for i, trainingPosition := range first {
+		if trainingPosition != second[i] {
+			t.Errorf("Training game failed!\nThe same seed gave different positions\n")
+		}
+
+		if isKingInCheck(trainingPosition.position, opposingColor(trainingPosition.position.toMove)) {
+			t.Errorf("Training game failed!\nFEN: %v\nRecorded a position in check\n", toFEN(trainingPosition.position))
+		}
+
+		// Each position must be readable by the tuner.
+		var line bytes.Buffer
+		if err := writeTrainingPosition(&line, trainingPosition, "text"); err != nil {
+			t.Fatal(err)
+		}
+
+		labelled, err := parseLabelledPosition(strings.TrimSpace(line.String()))
+		if err != nil || labelled.position != trainingPosition.position || labelled.result != trainingPosition.result {
+			t.Errorf("Training game failed!\nLine: %v\nCould not be read back\n", line.String())
+		}
+	}
+}
+
+func TestGenerateTrainingData(t *testing.T) {
+	options := datagenOptions{games: 6, nodes: 100, threads: 3, randomPlies: 8, maxPlies: 10, seed: 5}
+
+	var finished []int
+	err := generateTrainingData(options, func(games int, positions []trainingPosition) error {
+		finished = append(finished, games)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(finished) != options.games || finished[len(finished)-1] != options.games {
+		t.Errorf("Generating training data failed!\nExpected %v games\nGot: %v\n", options.games, finished)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build debug
+
+package main
+
+// Debug builds, made with the debug build tag, check expensive invariants as the
+// engine runs.
+const debugMode = true
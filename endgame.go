@@ -0,0 +1,381 @@
+package main
+
+import "math/bits"
+
+/*
+Some endgames are evaluated badly by the general evaluation, either because
+winning them needs a plan it doesn't know, like driving the king into a corner
+in KBNK, or because the extra material isn't enough to win, as with opposite
+coloured bishops.
+
+Endgames with a specialised evaluator are found by their material signature:
+the number of each type of piece other than kings on each side. An evaluator
+replaces the general evaluation completely, and returns a score from the
+perspective of the stronger side. Endgames are named by their signature, with
+the stronger side first, so KRKP is a king and rook against a king and pawn.
+
+Other endgames which are likely to be drawn have their endgame score reduced by
+a scale factor, out of scaleNormal.
+*/
+
+const scaleNormal = 64
+const scaleDraw = 0
+
+// A score which is better than any normal evaluation, for endgames which are
+// known to be won. It is still well short of a checkmate.
+const knownWinScore = 10000
+
+// The piece types counted in a material signature, in order.
+var signaturePieces = [5]piece{Pawn, Knight, Bishop, Rook, Queen}
+
+/*
+endgameFunction evaluates an endgame. pieces holds the bitboards of each piece
+type for each side, kings the standard square of each king, toMove the colour of
+the side to move and strong the side index of the stronger side.
+*/
+type endgameFunction func(pieces [2][8]uint64, kings [2]int, toMove byte, strong int) int
+
+type endgame struct {
+	name     string
+	strong   int
+	evaluate endgameFunction
+}
+
+// The specialised evaluators, indexed by material key.
+var endgames = generateEndgames()
+
+func generateEndgames() map[uint64]endgame {
+	endgames := make(map[uint64]endgame)
+
+	// Each endgame is registered twice, once for each colour of the stronger
+	// side.
+	register := func(name string, evaluate endgameFunction) {
+		strong, weak := parseEndgameName(name)
+
+		endgames[signatureKey([2][5]int{strong, weak})] = endgame{name, 0, evaluate}
+		endgames[signatureKey([2][5]int{weak, strong})] = endgame{name, 1, evaluate}
+	}
+
+	register("KBNK", evaluateKBNK)
+	register("KPK", evaluateKPK)
+	register("KRKP", evaluateKRKP)
+	register("KQKR", evaluateKQKR)
+	register("KNNK", evaluateDrawnEndgame)
+	register("KNK", evaluateDrawnEndgame)
+	register("KBK", evaluateDrawnEndgame)
+
+	return endgames
+}
+
+// Find the piece counts of each side in an endgame name, such as KRKP.
+func parseEndgameName(name string) ([5]int, [5]int) {
+	var counts [2][5]int
+	side := -1
+
+	for _, char := range name {
+		if char == 'K' {
+			side++
+			continue
+		}
+
+		for i, p := range signaturePieces {
+			if pieceToString(p) == string(char) {
+				counts[side][i]++
+			}
+		}
+	}
+
+	return counts[0], counts[1]
+}
+
+// Count the pieces of each type for each side, giving the material signature.
+func materialSignature(pieces [2][8]uint64) [2][5]int {
+	var signature [2][5]int
+
+	for side := range signature {
+		for i, p := range signaturePieces {
+			signature[side][i] = bits.OnesCount64(pieces[side][p])
+		}
+	}
+
+	return signature
+}
+
+// Pack a material signature into a key. There can't be more than 10 of any
+// type of piece, so each count fits in 4 bits.
+func signatureKey(signature [2][5]int) uint64 {
+	var key uint64
+
+	for side := range signature {
+		for i, count := range signature[side] {
+			key |= uint64(count) << uint(4*(side*5+i))
+		}
+	}
+
+	return key
+}
+
+// Find the specialised evaluator for the position, if there is one. Both kings
+// must be on the board.
+func findEndgame(pieces [2][8]uint64, kings [2]int) (endgame, bool) {
+	if kings[0] == -1 || kings[1] == -1 {
+		return endgame{}, false
+	}
+
+	signature := materialSignature(pieces)
+
+	if endgame, ok := endgames[signatureKey(signature)]; ok {
+		return endgame, true
+	}
+
+	// A lone king against enough material to force checkmate is handled by
+	// a general evaluator, since there are too many signatures to list.
+	for strong := range signature {
+		if signature[1-strong] == [5]int{} && hasMatingMaterial(pieces[strong]) {
+			return endgame{"KXK", strong, evaluateKXK}, true
+		}
+	}
+
+	return endgame{}, false
+}
+
+// Can the pieces force checkmate against a lone king, without promoting a pawn?
+func hasMatingMaterial(pieces [8]uint64) bool {
+	bishops := pieces[Bishop]
+	bothColours := bishops&lightSquares != 0 && bishops&darkSquares != 0
+
+	return pieces[Queen] != 0 || pieces[Rook] != 0 || bothColours || (bishops != 0 && pieces[Knight] != 0)
+}
+
+// Find the value of one side's pieces, other than the king.
+func nonKingMaterial(pieces [8]uint64) int {
+	return bits.OnesCount64(pieces[Queen])*evalParams.QueenWeight +
+		bits.OnesCount64(pieces[Rook])*evalParams.RookWeight +
+		bits.OnesCount64(pieces[Bishop])*evalParams.BishopWeight +
+		bits.OnesCount64(pieces[Knight])*evalParams.KnightWeight +
+		bits.OnesCount64(pieces[Pawn])*evalParams.PawnWeight
+}
+
+// A bonus for a king being near the edge of the board, and a greater one for
+// being near a corner.
+func pushToEdge(square int) int {
+	file := square % 8
+	if file > 3 {
+		file = 7 - file
+	}
+
+	rank := square / 8
+	if rank > 3 {
+		rank = 7 - rank
+	}
+
+	return 20 * (6 - file - rank)
+}
+
+// A bonus for two squares being close together.
+func pushClose(a int, b int) int {
+	return 140 - 20*squareDistance(a, b)
+}
+
+// Draw the lone king to the edge of the board, and bring the other king closer
+// to help checkmate it.
+func evaluateKXK(pieces [2][8]uint64, kings [2]int, toMove byte, strong int) int {
+	return knownWinScore + nonKingMaterial(pieces[strong]) + pushToEdge(kings[1-strong]) + pushClose(kings[0], kings[1])
+}
+
+// Checkmate with a bishop and knight is only possible in a corner the bishop
+// can reach, so the lone king is driven towards one of those.
+func evaluateKBNK(pieces [2][8]uint64, kings [2]int, toMove byte, strong int) int {
+	corners := [2]int{0, 63}
+	if pieces[strong][Bishop]&lightSquares != 0 {
+		corners = [2]int{7, 56}
+	}
+
+	weakKing := kings[1-strong]
+
+	cornerDistance := squareDistance(weakKing, corners[0])
+	if distance := squareDistance(weakKing, corners[1]); distance < cornerDistance {
+		cornerDistance = distance
+	}
+
+	return knownWinScore + evalParams.BishopWeight + evalParams.KnightWeight + 40*(7-cornerDistance) + pushClose(kings[0], kings[1])
+}
+
+// A king and pawn against a king is looked up in the KPK bitbase. Won positions
+// are given a bonus for advancing the pawn, so that progress is made.
+func evaluateKPK(pieces [2][8]uint64, kings [2]int, toMove byte, strong int) int {
+	color := byte(White)
+	if strong == 1 {
+		color = Black
+	}
+
+	pawn := bits.TrailingZeros64(pieces[strong][Pawn])
+
+	if !probeKPK(color, kings[strong], pawn, kings[1-strong], toMove) {
+		return 0
+	}
+
+	return knownWinScore + evalParams.PawnWeight + 10*relativeRank(pawn, color)
+}
+
+/*
+A rook against a pawn is usually won, unless the pawn is far advanced and
+supported by its king, while the other king is far away. The squares are
+flipped if necessary so that the stronger side is white, and the pawn moves
+down the board.
+*/
+func evaluateKRKP(pieces [2][8]uint64, kings [2]int, toMove byte, strong int) int {
+	flip := 0
+	if strong == 1 {
+		flip = 56
+	}
+
+	strongKing := kings[strong] ^ flip
+	weakKing := kings[1-strong] ^ flip
+	rook := bits.TrailingZeros64(pieces[strong][Rook]) ^ flip
+	pawn := bits.TrailingZeros64(pieces[1-strong][Pawn]) ^ flip
+	promotion := pawn % 8
+
+	strongToMove := 0
+	weakToMove := 1
+	if sideIndex(toMove) == strong {
+		strongToMove = 1
+		weakToMove = 0
+	}
+
+	// The stronger king is in front of the pawn, or the weaker king is too far
+	// away to support it.
+	if forwardFileMasks[1][pawn]&(1<<uint(strongKing)) != 0 {
+		return evalParams.RookWeight - squareDistance(strongKing, pawn)
+	}
+
+	if squareDistance(weakKing, pawn) >= 3+weakToMove && squareDistance(weakKing, rook) >= 3 {
+		return evalParams.RookWeight - squareDistance(strongKing, pawn)
+	}
+
+	// The pawn is far advanced and supported, and the stronger king can't
+	// reach it in time.
+	if weakKing/8 <= 2 && squareDistance(weakKing, pawn) == 1 && strongKing/8 >= 3 && squareDistance(strongKing, pawn) > 2+strongToMove {
+		return 80 - 8*squareDistance(strongKing, pawn)
+	}
+
+	return 200 - 8*(squareDistance(strongKing, pawn-8)-squareDistance(weakKing, pawn-8)-squareDistance(pawn, promotion))
+}
+
+// A queen against a rook is a win, by driving the defending king to the edge.
+func evaluateKQKR(pieces [2][8]uint64, kings [2]int, toMove byte, strong int) int {
+	return evalParams.QueenWeight - evalParams.RookWeight + pushToEdge(kings[1-strong]) + pushClose(kings[0], kings[1])
+}
+
+// Some endgames can't be won by either side.
+func evaluateDrawnEndgame(pieces [2][8]uint64, kings [2]int, toMove byte, strong int) int {
+	return 0
+}
+
+/*
+Find the scale factor for the endgame score, given the endgame score from
+white's perspective. The stronger side is the one the score favours, and the
+endgame is scaled down if it is likely to be drawn:
+
+  - With opposite coloured bishops, and no other pieces, the weaker side can
+    usually blockade the pawns. Other pieces make this less likely.
+  - A bishop and rook pawns can't win if the bishop doesn't control the
+    promotion square and the defending king reaches it.
+  - Without pawns, a small material advantage is rarely enough to win.
+*/
+func endgameScale(pieces [2][8]uint64, kings [2]int, eg int) int {
+	strong := 0
+	if eg < 0 {
+		strong = 1
+	}
+
+	weak := 1 - strong
+	strongMaterial := nonKingMaterial(pieces[strong]) - bits.OnesCount64(pieces[strong][Pawn])*evalParams.PawnWeight
+	weakMaterial := nonKingMaterial(pieces[weak]) - bits.OnesCount64(pieces[weak][Pawn])*evalParams.PawnWeight
+
+	if pieces[strong][Pawn] == 0 && strongMaterial-weakMaterial <= evalParams.BishopWeight {
+		if strongMaterial < evalParams.RookWeight {
+			return scaleDraw
+		}
+
+		if weakMaterial <= evalParams.BishopWeight {
+			return 4
+		}
+
+		return 14
+	}
+
+	if isWrongRookPawn(pieces, kings, strong) {
+		return scaleDraw
+	}
+
+	if isOppositeBishops(pieces) {
+		if strongMaterial == evalParams.BishopWeight && weakMaterial == evalParams.BishopWeight {
+			return 16
+		}
+
+		return 44
+	}
+
+	return scaleNormal
+}
+
+// Does each side have a single bishop, on opposite colours, with the same
+// other pieces?
+func isOppositeBishops(pieces [2][8]uint64) bool {
+	white := pieces[0][Bishop]
+	black := pieces[1][Bishop]
+
+	if bits.OnesCount64(white) != 1 || bits.OnesCount64(black) != 1 {
+		return false
+	}
+
+	if (white&lightSquares != 0) == (black&lightSquares != 0) {
+		return false
+	}
+
+	for _, p := range []piece{Knight, Rook, Queen} {
+		if bits.OnesCount64(pieces[0][p]) != bits.OnesCount64(pieces[1][p]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Does the stronger side have only bishops and pawns on a single rook file,
+// where the bishops don't control the promotion square and the defending king
+// is next to it?
+func isWrongRookPawn(pieces [2][8]uint64, kings [2]int, strong int) bool {
+	own := pieces[strong]
+	pawns := own[Pawn]
+
+	if own[Bishop] == 0 || own[Knight]|own[Rook]|own[Queen] != 0 || pawns == 0 {
+		return false
+	}
+
+	var file int
+	if pawns&^fileMasks[0] == 0 {
+		file = 0
+	} else if pawns&^fileMasks[7] == 0 {
+		file = 7
+	} else {
+		return false
+	}
+
+	promotion := 56 + file
+	if strong == 1 {
+		promotion = file
+	}
+
+	promotionMask := uint64(1) << uint(promotion)
+	if promotionMask&lightSquares != 0 && own[Bishop]&lightSquares != 0 {
+		return false
+	}
+
+	if promotionMask&darkSquares != 0 && own[Bishop]&darkSquares != 0 {
+		return false
+	}
+
+	return squareDistance(kings[1-strong], promotion) <= 1
+}
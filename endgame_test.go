@@ -0,0 +1,72 @@
+package main
+
+import "testing"
+
+func TestEndgameEvaluators(t *testing.T) {
+	var tests = []struct {
+		name    string
+		endgame string
+		better  string
+		worse   string
+	}{
+		{"Lone king to the edge", "KXK", "8/8/8/8/8/2K5/R7/4k3 w - - 0 1", "8/8/8/4k3/8/2K5/8/R7 w - - 0 1"},
+		{"Lone king to the right corner", "KBNK", "k7/8/2K5/8/8/8/8/3BN3 w - - 0 1", "7k/8/5K2/8/8/8/8/3BN3 w - - 0 1"},
+		{"Unstoppable pawn", "KPK", "8/8/1P6/8/8/8/8/K5k1 w - - 0 1", "8/1k6/1P6/8/8/8/8/K7 w - - 0 1"},
+		{"Rook against a pawn", "KRKP", "8/8/8/8/8/4k3/3p4/3K3R w - - 0 1", "K7/8/8/8/8/8/3pk3/7R w - - 0 1"},
+		{"Queen against rook", "KQKR", "8/8/8/8/8/2K5/Q7/r3k3 w - - 0 1", "8/8/8/3k4/2r5/2K5/Q7/8 w - - 0 1"},
+	}
+
+	for _, test := range tests {
+		for _, fen := range []string{test.better, test.worse, mirrorFEN(test.better)} {
+			if trace := traceEvaluation(mustFromFEN(fen)); trace.endgame != test.endgame {
+				t.Errorf("Endgame test failed (%v)!\nFEN: %v\nExpected endgame: %v\nGot: %v\n", test.name, fen, test.endgame, trace.endgame)
+			}
+		}
+
+		better := evaluate(mustFromFEN(test.better))
+		worse := evaluate(mustFromFEN(test.worse))
+
+		if better <= worse {
+			t.Errorf("Endgame test failed (%v)!\nBetter: %v (%v)\nWorse: %v (%v)\n", test.name, test.better, better, test.worse, worse)
+		}
+
+		// Swapping the colours of every piece gives the same score for the
+		// other side.
+		mirrored := mustParseFEN(mirrorFEN(test.better))
+		mirrored.toMove ^= Black
+
+		if evaluate(mirrored) != better {
+			t.Errorf("Endgame symmetry test failed (%v)!\nFEN: %v\nExpected: %v\nGot: %v\n", test.name, toFEN(mirrored), better, evaluate(mirrored))
+		}
+	}
+
+	for _, fen := range []string{"8/8/8/4k3/8/8/8/2NNK3 w - - 0 1", "8/8/8/4k3/8/8/8/3NK3 w - - 0 1"} {
+		if score := evaluate(mustFromFEN(fen)); score != 0 {
+			t.Errorf("Drawn endgame test failed!\nFEN: %v\nExpected: 0\nGot: %v\n", fen, score)
+		}
+	}
+}
+
+func TestEndgameScale(t *testing.T) {
+	var tests = []struct {
+		name  string
+		fen   string
+		scale int
+	}{
+		{"Opposite bishops", "8/3b1k2/8/4p3/2P1P3/4B3/4K3/8 w - - 0 1", 16},
+		{"Opposite bishops with rooks", "r7/3b1k2/8/4p3/2P1P3/4B3/4K3/R7 w - - 0 1", 44},
+		{"Same coloured bishops", "8/2b2k2/8/4p3/2P1P3/4B3/4K3/8 w - - 0 1", scaleNormal},
+		{"Wrong rook pawn", "k7/8/P7/8/8/8/3B4/6K1 w - - 0 1", scaleDraw},
+		{"Right rook pawn", "k7/8/P7/8/8/8/2B5/6K1 w - - 0 1", scaleNormal},
+		{"Rook against bishop", "8/8/4k3/8/3b4/8/3RK3/8 w - - 0 1", 4},
+		{"Rook and bishop against rook", "8/8/4k3/3r4/8/8/3RKB2/8 w - - 0 1", 14},
+	}
+
+	for _, test := range tests {
+		for _, fen := range []string{test.fen, mirrorFEN(test.fen)} {
+			if trace := traceEvaluation(mustFromFEN(fen)); trace.scale != test.scale {
+				t.Errorf("Endgame scale test failed (%v)!\nFEN: %v\nExpected: %v\nGot: %v\n", test.name, fen, test.scale, trace.scale)
+			}
+		}
+	}
+}
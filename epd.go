@@ -0,0 +1,371 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+Extended Position Description (EPD) is the format of most test suites. Each
+line holds a position, given by the first four fields of its FEN, followed by
+any number of operations, each ending with a semicolon:
+
+	r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - bm Bb5; id "Ruy";
+
+An operation is an opcode followed by its operands, which are strings in quotes,
+numbers or moves in SAN. The operations understood are:
+
+	bm, am:       the best moves, and the moves to avoid
+	id:           the name of the position
+	c0 to c9:     comments
+	D1 to D6:     the number of perft nodes at a depth
+	ce:           the evaluation of the position, in centipawns, for the side to
+	              move
+	pv:           the principal variation
+	hmvc, fmvn:   the halfmove clock and fullmove number, which aren't part of
+	              the four fields
+
+Any others are kept as they are, so that records can be written back out. Many
+files give the clocks after the four fields, as in a FEN, which is also
+accepted.
+*/
+type epdRecord struct {
+	position       position
+	bestMoves      []move
+	avoidMoves     []move
+	id             string
+	comments       [10]string
+	perft          map[int]uint64
+	centipawns     int
+	hasCentipawns  bool
+	pv             []move
+	otherOperation []epdOperation
+}
+
+type epdOperation struct {
+	opcode   string
+	operands []string
+}
+
+const epdMaxPerftDepth = 6
+
+// Parse a line of EPD.
+func parseEPD(line string) (epdRecord, error) {
+	record := epdRecord{perft: make(map[int]uint64)}
+
+	fields, rest := splitEPDFields(line, 4)
+	if len(fields) < 4 {
+		return epdRecord{}, errors.New("expected four fields for the position")
+	}
+
+	// Accept the clocks of a full FEN after the fields.
+	clocks := []string{"0", "1"}
+	if counters, after := splitEPDFields(rest, 2); len(counters) == 2 && isEPDNumber(counters[0]) && isEPDNumber(counters[1]) {
+		clocks = counters
+		rest = after
+	}
+
+	position, err := fromFEN(strings.Join(append(fields, clocks...), " "))
+	if err != nil {
+		return epdRecord{}, err
+	}
+
+	record.position = position
+
+	operations, err := parseEPDOperations(rest)
+	if err != nil {
+		return epdRecord{}, err
+	}
+
+	for _, operation := range operations {
+		if err := record.addOperation(operation); err != nil {
+			return epdRecord{}, fmt.Errorf("%v operation: %v", operation.opcode, err)
+		}
+	}
+
+	return record, nil
+}
+
+// Store the value of an operation in a record.
+func (record *epdRecord) addOperation(operation epdOperation) error {
+	opcode := operation.opcode
+	operands := operation.operands
+
+	switch {
+	case opcode == "bm" || opcode == "am":
+		var moves []move
+
+		for _, operand := range operands {
+			move, err := parseSAN(record.position, operand)
+			if err != nil {
+				return err
+			}
+
+			moves = append(moves, move)
+		}
+
+		if opcode == "bm" {
+			record.bestMoves = moves
+		} else {
+			record.avoidMoves = moves
+		}
+	case opcode == "pv":
+		position := record.position
+
+		for _, operand := range operands {
+			move, err := parseSAN(position, operand)
+			if err != nil {
+				return err
+			}
+
+			record.pv = append(record.pv, move)
+			makeMove(&position, move)
+		}
+	case opcode == "id":
+		record.id = unquoteEPD(operands)
+	case len(opcode) == 2 && opcode[0] == 'c' && opcode[1] >= '0' && opcode[1] <= '9':
+		record.comments[opcode[1]-'0'] = unquoteEPD(operands)
+	case len(opcode) == 2 && opcode[0] == 'D' && opcode[1] >= '1' && opcode[1] <= '0'+epdMaxPerftDepth:
+		if len(operands) != 1 {
+			return errors.New("expected a node count")
+		}
+
+		nodes, err := strconv.ParseUint(operands[0], 10, 64)
+		if err != nil {
+			return err
+		}
+
+		record.perft[int(opcode[1]-'0')] = nodes
+	case opcode == "ce":
+		if len(operands) != 1 {
+			return errors.New("expected an evaluation")
+		}
+
+		centipawns, err := strconv.Atoi(operands[0])
+		if err != nil {
+			return err
+		}
+
+		record.centipawns = centipawns
+		record.hasCentipawns = true
+	case opcode == "hmvc" || opcode == "fmvn":
+		if len(operands) != 1 || !isEPDNumber(operands[0]) {
+			return errors.New("expected a number")
+		}
+
+		value, _ := strconv.Atoi(operands[0])
+		if opcode == "hmvc" {
+			record.position.halfmove = byte(value)
+		} else {
+			record.position.fullmove = value
+		}
+	default:
+		record.otherOperation = append(record.otherOperation, operation)
+	}
+
+	return nil
+}
+
+// Split the first count whitespace separated fields from a string, returning
+// them and the rest of the string.
+func splitEPDFields(text string, count int) ([]string, string) {
+	var fields []string
+
+	for len(fields) < count {
+		text = strings.TrimLeft(text, " \t")
+		if text == "" {
+			break
+		}
+
+		end := strings.IndexAny(text, " \t")
+		if end < 0 {
+			end = len(text)
+		}
+
+		fields = append(fields, text[:end])
+		text = text[end:]
+	}
+
+	return fields, text
+}
+
+// Is a field a non-negative whole number?
+func isEPDNumber(field string) bool {
+	_, err := strconv.ParseUint(field, 10, 32)
+	return err == nil
+}
+
+// Split the operations of a line, each of which ends with a semicolon. Strings
+// in quotes may hold spaces and semicolons, and are kept in their quotes. The
+// semicolon after the last operation can be left out.
+func parseEPDOperations(text string) ([]epdOperation, error) {
+	var operations []epdOperation
+	var tokens []string
+
+	for i := 0; i < len(text); i++ {
+		switch char := text[i]; {
+		case char == ' ' || char == '\t':
+			continue
+		case char == ';':
+			if len(tokens) > 0 {
+				operations = append(operations, epdOperation{tokens[0], tokens[1:]})
+			}
+
+			tokens = nil
+		case char == '"':
+			end := strings.IndexByte(text[i+1:], '"')
+			if end < 0 {
+				return nil, errors.New("unterminated string")
+			}
+
+			if len(tokens) == 0 {
+				return nil, errors.New("string without an opcode")
+			}
+
+			tokens = append(tokens, text[i:i+end+2])
+			i += end + 1
+		default:
+			end := strings.IndexAny(text[i:], " \t;\"")
+			if end < 0 {
+				end = len(text) - i
+			}
+
+			tokens = append(tokens, text[i:i+end])
+			i += end - 1
+		}
+	}
+
+	if len(tokens) > 0 {
+		operations = append(operations, epdOperation{tokens[0], tokens[1:]})
+	}
+
+	return operations, nil
+}
+
+// Join the operands of a string operation, removing their quotes.
+func unquoteEPD(operands []string) string {
+	var text []string
+
+	for _, operand := range operands {
+		text = append(text, strings.Trim(operand, "\""))
+	}
+
+	return strings.Join(text, " ")
+}
+
+// Convert a record to a line of EPD. Moves are written in SAN, and strings are
+// quoted.
+func toEPD(record epdRecord) string {
+	fields := strings.Fields(toFEN(record.position))[:4]
+	line := strings.Join(fields, " ")
+
+	var operations []epdOperation
+
+	addMoves := func(opcode string, moves []move) {
+		if len(moves) == 0 {
+			return
+		}
+
+		var sans []string
+		for _, move := range moves {
+			sans = append(sans, toSAN(record.position, move))
+		}
+
+		operations = append(operations, epdOperation{opcode, sans})
+	}
+
+	addMoves("bm", record.bestMoves)
+	addMoves("am", record.avoidMoves)
+
+	if record.hasCentipawns {
+		operations = append(operations, epdOperation{"ce", []string{strconv.Itoa(record.centipawns)}})
+	}
+
+	if len(record.pv) > 0 {
+		var sans []string
+
+		position := record.position
+		for _, move := range record.pv {
+			sans = append(sans, toSAN(position, move))
+			makeMove(&position, move)
+		}
+
+		operations = append(operations, epdOperation{"pv", sans})
+	}
+
+	var depths []int
+	for depth := range record.perft {
+		depths = append(depths, depth)
+	}
+	sort.Ints(depths)
+
+	for _, depth := range depths {
+		operations = append(operations, epdOperation{fmt.Sprintf("D%v", depth), []string{strconv.FormatUint(record.perft[depth], 10)}})
+	}
+
+	if record.position.halfmove != 0 {
+		operations = append(operations, epdOperation{"hmvc", []string{strconv.Itoa(int(record.position.halfmove))}})
+	}
+
+	if record.position.fullmove != 1 {
+		operations = append(operations, epdOperation{"fmvn", []string{strconv.Itoa(record.position.fullmove)}})
+	}
+
+	if record.id != "" {
+		operations = append(operations, epdOperation{"id", []string{quoteEPD(record.id)}})
+	}
+
+	for i, comment := range record.comments {
+		if comment != "" {
+			operations = append(operations, epdOperation{fmt.Sprintf("c%v", i), []string{quoteEPD(comment)}})
+		}
+	}
+
+	operations = append(operations, record.otherOperation...)
+
+	for _, operation := range operations {
+		line += " " + strings.Join(append([]string{operation.opcode}, operation.operands...), " ") + ";"
+	}
+
+	return line
+}
+
+// Quote a string operand.
+func quoteEPD(operand string) string {
+	return "\"" + strings.Replace(operand, "\"", "'", -1) + "\""
+}
+
+// Read every record of an EPD file. Blank lines, and lines starting with #, are
+// skipped.
+func loadEPD(path string) ([]epdRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []epdRecord
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		record, err := parseEPD(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseEPD(t *testing.T) {
+	line := `r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - bm Bb5 Bc4; am Ng5; id "Ruy; or Italian"; c0 "a  comment"; ce +35; pv Bb5 a6 Ba4; D1 27; D2 733; foo bar "baz";`
+
+	record, err := parseEPD(line)
+	if err != nil {
+		t.Fatalf("Parsing EPD failed!\n%v\n", err)
+	}
+
+	position := record.position
+	if toFEN(position) != "r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 0 1" {
+		t.Errorf("Parsing EPD failed!\nWrong position %v\n", toFEN(position))
+	}
+
+	if len(record.bestMoves) != 2 || toSAN(position, record.bestMoves[0]) != "Bb5" || toSAN(position, record.bestMoves[1]) != "Bc4" {
+		t.Errorf("Parsing EPD failed!\nWrong best moves\n")
+	}
+
+	if len(record.avoidMoves) != 1 || toSAN(position, record.avoidMoves[0]) != "Ng5" {
+		t.Errorf("Parsing EPD failed!\nWrong moves to avoid\n")
+	}
+
+	if record.id != "Ruy; or Italian" || record.comments[0] != "a  comment" || !record.hasCentipawns || record.centipawns != 35 {
+		t.Errorf("Parsing EPD failed!\nWrong operations: %+v\n", record)
+	}
+
+	if len(record.pv) != 3 || record.perft[1] != 27 || record.perft[2] != 733 {
+		t.Errorf("Parsing EPD failed!\nWrong pv or perft counts\n")
+	}
+
+	if len(record.otherOperation) != 1 || record.otherOperation[0].opcode != "foo" || len(record.otherOperation[0].operands) != 2 {
+		t.Errorf("Parsing EPD failed!\nWrong unknown operations: %+v\n", record.otherOperation)
+	}
+
+	expected := `r1bqkbnr/pppp1ppp/2n5/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - bm Bb5 Bc4; am Ng5; ce 35; pv Bb5 a6 Ba4; D1 27; D2 733; id "Ruy; or Italian"; c0 "a  comment"; foo bar "baz";`
+	if written := toEPD(record); written != expected {
+		t.Errorf("Writing EPD failed!\nExpected: %v\nGot: %v\n", expected, written)
+	}
+
+	// Clocks may be given as operations, or as in a FEN.
+	for _, line := range []string{"8/8/8/4k3/8/8/8/4K3 b - - hmvc 12; fmvn 40;", "8/8/8/4k3/8/8/8/4K3 b - - 12 40 id \"clocks\";"} {
+		record, err := parseEPD(line)
+
+		if err != nil || record.position.halfmove != 12 || record.position.fullmove != 40 {
+			t.Errorf("Parsing EPD failed!\nLine: %v\nWrong clocks: %v (%v)\n", line, toFEN(record.position), err)
+		}
+	}
+
+	for _, line := range []string{"8/8/8/4k3/8/8/8/4K3 w -", "8/8/8/4k3/8/8/8/4K3 w - - bm Kd5;", "8/8/8/4k3/8/8/8/4K3 w - - id \"open;", "8/8/8/4k3/8/8/8/4K3 w - - D1 many;"} {
+		if _, err := parseEPD(line); err == nil {
+			t.Errorf("Parsing EPD failed!\nAccepted %v\n", line)
+		}
+	}
+}
+
+// A few perft positions in EPD, as used by the perft command.
+const testPerftEPD = `# The start position and Kiwipete
+rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - ;D1 20 ;D2 400 ;D3 8902
+r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - ;D1 48 ;D2 2039 ;D3 97862
+
+8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - ;D1 14 ;D2 191 ;D3 2812 ;D4 43238
+`
+
+func TestPerftEPD(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "perft.epd")
+	if err := os.WriteFile(path, []byte(testPerftEPD), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := loadEPD(path)
+	if err != nil || len(records) != 3 {
+		t.Fatalf("Perft EPD test failed!\nExpected 3 records, got %v (%v)\n", len(records), err)
+	}
+
+	for _, record := range records {
+		if err := checkPerftRecord(record, epdMaxPerftDepth); err != nil {
+			t.Errorf("Perft EPD test failed!\n%v\n", err)
+		}
+	}
+
+	records[0].perft[2] = 401
+	if err := checkPerftRecord(records[0], 1); err != nil {
+		t.Errorf("Perft EPD test failed!\nChecked beyond the maximum depth\n")
+	}
+
+	if err := checkPerftRecord(records[0], 2); err == nil {
+		t.Errorf("Perft EPD test failed!\nAccepted a wrong node count\n")
+	}
+}
+
+func TestSolveSuiteRecord(t *testing.T) {
+	var tests = []struct {
+		line   string
+		solved bool
+	}{
+		{`6k1/5ppp/8/8/8/8/8/R3K3 w - - bm Ra8#; id "mate in one";`, true},
+		{`6k1/5ppp/8/8/8/8/8/R3K3 w - - am Ra8#;`, false},
+		{`6k1/5ppp/8/8/8/8/8/R3K3 w - - bm Ra7;`, false},
+	}
+
+	for _, test := range tests {
+		record, err := parseEPD(test.line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, solved := solveSuiteRecord(record, 2000); solved != test.solved {
+			t.Errorf("Suite test failed!\nLine: %v\nExpected solved: %v\n", test.line, test.solved)
+		}
+	}
+}
@@ -1,83 +1,72 @@
 package main
 
 /*
-These constants specify the value, in centipawns, of each piece when evaluating a position.
-
-A piece's value is a combination of its base weight and a modifier based on its position on the board. This reflects more subtle information about a position. For example, a knight in the centre of the board is more effective than one on the side, so it recieves a bonus.
+Each non-pawn piece contributes to the game phase, which runs from totalPhase
+with all pieces on the board down to 0 with only kings and pawns left. Terms with
+separate middlegame and endgame values are blended according to the phase.
+*/
+const knightPhase = 1
+const bishopPhase = 1
+const rookPhase = 2
+const queenPhase = 4
+const totalPhase = 24
 
-The values and piece tables used are from Tomasz Michniewski and can be found at https://chessprogramming.wikispaces.com/Simplified+evaluation+function.
+/*
+A score holds the middlegame and endgame values of an evaluation term. Terms are
+calculated for each side separately, as a [2]score indexed by side, where each
+side's score is from its own perspective.
 */
-const kingWeight = 10000
-const queenWeight = 900
-const rookWeight = 500
-const bishopWeight = 300
-const knightWeight = 300
-const pawnWeight = 100
-
-var pawnPositions = []int{
-	0, 0, 0, 0, 0, 0, 0, 0,
-	50, 50, 50, 50, 50, 50, 50, 50,
-	10, 10, 20, 30, 30, 20, 10, 10,
-	5, 5, 10, 25, 25, 10, 5, 5,
-	0, 0, 0, 20, 20, 0, 0, 0,
-	5, -5, -10, 0, 0, -10, -5, 5,
-	5, 10, 10, -20, -20, 10, 10, 5,
-	0, 0, 0, 0, 0, 0, 0, 0,
+type score struct {
+	mg int
+	eg int
 }
 
-var knightPositions = []int{
-	-50, -40, -30, -30, -30, -30, -40, -50,
-	-40, -20, 0, 0, 0, 0, -20, -40,
-	-30, 0, 10, 15, 15, 10, 0, -30,
-	-30, 5, 15, 20, 20, 15, 5, -30,
-	-30, 0, 15, 20, 20, 15, 0, -30,
-	-30, 5, 10, 15, 15, 10, 5, -30,
-	-40, -20, 0, 5, 5, 0, -20, -40,
-	-50, -40, -30, -30, -30, -30, -40, -50,
+// Add another score to this one.
+func (s *score) add(other score) {
+	s.mg += other.mg
+	s.eg += other.eg
 }
 
-var bishopPositions = []int{
-	-20, -10, -10, -10, -10, -10, -10, -20,
-	-10, 0, 0, 0, 0, 0, 0, -10,
-	-10, 0, 5, 10, 10, 5, 0, -10,
-	-10, 5, 5, 10, 10, 5, 5, -10,
-	-10, 0, 10, 10, 10, 10, 0, -10,
-	-10, 10, 10, 10, 10, 10, 10, -10,
-	-10, 5, 0, 0, 0, 0, 5, -10,
-	-20, -10, -10, -10, -10, -10, -10, -20,
+// Subtract another score from this one.
+func (s *score) subtract(other score) {
+	s.mg -= other.mg
+	s.eg -= other.eg
 }
 
-var rookPositions = []int{
-	0, 0, 0, 0, 0, 0, 0, 0,
-	5, 10, 10, 10, 10, 10, 10, 5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	-5, 0, 0, 0, 0, 0, 0, -5,
-	0, 0, 0, 5, 5, 0, 0, 0,
-}
+// The terms making up an evaluation, used to index evalTrace.terms, and the
+// names they are reported under.
+const materialTerm = 0
+const pieceSquareTerm = 1
+const pawnsTerm = 2
+const kingSafetyTerm = 3
+const mobilityTerm = 4
+const piecesTerm = 5
+const threatsTerm = 6
+const termCount = 7
 
-var queenPositions = []int{
-	-20, -10, -10, -5, -5, -10, -10, -20,
-	-10, 0, 0, 0, 0, 0, 0, -10,
-	-10, 0, 5, 5, 5, 5, 0, -10,
-	-5, 0, 5, 5, 5, 5, 0, -5,
-	0, 0, 5, 5, 5, 5, 0, -5,
-	-10, 5, 5, 5, 5, 5, 0, -10,
-	-10, 0, 5, 0, 0, 0, 0, -10,
-	-20, -10, -10, -5, -5, -10, -10, -20,
-}
+var termNames = [termCount]string{"Material", "Piece-square", "Pawns", "King safety", "Mobility", "Pieces", "Threats"}
 
-var kingPositions = []int{
-	-30, -40, -40, -50, -50, -40, -40, -30,
-	-30, -40, -40, -50, -50, -40, -40, -30,
-	-30, -40, -40, -50, -50, -40, -40, -30,
-	-30, -40, -40, -50, -50, -40, -40, -30,
-	-20, -30, -30, -40, -40, -30, -30, -20,
-	-10, -20, -20, -20, -20, -20, -20, -10,
-	20, 20, 0, 0, 0, 0, 20, 20,
-	20, 30, 10, 0, 0, 10, 30, 20,
+/*
+evalTrace records how an evaluation was reached.
+
+terms holds the score of each side for each term. mg and eg are the sums of
+every term from white's perspective, and phase is the game phase used to blend
+them into white, the score from white's perspective, after the endgame score is
+multiplied by scale (out of scaleNormal). final is the score from the
+perspective of the side to move, which is what evaluate returns.
+
+If the position is an endgame with a specialised evaluator, endgame is its name,
+and white is the evaluator's score instead.
+*/
+type evalTrace struct {
+	terms   [termCount][2]score
+	mg      int
+	eg      int
+	phase   int
+	scale   int
+	endgame string
+	white   int
+	final   int
 }
 
 /*
@@ -89,9 +78,26 @@ instead perform strongly, the score would decrease.
 Since the move search function uses the Negamax algorithm, this evaluation is
 symmetrical. A position for black is the same as the identical one for white,
 but negated.
+
+The score is taken from a full trace of the evaluation, so that the trace can
+never disagree with it, unless the neural network evaluation is in use.
 */
 func evaluate(position position) int {
-	var score int
+	if useNNUE && canEvaluateNNUE(position) {
+		return evaluateNNUE(position)
+	}
+
+	return traceEvaluation(position).final
+}
+
+// Evaluate the position, recording the score of each term for each side.
+func traceEvaluation(position position) evalTrace {
+	var trace evalTrace
+
+	// The bitboards of each piece type for each side, indexed by piece
+	// identity, for the evaluation terms which look at the whole board.
+	pieces := position.pieces
+	occupied := position.occupied[0] | position.occupied[1]
 
 	var direction int
 	if position.toMove == White {
@@ -100,40 +106,106 @@ func evaluate(position position) int {
 		direction = -1
 	}
 
-	// Loop through the board, finding the score for each piece present. If the
-	// piece is white, add it to the total; if black, subtract it.
-	for i := 0; i < BoardSize; i++ {
-
-		piece := position.board[i]
-		if isOnBoard(i) && position.board[i].exists() {
-			var increment int
-			if piece.color() == White {
-				increment = 1
-			} else {
-				increment = -1
-			}
-
-			piecemapIndex := map0x88ToPiecemap(i, increment)
-
-			switch piece.identity() {
-			case King:
-				score += (kingWeight + kingPositions[piecemapIndex]) * increment
-			case Queen:
-				score += (queenWeight + queenPositions[piecemapIndex]) * increment
-			case Bishop:
-				score += (bishopWeight + bishopPositions[piecemapIndex]) * increment
-			case Rook:
-				score += (rookWeight + rookPositions[piecemapIndex]) * increment
-			case Knight:
-				score += (knightWeight + knightPositions[piecemapIndex]) * increment
-			case Pawn:
-				score += (pawnWeight + pawnPositions[piecemapIndex]) * increment
-			}
+	// The material and piece-square scores are kept up to date in the position.
+	trace.terms[materialTerm] = position.material
+	trace.terms[pieceSquareTerm] = position.pieceSquare
+
+	pawns := [2]uint64{pieces[0][Pawn], pieces[1][Pawn]}
+	kings := position.kings
+
+	trace.terms[pawnsTerm] = evaluatePawns(position, pawns, kings, occupied)
+	// The attacks of each side are shared by the terms which look at them.
+	attacks := generateAttackMaps(&pieces, occupied)
+
+	trace.terms[kingSafetyTerm] = evaluateKingSafety(pieces, kings, &attacks)
+	trace.terms[mobilityTerm] = evaluateMobility(pieces, &attacks)
+	trace.terms[piecesTerm] = evaluatePieces(pieces, kings, occupied)
+	trace.terms[threatsTerm] = evaluateThreats(&position, &attacks)
+
+	// Sum the terms from white's perspective, then blend the middlegame and
+	// endgame totals.
+	for _, term := range trace.terms {
+		trace.mg += term[0].mg - term[1].mg
+		trace.eg += term[0].eg - term[1].eg
+	}
+
+	phase := position.phase
+	if phase > totalPhase {
+		phase = totalPhase
+	}
+
+	trace.phase = phase
+	trace.scale = scaleNormal
+
+	if endgame, ok := findEndgame(pieces, kings); ok {
+		trace.endgame = endgame.name
+		trace.white = endgame.evaluate(pieces, kings, position.toMove, endgame.strong)
+
+		if endgame.strong == 1 {
+			trace.white = -trace.white
 		}
+	} else {
+		trace.scale = endgameScale(pieces, kings, trace.eg)
+		trace.white = taper(trace.mg, trace.eg*trace.scale/scaleNormal, phase)
+	}
+
+	trace.final = trace.white * direction
+
+	return trace
+}
+
+// Find the material and piece-square scores of a piece on a 0x88 index, which
+// are the same in the middlegame and endgame, and its contribution to the game
+// phase.
+func pieceScores(p piece, index int) (score, score, int) {
+	var direction int
+	if p.color() == White {
+		direction = 1
+	} else {
+		direction = -1
 	}
 
-	return score * direction
+	piecemapIndex := map0x88ToPiecemap(index, direction)
+
+	var material int
+	var pieceSquare int
+	var phase int
+	switch p.identity() {
+	case King:
+		material = evalParams.KingWeight
+		pieceSquare = evalParams.KingPositions[piecemapIndex]
+	case Queen:
+		material = evalParams.QueenWeight
+		pieceSquare = evalParams.QueenPositions[piecemapIndex]
+		phase = queenPhase
+	case Bishop:
+		material = evalParams.BishopWeight
+		pieceSquare = evalParams.BishopPositions[piecemapIndex]
+		phase = bishopPhase
+	case Rook:
+		material = evalParams.RookWeight
+		pieceSquare = evalParams.RookPositions[piecemapIndex]
+		phase = rookPhase
+	case Knight:
+		material = evalParams.KnightWeight
+		pieceSquare = evalParams.KnightPositions[piecemapIndex]
+		phase = knightPhase
+	case Pawn:
+		material = evalParams.PawnWeight
+		pieceSquare = evalParams.PawnPositions[piecemapIndex]
+	}
+
+	return score{material, material}, score{pieceSquare, pieceSquare}, phase
+}
+
+// Blend a middlegame and endgame score according to the game phase. The phase
+// is capped, since promotions can take it above its starting value.
+func taper(mg int, eg int, phase int) int {
+	if phase > totalPhase {
+		phase = totalPhase
+	}
 
+	return (mg*phase + eg*(totalPhase-phase)) / totalPhase
 }
 
 // Map a 0x88 index to the required position in the score piecemaps. The
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode"
 )
 
 // Used to extract the piece identity information.
@@ -26,86 +28,353 @@ var fenCodes = map[byte]piece{
 	'P': 1,
 }
 
-func fromFEN(fen string) position {
-	// The FEN for the starting position looks like this:
-	// 	rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1
+/*
+Given a string in Forsyth–Edwards Notation (FEN), convert it to the internal
+position object. The FEN for the starting position looks like this:
+
+	rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1
+
+The halfmove clock and fullmove number at the end can be left out, in which case
+they are 0 and 1. For Chess960, the castling rights can also be given as the
+files of the rooks, as in Shredder-FEN (HAha) or X-FEN, where KQkq mean the
+outermost rook on each side of the king, and a file is only used for a rook
+inside another. The position must be legal: each side has one king, there are
+no pawns on the first or last rank, the side which has just moved isn't in
+check, and the castling rights and en passant target are possible. Otherwise,
+an error describes what is wrong.
+*/
+func fromFEN(fen string) (position, error) {
+	parsed, err := parseFEN(fen)
+	if err != nil {
+		return parsed, err
+	}
+
+	if err := validatePosition(parsed); err != nil {
+		return position{}, err
+	}
+
+	return parsed, nil
+}
+
+// Convert a FEN string to a position, panicking if it isn't valid. This is for
+// FENs known in advance, such as the starting position.
+func mustFromFEN(fen string) position {
+	position, err := fromFEN(fen)
+	if err != nil {
+		panic(fmt.Sprintf("invalid FEN %q: %v", fen, err))
+	}
+
+	return position
+}
 
-	// Split it on spaces
-	sections := strings.Split(fen, " ")
+// Convert a FEN string to a position, checking its syntax but not whether the
+// position is legal.
+func parseFEN(fen string) (position, error) {
+	sections := strings.Fields(fen)
+
+	if len(sections) < 4 || len(sections) > 6 {
+		return position{}, fmt.Errorf("expected 4 to 6 fields, got %v", len(sections))
+	}
 
 	boardString := sections[0]     // rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR
 	playerString := sections[1]    // w
 	castleString := sections[2]    // KQkq
 	enPassantString := sections[3] // -
-	halfmoveString := sections[4]  // 0
-	fullmoveString := sections[5]  // 1
-
-	// We need to convert the board string into a piece array. Due to the way
-	// FEN is structured, the first piece is at a8, which translates to 0x88
-	// index 112.
-	var startBoard [128]piece
-	boardIndex := 112
-
-	// Loop through the board string.
-	for _, char := range boardString {
-		// Skip the slashes which seperate ranks
-		if char == '/' {
-			continue
-		}
+	halfmoveString := "0"
+	fullmoveString := "1"
 
-		// Numbers in the board string indicate empty spaces, so we advance the
-		// board index by that number of spaces since there aren't any pieces in
-		// those positions.
-		if char >= '1' && char <= '8' {
-			boardIndex += int(char - '0')
-		} else {
-			// Otherwise, look up the correct piece code and insert it.
-			startBoard[boardIndex] = fenCodes[byte(char)]
-			boardIndex++
-		}
+	if len(sections) > 4 {
+		halfmoveString = sections[4]
+	}
 
-		// Skip squares that aren't on the board
-		if boardIndex%16 > 7 {
-			boardIndex = ((boardIndex / 16) - 1) * 16
-		}
+	if len(sections) > 5 {
+		fullmoveString = sections[5]
+	}
+
+	startBoard, err := parseFENBoard(boardString)
+	if err != nil {
+		return position{}, err
 	}
 
 	// Convert the player string to a colour
 	var toMove byte
-	if playerString == "w" {
+	switch playerString {
+	case "w":
 		toMove = White
-	} else {
+	case "b":
 		toMove = Black
+	default:
+		return position{}, fmt.Errorf("invalid side to move %q", playerString)
 	}
 
-	// Convert the castling string to a castle byte
-	var castling byte
-	castling = setCastle(castling, KingCastle, White, strings.Contains(castleString, "K"))
-	castling = setCastle(castling, QueenCastle, White, strings.Contains(castleString, "Q"))
-	castling = setCastle(castling, KingCastle, Black, strings.Contains(castleString, "k"))
-	castling = setCastle(castling, QueenCastle, Black, strings.Contains(castleString, "q"))
-
 	// Convert the en passant target string to the index it represents.
-	var enPassantTarget byte
+	enPassantTarget := byte(NoEnPassant)
 
-	if enPassantString == "-" {
-		enPassantTarget = NoEnPassant
-	} else {
-		fileLetter := enPassantString[0]
-		rankNumber := int(enPassantString[1] - '0')
+	if enPassantString != "-" {
+		index, ok := squareToIndex(enPassantString)
+		if !ok {
+			return position{}, fmt.Errorf("invalid en passant target %q", enPassantString)
+		}
 
-		enPassantTarget = byte(((rankNumber - 1) * 16) + int(fileLetter-'a'))
+		enPassantTarget = byte(index)
 	}
 
 	// Convert the half and full move.
-	halfmoveInt, _ := strconv.Atoi(halfmoveString)
-	halfmove := byte(halfmoveInt)
-	fullmove, _ := strconv.Atoi(fullmoveString)
+	halfmoveInt, err := strconv.Atoi(halfmoveString)
+	if err != nil || halfmoveInt < 0 || halfmoveInt > 255 {
+		return position{}, fmt.Errorf("halfmove clock %q is not a number from 0 to 255", halfmoveString)
+	}
+
+	fullmove, err := strconv.Atoi(fullmoveString)
+	if err != nil || fullmove < 1 || fullmove > 10000 {
+		return position{}, fmt.Errorf("fullmove number %q is not a number from 1 to 10000", fullmoveString)
+	}
 
 	// Initialise the full position and return it.
-	startPosition := position{board: startBoard, toMove: toMove, castling: castling, enPassantTarget: enPassantTarget, halfmove: halfmove, fullmove: fullmove}
+	startPosition := position{board: startBoard, toMove: toMove, castlingKings: standardCastlingKings, castlingRooks: standardCastlingRooks, enPassantTarget: enPassantTarget, halfmove: byte(halfmoveInt), fullmove: fullmove}
+
+	// Convert the castling string to a castle byte, and the squares of the
+	// kings and rooks it refers to.
+	if err := parseFENCastling(&startPosition, castleString); err != nil {
+		return position{}, err
+	}
+
+	initialiseIncrementalState(&startPosition)
+
+	return startPosition, nil
+}
+
+// Convert the board section of a FEN into a piece array.
+func parseFENBoard(boardString string) ([128]piece, error) {
+	var board [128]piece
+
+	ranks := strings.Split(boardString, "/")
+	if len(ranks) != 8 {
+		return board, fmt.Errorf("expected 8 ranks, got %v", len(ranks))
+	}
+
+	// Due to the way FEN is structured, the first rank is the eighth, which
+	// starts at 0x88 index 112.
+	for i, rankString := range ranks {
+		rank := 7 - i
+		file := 0
+		previousDigit := false
+
+		for _, char := range rankString {
+			// Numbers in the board string indicate empty spaces, so we advance
+			// the file by that number of spaces since there aren't any pieces
+			// in those positions.
+			if char >= '1' && char <= '8' {
+				if previousDigit {
+					return board, fmt.Errorf("rank %v has two numbers in a row", rank+1)
+				}
+
+				file += int(char - '0')
+				previousDigit = true
+				continue
+			}
+
+			p, ok := fenCodes[byte(char)]
+			if !ok || char > unicode.MaxASCII {
+				return board, fmt.Errorf("unknown piece %q in rank %v", char, rank+1)
+			}
+
+			if file < 8 {
+				board[rank*16+file] = p
+			}
 
-	return startPosition
+			file++
+			previousDigit = false
+		}
+
+		if file != 8 {
+			return board, fmt.Errorf("rank %v has %v squares", rank+1, file)
+		}
+	}
+
+	return board, nil
+}
+
+// The squares of the kings and rooks for castling in standard chess, which are
+// also used for rights which can't be taken.
+var standardCastlingKings = [2]byte{4, 116}
+var standardCastlingRooks = [4]byte{7, 0, 119, 112}
+
+// Convert the castling section of a FEN to a castle byte, setting the squares
+// of the king and rook of each right.
+func parseFENCastling(position *position, castleString string) error {
+	if castleString == "-" {
+		return nil
+	}
+
+	for _, char := range castleString {
+		side, color := KingCastle, byte(White)
+		lower := unicode.ToLower(char)
+
+		if char == lower {
+			color = Black
+		}
+
+		king := findCastlingKing(*position, color)
+		backRank := king - king%16
+		var rook int
+
+		switch {
+		case lower == 'k':
+			rook = outermostRook(*position, backRank+7, king, color)
+		case lower == 'q':
+			side = QueenCastle
+			rook = outermostRook(*position, backRank, king, color)
+		case lower >= 'a' && lower <= 'h':
+			rook = backRank + int(lower-'a')
+
+			if rook == king {
+				return fmt.Errorf("invalid castling rights %q", castleString)
+			} else if rook < king {
+				side = QueenCastle
+			}
+		default:
+			return fmt.Errorf("invalid castling rights %q", castleString)
+		}
+
+		if getCastle(position.castling, side, color) {
+			return fmt.Errorf("castling right %c is repeated", char)
+		}
+
+		position.castling = setCastle(position.castling, side, color, true)
+		position.castlingKings[sideIndex(color)] = byte(king)
+		position.castlingRooks[castleOffset(side, color)] = byte(rook)
+	}
+
+	return nil
+}
+
+// Find the squares of the king and rook of each castling right in the castle
+// byte, assuming the rook is the outermost on its side, as in a FEN with KQkq.
+func findCastlingSquares(position *position) {
+	position.castlingKings = standardCastlingKings
+	position.castlingRooks = standardCastlingRooks
+
+	for _, color := range []byte{White, Black} {
+		king := findCastlingKing(*position, color)
+		backRank := king - king%16
+
+		for _, side := range []int{KingCastle, QueenCastle} {
+			if !getCastle(position.castling, side, color) {
+				continue
+			}
+
+			corner := backRank + 7
+			if side == QueenCastle {
+				corner = backRank
+			}
+
+			position.castlingKings[sideIndex(color)] = byte(king)
+			position.castlingRooks[castleOffset(side, color)] = byte(outermostRook(*position, corner, king, color))
+		}
+	}
+}
+
+// Find the square a king castles from, which is its square if it is on its back
+// rank, and otherwise the e file.
+func findCastlingKing(position position, color byte) int {
+	backRank := 0
+	if color == Black {
+		backRank = 112
+	}
+
+	for i := backRank; i < backRank+8; i++ {
+		if position.board[i] == King|piece(color) {
+			return i
+		}
+	}
+
+	return backRank + 4
+}
+
+// Find the rook of a colour furthest from the king, searching from the corner
+// towards it. If there isn't one, the corner is returned.
+func outermostRook(position position, corner int, king int, color byte) int {
+	direction := 1
+	if corner > king {
+		direction = -1
+	}
+
+	for i := corner; i != king; i += direction {
+		if position.board[i] == Rook|piece(color) {
+			return i
+		}
+	}
+
+	return corner
+}
+
+// Convert a square in algebraic notation, such as e4, to its index.
+func squareToIndex(square string) (int, bool) {
+	if len(square) != 2 || square[0] < 'a' || square[0] > 'h' || square[1] < '1' || square[1] > '8' {
+		return 0, false
+	}
+
+	return int(square[1]-'1')*16 + int(square[0]-'a'), true
+}
+
+// Check that a position read from a FEN is legal.
+func validatePosition(position position) error {
+	var kings [2]int
+
+	for i := 0; i < BoardSize; i++ {
+		p := position.board[i]
+
+		if !isOnBoard(i) || !p.exists() {
+			continue
+		}
+
+		if p.is(King) {
+			kings[sideIndex(p.color())]++
+		}
+
+		if p.is(Pawn) && (i/16 == 0 || i/16 == 7) {
+			return fmt.Errorf("pawn on %v", indexToSquare(byte(i)))
+		}
+	}
+
+	for side, name := range []string{"white", "black"} {
+		if kings[side] != 1 {
+			return fmt.Errorf("%v has %v kings", name, kings[side])
+		}
+	}
+
+	if isKingInCheck(position, position.toMove) {
+		return errors.New("the side not to move is in check")
+	}
+
+	for _, color := range []byte{White, Black} {
+		for _, side := range []int{KingCastle, QueenCastle} {
+			kingOrigin, rookOrigin, _, _ := castlingSquares(position, side, color)
+
+			if getCastle(position.castling, side, color) && (position.board[kingOrigin] != King|piece(color) || position.board[rookOrigin] != Rook|piece(color)) {
+				return fmt.Errorf("impossible castling rights %v", castleString(position))
+			}
+		}
+	}
+
+	if position.enPassantTarget != NoEnPassant {
+		// The pawn which has just moved two squares must be in front of the
+		// target, with the target and the square behind it empty.
+		target := int(position.enPassantTarget)
+		rank, direction := 5, -16
+		if position.toMove == Black {
+			rank, direction = 2, 16
+		}
+
+		opponent := opposingColor(position.toMove)
+
+		if target/16 != rank || position.board[target+direction] != Pawn|piece(opponent) || position.board[target].exists() || position.board[target-direction].exists() {
+			return fmt.Errorf("impossible en passant target %v", enPassantString(position))
+		}
+	}
+
+	return nil
 }
 
 // Given an internal position object, convert it to a string in Forsyth–Edwards
@@ -220,24 +489,36 @@ func toMoveString(move move) string {
 	return "Invalid"
 }
 
-// Given a string in Forsyth–Edwards Notation (FEN), convert it to the internal
-// position object.
-
-// Generate a string representing castling rights from a position.
+// Generate a string representing castling rights from a position. These are
+// written as in X-FEN, which is the same as standard FEN unless a rook inside
+// another can castle in Chess960.
 func castleString(position position) string {
 	var castling string
 
-	if getCastle(position.castling, KingCastle, White) {
-		castling += "K"
-	}
-	if getCastle(position.castling, QueenCastle, White) {
-		castling += "Q"
-	}
-	if getCastle(position.castling, KingCastle, Black) {
-		castling += "k"
-	}
-	if getCastle(position.castling, QueenCastle, Black) {
-		castling += "q"
+	for _, color := range []byte{White, Black} {
+		for _, side := range []int{KingCastle, QueenCastle} {
+			if !getCastle(position.castling, side, color) {
+				continue
+			}
+
+			king, rook, _, _ := castlingSquares(position, side, color)
+			corner := king - king%16 + 7
+			letter := 'k'
+			if side == QueenCastle {
+				corner = king - king%16
+				letter = 'q'
+			}
+
+			if rook != outermostRook(position, corner, king, color) {
+				letter = rune(rook%16 + 'a')
+			}
+
+			if color == White {
+				letter = unicode.ToUpper(letter)
+			}
+
+			castling += string(letter)
+		}
 	}
 
 	if len(castling) == 0 {
@@ -0,0 +1,146 @@
+package main
+
+import "math/bits"
+
+/*
+King safety is measured by counting the attacks of enemy pieces on the king's
+zone: the squares around the king, and the three squares in front of those.
+Each attacked square adds a number of attack units depending on the attacker,
+and the total is converted to a penalty through a table. The table is
+nonlinear, so that a single attacker is nearly harmless, but a coordinated
+attack by several pieces is heavily penalised.
+
+The pawn shield, pawn storm and open file terms look at the king's file and the
+files on either side of it, and only apply to the middlegame.
+*/
+
+// Find the standard 8x8 square of a king, given its bitboard, or -1 if there is
+// no king on the board.
+func kingSquare(king uint64) int {
+	if king == 0 {
+		return -1
+	}
+
+	return bits.TrailingZeros64(king)
+}
+
+/*
+evaluateKingSafety returns the king safety score of each side. pieces holds the
+bitboards of each piece type for each side, indexed by piece identity, kings the
+standard square of each king (or -1 if it is missing), and attacks the attack
+map of each side.
+*/
+func evaluateKingSafety(pieces [2][8]uint64, kings [2]int, attacks *[2]attackMap) [2]score {
+	var scores [2]score
+
+	for _, color := range [2]byte{White, Black} {
+		side := sideIndex(color)
+
+		if kings[side] == -1 {
+			continue
+		}
+
+		mg, eg := evaluateKingAttacks(pieces, &attacks[1-side], kings[side], color)
+		mg += evaluateKingPawns(pieces, kings[side], color)
+
+		scores[side] = score{mg, eg}
+	}
+
+	return scores
+}
+
+// Find the penalty for enemy attacks on the zone around the king of the given
+// colour, given the enemy's attack map.
+func evaluateKingAttacks(pieces [2][8]uint64, enemyAttacks *attackMap, king int, color byte) (int, int) {
+	enemy := sideIndex(opposingColor(color))
+
+	kingMask := uint64(1) << uint(king)
+	zone := kingMask | kingAttacks(kingMask)
+	if color == White {
+		zone |= zone << 8
+	} else {
+		zone |= zone >> 8
+	}
+
+	weights := [8]int{
+		Knight: evalParams.KnightAttackUnits,
+		Bishop: evalParams.BishopAttackUnits,
+		Rook:   evalParams.RookAttackUnits,
+		Queen:  evalParams.QueenAttackUnits,
+	}
+
+	var attackers int
+	var units int
+
+	// Add the attack units for each enemy piece attacking the zone.
+	for _, identity := range [...]piece{Knight, Bishop, Rook, Queen} {
+		for remaining := pieces[enemy][identity]; remaining != 0; remaining &= remaining - 1 {
+			attacked := enemyAttacks.bySquare[bits.TrailingZeros64(remaining)] & zone
+
+			if attacked != 0 {
+				attackers++
+				units += weights[identity] * bits.OnesCount64(attacked)
+			}
+		}
+	}
+
+	if attackers < evalParams.MinimumKingAttackers {
+		return 0, 0
+	}
+
+	if units >= len(evalParams.KingSafetyTable) {
+		units = len(evalParams.KingSafetyTable) - 1
+	}
+
+	penalty := evalParams.KingSafetyTable[units]
+
+	return -penalty, -penalty / evalParams.KingSafetyEndgameDivisor
+}
+
+// Find the middlegame score for the pawn shield, pawn storm and open files
+// around the king of the given colour.
+func evaluateKingPawns(pieces [2][8]uint64, king int, color byte) int {
+	side := sideIndex(color)
+	ownPawns := pieces[side][Pawn]
+	enemyPawns := pieces[1-side][Pawn]
+	kingRank := relativeRank(king, color)
+
+	var score int
+
+	for file := king%8 - 1; file <= king%8+1; file++ {
+		if file < 0 || file > 7 {
+			continue
+		}
+
+		// Only pawns in front of the king shield it, or storm towards it.
+		inFront := forwardFileMasks[side][king-king%8+file]
+
+		if ownPawns&fileMasks[file] == 0 {
+			if enemyPawns&fileMasks[file] == 0 {
+				score += evalParams.KingOpenFileMg
+			} else {
+				score += evalParams.KingSemiOpenFileMg
+			}
+		}
+
+		if shield := ownPawns & inFront; shield != 0 {
+			score += evalParams.KingShieldMg[relativeRank(nearestSquare(shield, color), color)-kingRank]
+		}
+
+		if storm := enemyPawns & inFront; storm != 0 {
+			score += evalParams.KingStormMg[relativeRank(nearestSquare(storm, color), color)-kingRank]
+		}
+	}
+
+	return score
+}
+
+// Find the square in the bitboard which is closest to the back rank of the
+// given colour.
+func nearestSquare(squares uint64, color byte) int {
+	if color == White {
+		return bits.TrailingZeros64(squares)
+	}
+
+	return 63 - bits.LeadingZeros64(squares)
+}
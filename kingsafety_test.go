@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+type kingSafetyTest struct {
+	name  string
+	safer string
+	worse string
+}
+
+func TestKingSafety(t *testing.T) {
+	cases := []kingSafetyTest{
+		{"Pawn shield", "6k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", "6k1/5ppp/8/8/8/5PPP/8/6K1 w - - 0 1"},
+		{"Open file", "6k1/5ppp/8/8/8/8/5PPP/6K1 w - - 0 1", "6k1/5ppp/8/8/8/8/5P1P/6K1 w - - 0 1"},
+		{"Pawn storm", "6k1/8/8/8/8/8/5PPP/6K1 w - - 0 1", "6k1/8/8/8/8/6p1/5P1P/6K1 w - - 0 1"},
+		{"Attacking pieces", "6k1/8/8/8/8/3q4/5PPP/1r4K1 w - - 0 1", "6k1/8/8/8/8/5nq1/5PPP/3r2K1 w - - 0 1"},
+	}
+
+	for _, test := range cases {
+		for _, fen := range []string{test.safer, test.worse} {
+			position := mustFromFEN(fen)
+			pieces, kings, occupied := evaluationBitboards(position)
+			scores := evaluateKingSafety(pieces, kings, evaluationAttacks(pieces, occupied))
+
+			mirrored := mustParseFEN(mirrorFEN(fen))
+			pieces, kings, occupied = evaluationBitboards(mirrored)
+			mirroredScores := evaluateKingSafety(pieces, kings, evaluationAttacks(pieces, occupied))
+
+			if scores[0] != mirroredScores[1] || scores[1] != mirroredScores[0] {
+				t.Errorf("King safety symmetry test failed! (%v)\nFEN: %v\nScores: %v\nMirrored scores: %v\n", test.name, fen, scores, mirroredScores)
+			}
+		}
+
+		pieces, kings, occupied := evaluationBitboards(mustFromFEN(test.safer))
+		saferMg := evaluateKingSafety(pieces, kings, evaluationAttacks(pieces, occupied))[0].mg
+
+		pieces, kings, occupied = evaluationBitboards(mustFromFEN(test.worse))
+		worseMg := evaluateKingSafety(pieces, kings, evaluationAttacks(pieces, occupied))[0].mg
+
+		if saferMg <= worseMg {
+			t.Errorf("King safety test failed! (%v)\nSafer FEN: %v (%v)\nWorse FEN: %v (%v)\n", test.name, test.safer, saferMg, test.worse, worseMg)
+		}
+	}
+}
+
+// Collect the piece bitboards, king squares and occupancy of a position, in the
+// form required by the evaluation functions.
+func evaluationBitboards(position position) ([2][8]uint64, [2]int, uint64) {
+	occupied := position.occupied[0] | position.occupied[1]
+
+	return position.pieces, position.kings, occupied
+}
+
+// Build the attack maps of both sides from the bitboards of a position.
+func evaluationAttacks(pieces [2][8]uint64, occupied uint64) *[2]attackMap {
+	attacks := generateAttackMaps(&pieces, occupied)
+	return &attacks
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"math/bits"
+	"sync"
+)
+
+/*
+The KPK bitbase records whether every position with a king and pawn against a
+king is won for the side with the pawn, or drawn. It is generated by retrograde
+analysis, using the engine's own move generation, the first time it is needed.
+
+Positions are normalised so that the stronger side is white and the pawn is on
+files a to d, since the other files are mirror images. Each is indexed by the
+side to move, the pawn square, the white king square and the black king square:
+2 * 24 * 64 * 64 positions, with one bit for each.
+
+The analysis starts from the positions whose result is known immediately:
+checkmates, and positions where white can promote safely. Wins are then
+propagated backwards through the moves leading to them. A position with white
+to move is won if any move leads to a win, and one with black to move is won
+once every move leads to a win. Whatever is left when no more wins can be found
+is a draw.
+*/
+
+const kpkPawnSquares = 24
+const kpkSize = 2 * kpkPawnSquares * 64 * 64
+
+var kpkBitbase [kpkSize / 64]uint64
+var kpkOnce sync.Once
+
+// Find the index of a normalised position, where the pawn is on files a to d
+// and ranks 2 to 7.
+func kpkIndex(whiteToMove bool, pawn int, whiteKing int, blackKing int) int {
+	side := 0
+	if !whiteToMove {
+		side = 1
+	}
+
+	pawnIndex := (pawn/8-1)*4 + pawn%8
+
+	return ((side*kpkPawnSquares+pawnIndex)*64+whiteKing)*64 + blackKing
+}
+
+// Find the position of an index. Its pieces may overlap, in which case it isn't
+// a valid position.
+func kpkSquares(index int) (bool, int, int, int) {
+	blackKing := index % 64
+	whiteKing := index / 64 % 64
+	pawnIndex := index / (64 * 64) % kpkPawnSquares
+	whiteToMove := index/(64*64*kpkPawnSquares) == 0
+
+	pawn := (pawnIndex/4+1)*8 + pawnIndex%4
+
+	return whiteToMove, pawn, whiteKing, blackKing
+}
+
+// Build the position for an index, returning false if it isn't legal.
+func kpkPosition(index int) (position, bool) {
+	whiteToMove, pawn, whiteKing, blackKing := kpkSquares(index)
+
+	if whiteKing == blackKing || whiteKing == pawn || blackKing == pawn || squareDistance(whiteKing, blackKing) <= 1 {
+		return position{}, false
+	}
+
+	var kpk position
+	kpk.board[standardTo0x88(pawn)] = Pawn
+	kpk.board[standardTo0x88(whiteKing)] = King
+	kpk.board[standardTo0x88(blackKing)] = King | Black
+	kpk.enPassantTarget = NoEnPassant
+	kpk.fullmove = 1
+
+	kpk.toMove = White
+	if !whiteToMove {
+		kpk.toMove = Black
+	}
+
+	initialiseIncrementalState(&kpk)
+
+	// The side which has just moved can't be left in check.
+	if isKingInCheck(kpk, kpk.toMove) {
+		return position{}, false
+	}
+
+	return kpk, true
+}
+
+// Make sure the bitbase has been generated, generating it if necessary.
+func initialiseKPKBitbase() {
+	kpkOnce.Do(generateKPKBitbase)
+}
+
+// Generate the bitbase.
+func generateKPKBitbase() {
+	const unknown = 0
+	const win = 1
+	const draw = 2
+
+	var results [kpkSize]byte
+
+	// For each position with black to move, the number of moves which aren't
+	// yet known to lead to a win.
+	var remaining [kpkSize]int8
+
+	// The moves between positions in the bitbase, stored backwards, so that
+	// the positions leading to each position are parents[parentStarts[i]:
+	// parentStarts[i+1]].
+	var edges [][2]int32
+
+	for index := 0; index < kpkSize; index++ {
+		kpk, ok := kpkPosition(index)
+		if !ok {
+			results[index] = draw
+			continue
+		}
+
+		moves := generateLegalMoves(kpk)
+
+		if len(moves) == 0 {
+			if kpk.toMove == Black && isKingInCheck(kpk, White) {
+				results[index] = win
+			} else {
+				results[index] = draw
+			}
+
+			continue
+		}
+
+		for _, move := range moves {
+			child := kpk
+			makeMove(&child, move)
+
+			switch {
+			case move.isPromotion():
+				if isSafePromotion(child, move) {
+					results[index] = win
+				}
+			case kpk.toMove == Black && move.isCapture():
+				// Capturing the pawn leaves a draw.
+				results[index] = draw
+			default:
+				_, pawn, whiteKing, blackKing := kpkSquares(index)
+
+				switch kpk.toMove {
+				case White:
+					if int(map0x88ToStandard(int(move.From()))) == pawn {
+						pawn = int(map0x88ToStandard(int(move.To())))
+					} else {
+						whiteKing = int(map0x88ToStandard(int(move.To())))
+					}
+				case Black:
+					blackKing = int(map0x88ToStandard(int(move.To())))
+				}
+
+				edges = append(edges, [2]int32{int32(kpkIndex(child.toMove == White, pawn, whiteKing, blackKing)), int32(index)})
+				remaining[index]++
+			}
+		}
+	}
+
+	// Group the parents of each position together.
+	parentStarts := make([]int32, kpkSize+1)
+	for _, edge := range edges {
+		parentStarts[edge[0]+1]++
+	}
+
+	for i := 1; i <= kpkSize; i++ {
+		parentStarts[i] += parentStarts[i-1]
+	}
+
+	parents := make([]int32, len(edges))
+	filled := make([]int32, kpkSize)
+	for _, edge := range edges {
+		parents[parentStarts[edge[0]]+filled[edge[0]]] = edge[1]
+		filled[edge[0]]++
+	}
+
+	// Propagate wins backwards from the positions already known to be won.
+	var queue []int32
+	for index, result := range results {
+		if result == win {
+			queue = append(queue, int32(index))
+		}
+	}
+
+	for len(queue) > 0 {
+		index := queue[len(queue)-1]
+		queue = queue[:len(queue)-1]
+
+		for _, parent := range parents[parentStarts[index]:parentStarts[index+1]] {
+			if results[parent] != unknown {
+				continue
+			}
+
+			whiteToMove, _, _, _ := kpkSquares(int(parent))
+			remaining[parent]--
+
+			if whiteToMove || remaining[parent] == 0 {
+				results[parent] = win
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	for index, result := range results {
+		if result == win {
+			kpkBitbase[index/64] |= 1 << uint(index%64)
+		}
+	}
+}
+
+// After white promotes, is the new piece safe from capture, without leaving
+// black in stalemate? Underpromotions to a knight or bishop can't win.
+func isSafePromotion(child position, move move) bool {
+	promoted := child.board[move.To()]
+	if promoted.is(Knight) || promoted.is(Bishop) {
+		return false
+	}
+
+	replies := generateLegalMoves(child)
+	if len(replies) == 0 {
+		return isKingInCheck(child, White)
+	}
+
+	for _, reply := range replies {
+		if reply.isCapture() {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+Probe the bitbase, returning whether a position with a king and pawn against a
+king is won. strong is the colour of the side with the pawn, and the squares are
+standard 8x8 squares.
+*/
+func probeKPK(strong byte, strongKing int, pawn int, weakKing int, toMove byte) bool {
+	initialiseKPKBitbase()
+
+	// Normalise the position so that white has the pawn, on files a to d.
+	if strong == Black {
+		strongKing ^= 56
+		pawn ^= 56
+		weakKing ^= 56
+	}
+
+	if pawn%8 > 3 {
+		strongKing ^= 7
+		pawn ^= 7
+		weakKing ^= 7
+	}
+
+	index := kpkIndex(toMove == strong, pawn, strongKing, weakKing)
+
+	return kpkBitbase[index/64]&(1<<uint(index%64)) != 0
+}
+
+/*
+If the position is a king and pawn against a king, return its exact score for
+the side to move. Only kings and pawns are left when the phase is 0, and the
+material then shows how many pawns there are and who has them.
+*/
+func probeKPKScore(position position) (int, bool) {
+	if position.phase != 0 {
+		return 0, false
+	}
+
+	kings := 2 * evalParams.KingWeight
+	if position.material[0].mg+position.material[1].mg != kings+evalParams.PawnWeight {
+		return 0, false
+	}
+
+	pieces := position.pieces
+
+	strong := 0
+	if pieces[1][Pawn] != 0 {
+		strong = 1
+	}
+
+	if bits.OnesCount64(pieces[strong][Pawn]) != 1 || position.kings[0] < 0 || position.kings[1] < 0 {
+		return 0, false
+	}
+
+	score := evaluateKPK(pieces, position.kings, position.toMove, strong)
+
+	if sideIndex(position.toMove) != strong {
+		score = -score
+	}
+
+	return score, true
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func TestKPKBitbase(t *testing.T) {
+	var tests = []struct {
+		name string
+		fen  string
+		won  bool
+	}{
+		{"Unstoppable pawn", "8/8/8/8/8/8/k3P3/4K3 w - - 0 1", true},
+		{"King on the sixth rank", "4k3/8/4K3/4P3/8/8/8/8 w - - 0 1", true},
+		{"King on the sixth rank, black to move", "4k3/8/4K3/4P3/8/8/8/8 b - - 0 1", true},
+		{"Rook pawn", "k7/8/K7/P7/8/8/8/8 w - - 0 1", false},
+		{"Stalemate", "4k3/4P3/4K3/8/8/8/8/8 b - - 0 1", false},
+		{"Pawn can be captured", "8/8/8/8/8/8/3kP3/7K b - - 0 1", false},
+		{"Black king on the sixth rank", "8/8/8/8/3p4/3k4/8/3K4 w - - 0 1", true},
+		{"Black pawn, with the opposition", "3k4/8/8/8/8/3p4/8/3K4 b - - 0 1", false},
+		{"Black pawn, promoting", "8/8/8/8/8/4k3/3p4/7K w - - 0 1", true},
+	}
+
+	for _, test := range tests {
+		for _, fen := range []string{test.fen, mirrorFiles(test.fen)} {
+			score, ok := probeKPKScore(mustFromFEN(fen))
+
+			if !ok || (score != 0) != test.won {
+				t.Errorf("KPK bitbase test failed (%v)!\nFEN: %v\nExpected won: %v\nGot score: %v\n", test.name, fen, test.won, score)
+			}
+		}
+	}
+}
+
+// Each result in the bitbase must agree with a one move search of the results
+// of the positions that follow it.
+func TestKPKConsistency(t *testing.T) {
+	initialiseKPKBitbase()
+
+	random := rand.New(rand.NewSource(1))
+
+	for tested := 0; tested < 2000; {
+		kpk, ok := kpkPosition(random.Intn(kpkSize))
+		if !ok {
+			continue
+		}
+
+		tested++
+
+		score, _ := probeKPKScore(kpk)
+		won := score != 0
+		if kpk.toMove == Black {
+			won = score < 0
+		}
+
+		moves := generateLegalMoves(kpk)
+		expected := kpk.toMove == Black && len(moves) > 0
+
+		if len(moves) == 0 {
+			expected = kpk.toMove == Black && isKingInCheck(kpk, White)
+		}
+
+		for _, move := range moves {
+			child := kpk
+			makeMove(&child, move)
+
+			var childWon bool
+			if move.isPromotion() {
+				childWon = isSafePromotion(child, move)
+			} else if childScore, ok := probeKPKScore(child); ok {
+				childWon = childScore != 0
+			}
+
+			if kpk.toMove == White {
+				expected = expected || childWon
+			} else {
+				expected = expected && childWon
+			}
+		}
+
+		if won != expected {
+			t.Errorf("KPK consistency test failed!\nFEN: %v\nBitbase: %v\nSearch: %v\n", toFEN(kpk), won, expected)
+		}
+	}
+}
+
+// Mirror a FEN from left to right.
+func mirrorFiles(fen string) string {
+	original := mustFromFEN(fen)
+	var mirrored position
+
+	for square := 0; square < 64; square++ {
+		mirrored.board[standardTo0x88(square^7)] = original.board[standardTo0x88(square)]
+	}
+
+	mirrored.toMove = original.toMove
+	mirrored.enPassantTarget = NoEnPassant
+	mirrored.fullmove = original.fullmove
+
+	return toFEN(mirrored)
+}
@@ -0,0 +1,190 @@
+package main
+
+import "math/bits"
+
+/*
+The attacks of sliding pieces are looked up with magic bitboards. Only the
+pieces on a slider's rays can block it, and a piece on the last square of a ray
+blocks nothing beyond it, so for each square the occupancy that matters is
+masked down to the squares inside the rays. Multiplying the masked occupancy by
+the square's magic number gathers its bits into the top of the product, which
+indexes a table of the attacks for every possible occupancy:
+
+	attacks[((occupied & mask) * number) >> shift]
+
+The magic numbers are found when the engine starts, by trying sparse random
+numbers from a fixed seed until one maps every occupancy of the mask to a slot
+holding the right attacks. Different occupancies may share a slot, as long as
+they have the same attacks.
+*/
+type magic struct {
+	mask    uint64
+	number  uint64
+	shift   uint
+	attacks []uint64
+}
+
+var rookMagics = generateMagics(rookAttacks, 0x5DEECE66D)
+var bishopMagics = generateMagics(bishopAttacks, 0xB5AD4ECEDA1CE2A9)
+
+// The attacks of the pieces which don't slide, from each standard square. Pawn
+// attacks are indexed by side, then square.
+var knightAttackTable = generateLeaperAttacks(knightAttacks)
+var kingAttackTable = generateLeaperAttacks(kingAttacks)
+var pawnAttackTable = [2][64]uint64{
+	generateLeaperAttacks(func(pawn uint64) uint64 { return pawnAttacks(pawn, White) }),
+	generateLeaperAttacks(func(pawn uint64) uint64 { return pawnAttacks(pawn, Black) }),
+}
+
+// For each pair of standard squares on the same rank, file or diagonal, the
+// squares strictly between them, and the squares of the whole line through
+// them. Both are empty for squares which don't share a line.
+var betweenTable, lineTable = generateLines()
+
+// Find the squares attacked by a rook on a standard square, given the occupied
+// squares.
+func rookAttacksFrom(square int, occupied uint64) uint64 {
+	m := &rookMagics[square]
+	return m.attacks[((occupied&m.mask)*m.number)>>m.shift]
+}
+
+// Find the squares attacked by a bishop on a standard square, given the
+// occupied squares.
+func bishopAttacksFrom(square int, occupied uint64) uint64 {
+	m := &bishopMagics[square]
+	return m.attacks[((occupied&m.mask)*m.number)>>m.shift]
+}
+
+// Find the squares attacked by a piece of the given identity, other than a
+// pawn, on a standard square, given the occupied squares.
+func attacksFrom(identity piece, square int, occupied uint64) uint64 {
+	switch identity {
+	case Knight:
+		return knightAttackTable[square]
+	case Bishop:
+		return bishopAttacksFrom(square, occupied)
+	case Rook:
+		return rookAttacksFrom(square, occupied)
+	case Queen:
+		return rookAttacksFrom(square, occupied) | bishopAttacksFrom(square, occupied)
+	case King:
+		return kingAttackTable[square]
+	}
+
+	return 0
+}
+
+// Build the table of attacks of a piece which doesn't slide from each square,
+// given the generator for a bitboard of them.
+func generateLeaperAttacks(generator func(uint64) uint64) [64]uint64 {
+	var attacks [64]uint64
+
+	for square := 0; square < 64; square++ {
+		attacks[square] = generator(1 << square)
+	}
+
+	return attacks
+}
+
+// Build the tables of the squares between, and the lines through, each pair of
+// squares, from the attacks of rooks and bishops on an empty board.
+func generateLines() (*[64][64]uint64, *[64][64]uint64) {
+	var between, line [64][64]uint64
+
+	for a := 0; a < 64; a++ {
+		for b := 0; b < 64; b++ {
+			if a == b {
+				continue
+			}
+
+			ends := uint64(1)<<a | uint64(1)<<b
+
+			for _, slider := range [...]func(int, uint64) uint64{rookAttacksFrom, bishopAttacksFrom} {
+				if slider(a, 0)&(1<<b) != 0 {
+					between[a][b] = slider(a, ends) & slider(b, ends)
+					line[a][b] = slider(a, 0)&slider(b, 0) | ends
+				}
+			}
+		}
+	}
+
+	return &between, &line
+}
+
+// Find the magic numbers and attack tables of a sliding piece, given the
+// generator for its attacks from a bitboard of pieces and the empty squares.
+func generateMagics(generator func(uint64, uint64) uint64, seed uint64) [64]magic {
+	var magics [64]magic
+
+	const rank1 uint64 = 0xFF
+	const rank8 uint64 = 0xFF << 56
+	const fileA uint64 = 0x0101010101010101
+	const fileH uint64 = 0x8080808080808080
+
+	state := seed
+	random := func() uint64 {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		return state
+	}
+
+	for square := 0; square < 64; square++ {
+		m := &magics[square]
+
+		// The edges of the board only block the rays running along them if
+		// the piece is on them too.
+		edges := (rank1|rank8)&^(rank1<<(square/8*8)) | (fileA|fileH)&^(fileA<<(square%8))
+		m.mask = generator(1<<square, ^uint64(0)) &^ edges
+		m.shift = uint(64 - bits.OnesCount64(m.mask))
+
+		// Enumerate every subset of the mask, with the attacks for each.
+		var occupancies []uint64
+		var attacks []uint64
+
+		for subset := uint64(0); ; {
+			occupancies = append(occupancies, subset)
+			attacks = append(attacks, generator(1<<square, ^subset))
+
+			subset = (subset - m.mask) & m.mask
+			if subset == 0 {
+				break
+			}
+		}
+
+		m.attacks = make([]uint64, 1<<(64-m.shift))
+
+		// Record which attempt last filled each slot, so that the table
+		// doesn't need to be cleared between attempts.
+		filled := make([]int, len(m.attacks))
+
+		for attempt := 1; ; attempt++ {
+			m.number = random() & random() & random()
+
+			// Numbers which leave few bits at the top of the product of the
+			// mask can't spread the occupancies over the table.
+			if bits.OnesCount64((m.mask*m.number)>>56) < 6 {
+				continue
+			}
+
+			found := true
+			for i, occupancy := range occupancies {
+				slot := (occupancy * m.number) >> m.shift
+
+				if filled[slot] != attempt {
+					filled[slot] = attempt
+					m.attacks[slot] = attacks[i]
+				} else if m.attacks[slot] != attacks[i] {
+					found = false
+					break
+				}
+			}
+
+			if found {
+				break
+			}
+		}
+	}
+
+	return magics
+}
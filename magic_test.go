@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestMagicAttacks(t *testing.T) {
+	// Sample occupancies with the same generator as the magics, so that the test
+	// is repeatable.
+	state := uint64(0x9E3779B97F4A7C15)
+	random := func() uint64 {
+		state ^= state << 13
+		state ^= state >> 7
+		state ^= state << 17
+		return state
+	}
+
+	for square := 0; square < 64; square++ {
+		for i := 0; i < 200; i++ {
+			occupied := random() & random()
+
+			if got, expected := rookAttacksFrom(square, occupied), rookAttacks(1<<square, ^occupied); got != expected {
+				t.Errorf("Rook attacks failed!\nSquare: %v\nOccupied: %x\nExpected: %x\nGot: %x", square, occupied, expected, got)
+			}
+
+			if got, expected := bishopAttacksFrom(square, occupied), bishopAttacks(1<<square, ^occupied); got != expected {
+				t.Errorf("Bishop attacks failed!\nSquare: %v\nOccupied: %x\nExpected: %x\nGot: %x", square, occupied, expected, got)
+			}
+		}
+	}
+}
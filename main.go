@@ -9,6 +9,11 @@ import (
 
 var shouldProfile = flag.Bool("profile", false, "Enable CPU profiling")
 var profilePath = flag.String("profilePath", "/tmp/chessProfile.txt", "Location of CPU profile")
+var evalFile = flag.String("evalFile", "", "Location of evaluation parameters or network to load")
+var shouldUseNNUE = flag.Bool("useNNUE", false, "Use the neural network evaluation")
+var syzygyPath = flag.String("syzygyPath", "", "Directories of Syzygy tablebases, separated as in PATH")
+var bookFile = flag.String("bookFile", "", "Location of a Polyglot opening book to play from")
+var writeEvalFile = flag.String("writeEvalFile", "", "Write the evaluation parameters to this location and exit")
 
 func main() {
 	flag.Parse()
@@ -19,6 +24,65 @@ func main() {
 		defer stopProfile()
 	}
 
+	// Replace the built-in evaluation parameters, or load a network, if a file
+	// is given.
+	if *evalFile != "" {
+		err := loadEvalFile(*evalFile)
+
+		if err != nil {
+			log.Fatal("Could not load evaluation file: ", err)
+		}
+	}
+
+	useNNUE = *shouldUseNNUE
+
+	if *syzygyPath != "" {
+		setSyzygyPath(*syzygyPath)
+	}
+
+	if *bookFile != "" {
+		if err := setBookFile(*bookFile); err != nil {
+			log.Fatal("Could not load book: ", err)
+		}
+
+		ownBook = true
+	}
+
+	// Write out the evaluation parameters in use, to give a starting point for
+	// tuning.
+	if *writeEvalFile != "" {
+		err := saveEvalParameters(*writeEvalFile, evalParams)
+
+		if err != nil {
+			log.Fatal("Could not write evaluation parameters: ", err)
+		}
+
+		return
+	}
+
+	// Run one of the commands instead of the engine if requested.
+	switch flag.Arg(0) {
+	case "tune":
+		runTune(flag.Args()[1:])
+		return
+	case "datagen":
+		runDatagen(flag.Args()[1:])
+		return
+	case "makebook":
+		runMakebook(flag.Args()[1:])
+		return
+	case "perft":
+		runPerft(flag.Args()[1:])
+		return
+	case "suite":
+		runSuite(flag.Args()[1:])
+		return
+	}
+
+	// Generate the KPK bitbase in the background, so that it is ready before the
+	// search needs it.
+	go initialiseKPKBitbase()
+
 	startEngine()
 }
 
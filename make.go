@@ -1,5 +1,7 @@
 package main
 
+import "fmt"
+
 /*
 When making a move, some information about the previous state cannot be
 recovered from the next state. The moveArtifacts type contains this information.
@@ -11,13 +13,160 @@ type moveArtifacts struct {
 	captured          piece
 }
 
+// Places a piece (or 0, for an empty square) on the board at the index. Every
+// change to the board during a move goes through this function, so that the
+// incrementally updated parts of the position stay in step with the board.
+func setSquare(position *position, index int, p piece) {
+	removed := position.board[index]
+
+	position.pawnKey ^= pawnHashKey(removed, index)
+	position.pawnKey ^= pawnHashKey(p, index)
+
+	bit := uint64(1) << map0x88ToStandard(index)
+
+	if removed.exists() {
+		material, pieceSquare, phase := pieceScores(removed, index)
+		side := sideIndex(removed.color())
+
+		position.pieces[side][removed.identity()] &^= bit
+		position.occupied[side] &^= bit
+
+		// A king can briefly stand on two squares while a move is unmade, so
+		// its square is only cleared if it's the one being emptied.
+		if removed.is(King) && position.kings[side] == int(map0x88ToStandard(index)) {
+			position.kings[side] = -1
+		}
+
+		position.material[side].subtract(material)
+		position.pieceSquare[side].subtract(pieceSquare)
+		position.phase -= phase
+	}
+
+	if p.exists() {
+		material, pieceSquare, phase := pieceScores(p, index)
+		side := sideIndex(p.color())
+
+		position.pieces[side][p.identity()] |= bit
+		position.occupied[side] |= bit
+
+		if p.is(King) {
+			position.kings[side] = int(map0x88ToStandard(index))
+		}
+
+		position.material[side].add(material)
+		position.pieceSquare[side].add(pieceSquare)
+		position.phase += phase
+	}
+
+	position.board[index] = p
+
+	if nnue != nil {
+		updateAccumulators(position, index, removed, p)
+	}
+}
+
+// Calculate the incrementally updated parts of a position from scratch, once its
+// board has been set up.
+func initialiseIncrementalState(position *position) {
+	initialiseBitboards(position)
+	position.pawnKey = generatePawnKey(*position)
+	initialisePieceScores(position)
+
+	// The network accumulators are only valid if a network is loaded.
+	position.accumulator.kings = [2]int8{-1, -1}
+	if nnue != nil {
+		refreshAccumulators(position)
+	}
+}
+
+// Collect the bitboards and king squares of a position from its board.
+func initialiseBitboards(position *position) {
+	position.pieces = [2][8]uint64{}
+	position.occupied = [2]uint64{}
+
+	for i := 0; i < BoardSize; i++ {
+		p := position.board[i]
+
+		if isOnBoard(i) && p.exists() {
+			bit := uint64(1) << map0x88ToStandard(i)
+			side := sideIndex(p.color())
+
+			position.pieces[side][p.identity()] |= bit
+			position.occupied[side] |= bit
+		}
+	}
+
+	position.kings = [2]int{kingSquare(position.pieces[0][King]), kingSquare(position.pieces[1][King])}
+}
+
+// Calculate the material and piece-square scores and game phase of a position
+// from scratch. This is also needed after the evaluation parameters change.
+func initialisePieceScores(position *position) {
+	position.material = [2]score{}
+	position.pieceSquare = [2]score{}
+	position.phase = 0
+
+	for i := 0; i < BoardSize; i++ {
+		p := position.board[i]
+
+		if isOnBoard(i) && p.exists() {
+			material, pieceSquare, phase := pieceScores(p, i)
+			side := sideIndex(p.color())
+
+			position.material[side].add(material)
+			position.pieceSquare[side].add(pieceSquare)
+			position.phase += phase
+		}
+	}
+}
+
+// Check that the incrementally updated parts of a position match a calculation
+// from scratch, returning an error describing the first difference.
+func checkIncrementalState(position position) error {
+	expected := position
+	initialiseBitboards(&expected)
+	expected.pawnKey = generatePawnKey(position)
+	initialisePieceScores(&expected)
+
+	switch {
+	case position.pieces != expected.pieces:
+		return fmt.Errorf("piece bitboards are %x, expected %x", position.pieces, expected.pieces)
+	case position.occupied != expected.occupied:
+		return fmt.Errorf("occupied bitboards are %x, expected %x", position.occupied, expected.occupied)
+	case position.kings != expected.kings:
+		return fmt.Errorf("king squares are %v, expected %v", position.kings, expected.kings)
+	case position.pawnKey != expected.pawnKey:
+		return fmt.Errorf("pawn key is %x, expected %x", position.pawnKey, expected.pawnKey)
+	case position.material != expected.material:
+		return fmt.Errorf("material is %v, expected %v", position.material, expected.material)
+	case position.pieceSquare != expected.pieceSquare:
+		return fmt.Errorf("piece-square scores are %v, expected %v", position.pieceSquare, expected.pieceSquare)
+	case position.phase != expected.phase:
+		return fmt.Errorf("phase is %v, expected %v", position.phase, expected.phase)
+	}
+
+	return nil
+}
+
+// In debug builds, panic if the incrementally updated parts of a position have
+// gone wrong.
+func assertIncrementalState(position *position, operation string) {
+	if !debugMode {
+		return
+	}
+
+	if err := checkIncrementalState(*position); err != nil {
+		panic(fmt.Sprintf("%v: %v: %v", operation, toFEN(*position), err))
+	}
+}
+
 // Makes a quiet move (a regular move with no captures) given the position,
 // origin, and destination.
 func makeQuietMove(position *position, from byte, to byte) {
 	pieceMoved := position.board[from]
 
-	position.board[from] = 0
-	position.board[to] = pieceMoved
+	setSquare(position, int(from), 0)
+	setSquare(position, int(to), pieceMoved)
 }
 
 /*
@@ -55,61 +204,39 @@ func makeMove(position *position, move move) moveArtifacts {
 	}
 
 	if position.board[move.From()].is(Rook) {
-		if position.toMove == White && move.From() == 0 {
-			position.castling = setCastle(position.castling, QueenCastle, White, false)
-		} else if position.toMove == White && move.From() == 7 {
-			position.castling = setCastle(position.castling, KingCastle, White, false)
-		} else if position.toMove == Black && move.From() == 112 {
-			position.castling = setCastle(position.castling, QueenCastle, Black, false)
-		} else if position.toMove == Black && move.From() == 119 {
-			position.castling = setCastle(position.castling, KingCastle, Black, false)
+		for _, side := range []int{KingCastle, QueenCastle} {
+			if int(move.From()) == int(position.castlingRooks[castleOffset(side, position.toMove)]) {
+				position.castling = setCastle(position.castling, side, position.toMove, false)
+			}
 		}
 	}
 
 	// Determine which type of move to make.
 	if move.isQuiet() {
-		makeQuietMove(position, move.From(), move.To())
-
 		// A quiet move resets the halfmove counter if it is made by a pawn.
 		if position.board[move.From()].is(Pawn) {
 			position.halfmove = 0
 		}
 
+		makeQuietMove(position, move.From(), move.To())
+
 	} else if move.isCastle() {
 		// If the player is castling, remove all castle rights in the future.
 		position.castling = setCastle(position.castling, KingCastle, position.toMove, false)
 		position.castling = setCastle(position.castling, QueenCastle, position.toMove, false)
 
 		// Determine the starting and ending location of the pieces involved.
-		var kingOrigin int
-		var rookOrigin int
-		var kingFinal int
-		var rookFinal int
-
-		if position.toMove == Black {
-			kingOrigin = 116
-		} else {
-			kingOrigin = 4
-		}
-
-		if move.isQueenCastle() {
-			rookOrigin = kingOrigin - 4
-			kingFinal = kingOrigin - 2
-			rookFinal = kingOrigin - 1
-		} else {
-			rookOrigin = kingOrigin + 3
-			kingFinal = kingOrigin + 2
-			rookFinal = kingOrigin + 1
-		}
+		kingOrigin, rookOrigin, kingFinal, rookFinal := castlingSquares(*position, move.castleSide(), position.toMove)
 
-		// Swap the pieces in the board.
+		// Swap the pieces in the board. In Chess960, either piece may finish
+		// on the other's starting square, so both are lifted first.
 		king := position.board[kingOrigin]
 		rook := position.board[rookOrigin]
-		position.board[kingOrigin] = 0
-		position.board[rookOrigin] = 0
+		setSquare(position, kingOrigin, 0)
+		setSquare(position, rookOrigin, 0)
 
-		position.board[kingFinal] = king
-		position.board[rookFinal] = rook
+		setSquare(position, kingFinal, king)
+		setSquare(position, rookFinal, rook)
 	} else {
 		pieceMoved := position.board[move.From()]
 
@@ -119,19 +246,19 @@ func makeMove(position *position, move move) moveArtifacts {
 			// Save the captured piece in the move artifacts.
 			artifacts.captured = position.board[move.To()]
 
-			position.board[move.From()] = 0
-			position.board[move.To()] = promotionPiece
+			setSquare(position, int(move.From()), 0)
+			setSquare(position, int(move.To()), promotionPiece)
 		} else if move.isPromotion() {
 			promotionPiece := move.getPromotedPiece(pieceMoved)
 
-			position.board[move.From()] = 0
-			position.board[move.To()] = promotionPiece
+			setSquare(position, int(move.From()), 0)
+			setSquare(position, int(move.To()), promotionPiece)
 
 			// The halfmove counter is reset on a promotion.
 			position.halfmove = 0
 		} else if move.isEnPassantCapture() {
-			position.board[move.From()] = 0
-			position.board[move.To()] = pieceMoved
+			setSquare(position, int(move.From()), 0)
+			setSquare(position, int(move.To()), pieceMoved)
 
 			// Determine the en passant target, depending on the direction of
 			// movement.
@@ -143,10 +270,10 @@ func makeMove(position *position, move move) moveArtifacts {
 			}
 
 			artifacts.captured = position.board[captureIndex]
-			position.board[captureIndex] = 0
+			setSquare(position, captureIndex, 0)
 		} else if move.isDoublePawnPush() {
-			position.board[move.From()] = 0
-			position.board[move.To()] = pieceMoved
+			setSquare(position, int(move.From()), 0)
+			setSquare(position, int(move.To()), pieceMoved)
 
 			// A double pawn push creates an en passant target, which must be
 			// saved in the new position.
@@ -155,8 +282,8 @@ func makeMove(position *position, move move) moveArtifacts {
 		} else if move.isCapture() {
 			artifacts.captured = position.board[move.To()]
 
-			position.board[move.From()] = 0
-			position.board[move.To()] = pieceMoved
+			setSquare(position, int(move.From()), 0)
+			setSquare(position, int(move.To()), pieceMoved)
 		}
 
 	}
@@ -165,19 +292,9 @@ func makeMove(position *position, move move) moveArtifacts {
 	if artifacts.captured != 0 && artifacts.captured.is(Rook) {
 		color := artifacts.captured.color()
 
-		if getCastle(position.castling, QueenCastle, color) {
-			if color == White && move.To() == 0 {
-				position.castling = setCastle(position.castling, QueenCastle, White, false)
-			} else if color == Black && move.To() == 112 {
-				position.castling = setCastle(position.castling, QueenCastle, Black, false)
-			}
-		}
-
-		if getCastle(position.castling, KingCastle, color) {
-			if color == White && move.To() == 7 {
-				position.castling = setCastle(position.castling, KingCastle, White, false)
-			} else if color == Black && move.To() == 119 {
-				position.castling = setCastle(position.castling, KingCastle, Black, false)
+		for _, side := range []int{KingCastle, QueenCastle} {
+			if int(move.To()) == int(position.castlingRooks[castleOffset(side, color)]) {
+				position.castling = setCastle(position.castling, side, color, false)
 			}
 		}
 	}
@@ -190,6 +307,8 @@ func makeMove(position *position, move move) moveArtifacts {
 		position.fullmove++
 	}
 
+	assertIncrementalState(position, "makeMove")
+
 	return artifacts
 }
 
@@ -215,39 +334,20 @@ func unmakeMove(position *position, move move, artifacts moveArtifacts) {
 	if move.isQuiet() {
 		pieceMoved := position.board[move.To()]
 
-		position.board[move.To()] = 0
-		position.board[move.From()] = pieceMoved
+		setSquare(position, int(move.To()), 0)
+		setSquare(position, int(move.From()), pieceMoved)
 	} else if move.isCastle() {
 		// Determine the starting and ending location of the pieces involved.
-		var kingOrigin int
-		var rookOrigin int
-		var kingFinal int
-		var rookFinal int
-
-		if position.toMove == Black {
-			kingOrigin = 116
-		} else {
-			kingOrigin = 4
-		}
-
-		if move.isQueenCastle() {
-			rookOrigin = kingOrigin - 4
-			kingFinal = kingOrigin - 2
-			rookFinal = kingOrigin - 1
-		} else {
-			rookOrigin = kingOrigin + 3
-			kingFinal = kingOrigin + 2
-			rookFinal = kingOrigin + 1
-		}
+		kingOrigin, rookOrigin, kingFinal, rookFinal := castlingSquares(*position, move.castleSide(), position.toMove)
 
 		// Swap the pieces in the board.
 		king := position.board[kingFinal]
 		rook := position.board[rookFinal]
-		position.board[kingFinal] = 0
-		position.board[rookFinal] = 0
+		setSquare(position, kingFinal, 0)
+		setSquare(position, rookFinal, 0)
 
-		position.board[kingOrigin] = king
-		position.board[rookOrigin] = rook
+		setSquare(position, kingOrigin, king)
+		setSquare(position, rookOrigin, rook)
 	} else {
 		pieceMoved := position.board[move.To()]
 
@@ -258,8 +358,8 @@ func unmakeMove(position *position, move move, artifacts moveArtifacts) {
 			pawn |= piece(pieceMoved.color())
 			pawn |= Pawn
 
-			position.board[move.From()] = pawn
-			position.board[move.To()] = artifacts.captured
+			setSquare(position, int(move.From()), pawn)
+			setSquare(position, int(move.To()), artifacts.captured)
 		} else if move.isPromotion() {
 			// If the move was a promotion , recreate the pawn piece that was
 			// replaced by the promoted piece.
@@ -267,11 +367,11 @@ func unmakeMove(position *position, move move, artifacts moveArtifacts) {
 			pawn |= piece(pieceMoved.color())
 			pawn |= Pawn
 
-			position.board[move.From()] = pawn
-			position.board[move.To()] = 0
+			setSquare(position, int(move.From()), pawn)
+			setSquare(position, int(move.To()), 0)
 		} else if move.isEnPassantCapture() {
-			position.board[move.To()] = 0
-			position.board[move.From()] = pieceMoved
+			setSquare(position, int(move.To()), 0)
+			setSquare(position, int(move.From()), pieceMoved)
 
 			// Determine the index captured by the en passant, depending on the
 			// direction of movement.
@@ -283,15 +383,17 @@ func unmakeMove(position *position, move move, artifacts moveArtifacts) {
 			}
 
 			// Restore the captured piece.
-			position.board[captureIndex] = artifacts.captured
+			setSquare(position, captureIndex, artifacts.captured)
 		} else if move.isDoublePawnPush() {
-			position.board[move.To()] = 0
-			position.board[move.From()] = pieceMoved
+			setSquare(position, int(move.To()), 0)
+			setSquare(position, int(move.From()), pieceMoved)
 
 			position.enPassantTarget = artifacts.enPassantPosition
 		} else if move.isCapture() {
-			position.board[move.From()] = pieceMoved
-			position.board[move.To()] = artifacts.captured
+			setSquare(position, int(move.From()), pieceMoved)
+			setSquare(position, int(move.To()), artifacts.captured)
 		}
 	}
+
+	assertIncrementalState(position, "unmakeMove")
 }
@@ -1,6 +1,9 @@
 package main
 
-import "testing"
+import (
+	"fmt"
+	"testing"
+)
 
 type testMove struct {
 	name   string
@@ -13,6 +16,7 @@ func TestMakeUnmake(t *testing.T) {
 	cases := []testMove{
 		{"Quiet move", "rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR w KQkq - 0 2", "rnbqkbnr/pppp1ppp/8/4p3/2B1P3/8/PPPP1PPP/RNBQK1NR b KQkq - 1 2", createQuietMove(5, 50)},
 		{"Capture", "rnbqkb1r/pppp1ppp/5n2/1B2p3/4P3/8/PPPP1PPP/RNBQK1NR b KQkq - 3 3", "rnbqkb1r/pppp1ppp/8/1B2p3/4n3/8/PPPP1PPP/RNBQK1NR w KQkq - 0 4", createCaptureMove(85, 52)},
+		{"Single pawn push", "rnbqkb1r/pppppppp/5n2/8/8/5N2/PPPPPPPP/RNBQKB1R w KQkq - 2 2", "rnbqkb1r/pppppppp/5n2/8/8/4PN2/PPPP1PPP/RNBQKB1R b KQkq - 0 2", createQuietMove(20, 36)},
 		{"Double pawn push", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", createDoublePawnPush(20, 52)},
 		{"Promotion", "rnbq1bnr/pppBP1p1/6kp/5p2/3Q4/8/PPP2PPP/RNB1K1NR w KQ - 0 9", "rnbqQbnr/pppB2p1/6kp/5p2/3Q4/8/PPP2PPP/RNB1K1NR b KQ - 0 9", createPromotionMove(100, 116, Queen)},
 		{"En passant capture", "rnbqkbnr/pp1p2pp/5p2/2pPp3/4P3/8/PPP2PPP/RNBQKBNR w KQkq c6 0 4", "rnbqkbnr/pp1p2pp/2P2p2/4p3/4P3/8/PPP2PPP/RNBQKBNR b KQkq - 0 4", createEnPassantCaptureMove(67, 82)},
@@ -29,7 +33,7 @@ func TestMakeUnmake(t *testing.T) {
 	}
 
 	for _, test := range cases {
-		position := fromFEN(test.fen)
+		position := mustParseFEN(test.fen)
 
 		artifacts := makeMove(&position, test.move)
 
@@ -39,6 +43,10 @@ func TestMakeUnmake(t *testing.T) {
 			t.Errorf("Make move test failed (%v)!\nExpected: %v\nActual: %v\n", test.name, test.newFen, newFen)
 		}
 
+		if err := checkIncrementalState(position); err != nil {
+			t.Errorf("Make move test failed (%v)!\nIncremental state was not updated correctly: %v\n", test.name, err)
+		}
+
 		unmakeMove(&position, test.move, artifacts)
 
 		newFen = toFEN(position)
@@ -46,5 +54,57 @@ func TestMakeUnmake(t *testing.T) {
 		if newFen != test.fen {
 			t.Errorf("Unmake move test failed (%v)!\nExpected: %v\nActual: %v\n", test.name, test.fen, newFen)
 		}
+
+		if err := checkIncrementalState(position); err != nil {
+			t.Errorf("Unmake move test failed (%v)!\nIncremental state was not restored correctly: %v\n", test.name, err)
+		}
+	}
+}
+
+// Check that the incrementally updated parts of the position, including the
+// king squares, stay correct through every move of a tree, and are restored by
+// unmaking them. Pseudo-legal moves are used, so that kings are captured too.
+func TestIncrementalStateThroughTree(t *testing.T) {
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"1rk1r3/8/8/8/8/8/8/1RK1R3 w BEbe - 0 1",
+	}
+
+	var walk func(position *position, depth int) error
+	walk = func(position *position, depth int) error {
+		if depth == 0 {
+			return nil
+		}
+
+		for _, move := range generateMoves(*position) {
+			before := *position
+			artifacts := makeMove(position, move)
+
+			if err := checkIncrementalState(*position); err != nil {
+				return fmt.Errorf("after %v from %v: %v", toUCI(before, move), toFEN(before), err)
+			}
+
+			if err := walk(position, depth-1); err != nil {
+				return err
+			}
+
+			unmakeMove(position, move, artifacts)
+
+			if *position != before {
+				return fmt.Errorf("unmaking %v from %v didn't restore the position", toUCI(before, move), toFEN(before))
+			}
+		}
+
+		return nil
+	}
+
+	for _, fen := range fens {
+		position := mustParseFEN(fen)
+
+		if err := walk(&position, 3); err != nil {
+			t.Errorf("Incremental state test failed!\nFEN: %v\nError: %v\n", fen, err)
+		}
 	}
 }
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+	"sort"
+)
+
+/*
+The makebook command builds a Polyglot opening book from games in PGN files.
+Each game is replayed from its starting position for a number of plies, and
+every move played is recorded with the result of the game, from the perspective
+of the side which played it.
+
+A move is only added to the book if it was played in enough games, and scored
+well enough in them. Its weight is the number of points it scored, counting 2
+for a win and 1 for a draw, so that the engine plays the most successful moves
+most often.
+*/
+type makebookOptions struct {
+	plies    int
+	minGames int
+	minScore float64
+}
+
+// The statistics of a move played in a position, identified by its Polyglot
+// key and move.
+type bookMoveKey struct {
+	key  uint64
+	move uint16
+}
+
+type bookMoveStats struct {
+	wins   int
+	draws  int
+	losses int
+}
+
+// Run the makebook command, given its command line arguments.
+func runMakebook(args []string) {
+	var options makebookOptions
+
+	flags := flag.NewFlagSet("makebook", flag.ExitOnError)
+	flags.IntVar(&options.plies, "plies", 30, "Number of plies of each game to add to the book")
+	flags.IntVar(&options.minGames, "minGames", 3, "Number of games a move must be played in to be added")
+	flags.Float64Var(&options.minScore, "minScore", 0, "Percentage a move must score to be added")
+	outputPath := flags.String("output", "book.bin", "Location to write the book")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		log.Fatal("No PGN files given")
+	}
+
+	stats := make(map[bookMoveKey]*bookMoveStats)
+	games := 0
+
+	for _, path := range flags.Args() {
+		file, err := os.Open(path)
+		if err != nil {
+			log.Fatal("Could not open PGN file: ", err)
+		}
+
+		reader := newPGNReader(file)
+
+		for {
+			game, err := reader.next()
+
+			if _, ok := err.(*pgnError); ok {
+				log.Printf("Skipping game in %v: %v", path, err)
+				continue
+			} else if err == io.EOF {
+				break
+			} else if err != nil {
+				log.Fatal("Could not read PGN file: ", err)
+			}
+
+			addBookGame(stats, game, options)
+
+			games++
+			if games%10000 == 0 {
+				log.Printf("Read %v games", games)
+			}
+		}
+
+		file.Close()
+	}
+
+	book := buildBook(stats, options)
+	log.Printf("Read %v games, writing %v entries", games, len(book.entries))
+
+	if err := saveBook(*outputPath, book); err != nil {
+		log.Fatal("Could not write book: ", err)
+	}
+}
+
+// Replay a game, adding its moves to the statistics. Games without a result
+// are skipped.
+func addBookGame(stats map[bookMoveKey]*bookMoveStats, game *pgnGame, options makebookOptions) {
+	result, ok := parseResult(game.result)
+	if !ok {
+		return
+	}
+
+	position, err := game.initialPosition()
+	if err != nil {
+		return
+	}
+
+	for ply, pgnMove := range game.moves {
+		if ply >= options.plies {
+			break
+		}
+
+		key := bookMoveKey{polyglotKey(position), encodePolyglotMove(position, pgnMove.move)}
+		if stats[key] == nil {
+			stats[key] = &bookMoveStats{}
+		}
+
+		score := result
+		if position.toMove == Black {
+			score = 1 - result
+		}
+
+		switch score {
+		case 1:
+			stats[key].wins++
+		case 0.5:
+			stats[key].draws++
+		default:
+			stats[key].losses++
+		}
+
+		makeMove(&position, pgnMove.move)
+	}
+}
+
+/*
+Build a book from the statistics of the moves, keeping those which pass the
+filters. The entries of each position are sorted with the highest weight first,
+as in other Polyglot books, and the weights are scaled down if the largest
+doesn't fit.
+*/
+func buildBook(stats map[bookMoveKey]*bookMoveStats, options makebookOptions) *openingBook {
+	var entries []polyglotEntry
+	var points []int
+
+	for key, moveStats := range stats {
+		games := moveStats.wins + moveStats.draws + moveStats.losses
+		score := 2*moveStats.wins + moveStats.draws
+
+		if games < options.minGames || score == 0 || float64(score)*50/float64(games) < options.minScore {
+			continue
+		}
+
+		entries = append(entries, polyglotEntry{key: key.key, move: key.move})
+		points = append(points, score)
+	}
+
+	order := make([]int, len(entries))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.Slice(order, func(i int, j int) bool {
+		a, b := order[i], order[j]
+
+		if entries[a].key != entries[b].key {
+			return entries[a].key < entries[b].key
+		}
+
+		if points[a] != points[b] {
+			return points[a] > points[b]
+		}
+
+		return entries[a].move < entries[b].move
+	})
+
+	book := &openingBook{entries: make([]polyglotEntry, len(entries))}
+
+	for start := 0; start < len(order); {
+		// The first entry of each position has its largest weight.
+		largest := points[order[start]]
+
+		end := start
+		for end < len(order) && entries[order[end]].key == entries[order[start]].key {
+			entry := entries[order[end]]
+			entry.weight = uint16(points[order[end]])
+
+			if largest > 0xFFFF {
+				entry.weight = uint16(max(1, points[order[end]]*0xFFFF/largest))
+			}
+
+			book.entries[end] = entry
+			end++
+		}
+
+		start = end
+	}
+
+	return book
+}
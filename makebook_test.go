@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildBook(t *testing.T) {
+	pgn := `1. e4 e5 2. Nf3 1-0
+1. e4 c5 2. Nf3 0-1
+1. e4 e5 2. Bc4 1/2-1/2
+1. d4 1/2-1/2
+1. a3 0-1
+1. a4 *
+`
+
+	stats := make(map[bookMoveKey]*bookMoveStats)
+	reader := newPGNReader(strings.NewReader(pgn))
+
+	for {
+		game, err := reader.next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+
+		addBookGame(stats, game, makebookOptions{plies: 2})
+	}
+
+	book := buildBook(stats, makebookOptions{minGames: 1})
+
+	// a3 never scored, a4 has no result, and the third moves are beyond the
+	// plies limit.
+	start := mustFromFEN(startPosition)
+	afterE4 := start
+	makeMove(&afterE4, encodedMove(t, start, 12<<6|28))
+
+	var expected = []struct {
+		position position
+		moves    []uint16
+		weights  []uint16
+	}{
+		{start, []uint16{12<<6 | 28, 11<<6 | 27}, []uint16{3, 1}},
+		{afterE4, []uint16{50<<6 | 34, 52<<6 | 36}, []uint16{2, 1}},
+	}
+
+	if len(book.entries) != 4 {
+		t.Fatalf("Building book failed!\nExpected 4 entries, got %v\n", len(book.entries))
+	}
+
+	for _, test := range expected {
+		for i, entry := range book.lookup(polyglotKey(test.position)) {
+			if i >= len(test.moves) || entry.move != test.moves[i] || entry.weight != test.weights[i] {
+				t.Errorf("Building book failed!\nFEN: %v\nUnexpected entry %v: %+v\n", toFEN(test.position), i, entry)
+			}
+		}
+	}
+
+	for i := 1; i < len(book.entries); i++ {
+		if book.entries[i].key < book.entries[i-1].key {
+			t.Errorf("Building book failed!\nEntries are not sorted by key\n")
+		}
+	}
+
+	if filtered := buildBook(stats, makebookOptions{minGames: 2}); len(filtered.entries) != 2 {
+		t.Errorf("Building book failed!\nExpected 2 entries played twice, got %v\n", len(filtered.entries))
+	}
+
+	if filtered := buildBook(stats, makebookOptions{minGames: 1, minScore: 50}); len(filtered.entries) != 3 {
+		t.Errorf("Building book failed!\nExpected 3 entries scoring 50%%, got %v\n", len(filtered.entries))
+	}
+
+	path := filepath.Join(t.TempDir(), "book.bin")
+	if err := saveBook(path, book); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadBook(path)
+	if err != nil || len(loaded.entries) != len(book.entries) {
+		t.Fatalf("Building book failed!\nCould not load the saved book: %v\n", err)
+	}
+
+	for i, entry := range loaded.entries {
+		if entry != book.entries[i] {
+			t.Errorf("Building book failed!\nSaved entry %v differs\n", i)
+		}
+	}
+}
+
+// Decode a Polyglot move which must be legal.
+func encodedMove(t *testing.T, position position, encoded uint16) move {
+	move, ok := decodePolyglotMove(position, encoded)
+	if !ok {
+		t.Fatalf("Polyglot move %v is not legal in %v\n", encoded, toFEN(position))
+	}
+
+	return move
+}
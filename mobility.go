@@ -0,0 +1,196 @@
+package main
+
+import "math/bits"
+
+/*
+Mobility is the number of safe squares a piece attacks: squares which are not
+occupied by friendly pieces, and not attacked by enemy pawns. Each safe square
+above the baseline for the piece type is worth a bonus, and each one below it a
+penalty, so that a piece with an average number of moves scores nothing.
+*/
+
+// Bitboards of the light and dark squares of the board.
+const lightSquares uint64 = 0x55AA55AA55AA55AA
+const darkSquares uint64 = 0xAA55AA55AA55AA55
+
+/*
+evaluateMobility returns the mobility score of each side. pieces holds the
+bitboards of each piece type for each side, indexed by piece identity, and
+attacks the attack map of each side.
+*/
+func evaluateMobility(pieces [2][8]uint64, attacks *[2]attackMap) [2]score {
+	var scores [2]score
+
+	for side := range scores {
+		var own uint64
+		for _, bitboard := range pieces[side] {
+			own |= bitboard
+		}
+
+		// Only squares which don't hold friendly pieces, and aren't attacked
+		// by enemy pawns, count towards mobility.
+		area := ^own &^ attacks[1-side].byPiece[Pawn]
+
+		var mg int
+		var eg int
+
+		for _, identity := range [4]piece{Knight, Bishop, Rook, Queen} {
+			for remaining := pieces[side][identity]; remaining != 0; remaining &= remaining - 1 {
+				square := bits.TrailingZeros64(remaining)
+				count := bits.OnesCount64(attacks[side].bySquare[square]&area) - evalParams.MobilityBaseline[identity]
+
+				mg += evalParams.MobilityMg[identity] * count
+				eg += evalParams.MobilityEg[identity] * count
+			}
+		}
+
+		scores[side] = score{mg, eg}
+	}
+
+	return scores
+}
+
+/*
+evaluatePieces returns the score of each side for the placement of its pieces:
+the bishop pair, rooks on open files and the seventh rank, knight outposts, bad
+bishops, and trapped pieces. The arguments are the same as for
+evaluateKingSafety.
+*/
+func evaluatePieces(pieces [2][8]uint64, kings [2]int, occupied uint64) [2]score {
+	var scores [2]score
+
+	for _, color := range [2]byte{White, Black} {
+		side := sideIndex(color)
+		enemyColor := opposingColor(color)
+		ownPawns := pieces[side][Pawn]
+		enemyPawns := pieces[1-side][Pawn]
+
+		var mg int
+		var eg int
+
+		bishops := pieces[side][Bishop]
+		if bishops&lightSquares != 0 && bishops&darkSquares != 0 {
+			mg += evalParams.BishopPairMg
+			eg += evalParams.BishopPairEg
+		}
+
+		for remaining := bishops; remaining != 0; remaining &= remaining - 1 {
+			square := bits.TrailingZeros64(remaining)
+
+			sameColor := lightSquares
+			if (1<<uint(square))&darkSquares != 0 {
+				sameColor = darkSquares
+			}
+
+			count := bits.OnesCount64(ownPawns & sameColor)
+			mg += evalParams.BadBishopMg * count
+			eg += evalParams.BadBishopEg * count
+
+			if isTrappedBishop(square, color, enemyPawns) {
+				mg += evalParams.TrappedBishopMg
+				eg += evalParams.TrappedBishopEg
+			}
+		}
+
+		for remaining := pieces[side][Rook]; remaining != 0; remaining &= remaining - 1 {
+			square := bits.TrailingZeros64(remaining)
+			file := square % 8
+
+			if ownPawns&fileMasks[file] == 0 {
+				if enemyPawns&fileMasks[file] == 0 {
+					mg += evalParams.RookOpenFileMg
+					eg += evalParams.RookOpenFileEg
+				} else {
+					mg += evalParams.RookSemiOpenFileMg
+					eg += evalParams.RookSemiOpenFileEg
+				}
+			}
+
+			if relativeRank(square, color) == 6 {
+				seventh := uint64(0xFF) << uint(8*(square/8))
+				enemyKingOnEighth := kings[1-side] != -1 && relativeRank(kings[1-side], color) == 7
+
+				if enemyKingOnEighth || enemyPawns&seventh != 0 {
+					mg += evalParams.RookSeventhMg
+					eg += evalParams.RookSeventhEg
+				}
+			}
+
+			if isTrappedRook(square, kings[side], color, occupied, pieces[side]) {
+				mg += evalParams.TrappedRookMg
+				eg += evalParams.TrappedRookEg
+			}
+		}
+
+		for remaining := pieces[side][Knight]; remaining != 0; remaining &= remaining - 1 {
+			square := bits.TrailingZeros64(remaining)
+			rank := relativeRank(square, color)
+
+			supported := ownPawns&pawnAttacks(1<<uint(square), enemyColor) != 0
+			attackable := enemyPawns&passedMasks[side][square]&adjacentFileMasks[square%8] != 0
+
+			if rank >= 3 && rank <= 5 && supported && !attackable {
+				mg += evalParams.KnightOutpostMg
+				eg += evalParams.KnightOutpostEg
+			}
+		}
+
+		scores[side] = score{mg, eg}
+	}
+
+	return scores
+}
+
+// Determine whether a bishop of the given colour is trapped on a7 or h7 by an
+// enemy pawn on b6 or g6 (or on a2 or h2 by a pawn on b3 or g3, for black).
+func isTrappedBishop(square int, color byte, enemyPawns uint64) bool {
+	if relativeRank(square, color) != 6 {
+		return false
+	}
+
+	var blocker int
+	if color == White {
+		blocker = square - 8
+	} else {
+		blocker = square + 8
+	}
+
+	if square%8 == 0 {
+		blocker++
+	} else if square%8 == 7 {
+		blocker--
+	} else {
+		return false
+	}
+
+	return enemyPawns&(1<<uint(blocker)) != 0
+}
+
+// Determine whether a rook of the given colour is trapped on the back rank,
+// between its king and the corner, with very few moves available.
+func isTrappedRook(square int, king int, color byte, occupied uint64, own [8]uint64) bool {
+	if king == -1 || relativeRank(square, color) != 0 || relativeRank(king, color) != 0 {
+		return false
+	}
+
+	kingFile := king % 8
+	rookFile := square % 8
+
+	// The king must have stepped towards the corner without castling, onto the
+	// b, c, f or g file.
+	kingsideTrap := (kingFile == 5 || kingFile == 6) && rookFile > kingFile
+	queensideTrap := (kingFile == 1 || kingFile == 2) && rookFile < kingFile
+
+	if !kingsideTrap && !queensideTrap {
+		return false
+	}
+
+	var ownPieces uint64
+	for _, bitboard := range own {
+		ownPieces |= bitboard
+	}
+
+	moves := rookAttacks(1<<uint(square), ^occupied) &^ ownPieces
+
+	return bits.OnesCount64(moves) <= evalParams.TrappedRookMobility
+}
@@ -0,0 +1,66 @@
+package main
+
+import "testing"
+
+type pieceActivityTest struct {
+	name   string
+	better string
+	worse  string
+}
+
+func TestMobility(t *testing.T) {
+	cases := []pieceActivityTest{
+		{"Centralised knight", "4k3/8/8/8/3N4/8/8/4K3 w - - 0 1", "4k3/8/8/8/8/8/8/N3K3 w - - 0 1"},
+		{"Squares attacked by pawns", "4k3/8/8/8/3N4/8/8/4K3 w - - 0 1", "4k3/3p4/p5p1/8/3N4/8/8/4K3 w - - 0 1"},
+		{"Blocked bishop", "4k3/8/8/8/8/8/8/2B1K3 w - - 0 1", "4k3/8/8/8/8/8/1P1P4/2B1K3 w - - 0 1"},
+	}
+
+	for _, test := range cases {
+		checkActivity(t, test, func(pieces [2][8]uint64, occupied uint64) [2]score {
+			return evaluateMobility(pieces, evaluationAttacks(pieces, occupied))
+		})
+	}
+}
+
+func TestPieceActivity(t *testing.T) {
+	cases := []pieceActivityTest{
+		{"Bishop pair", "4k3/8/8/8/8/8/8/2B1KB2 w - - 0 1", "4k3/8/8/8/8/8/8/1B2KB2 w - - 0 1"},
+		{"Rook on open file", "4k3/pp4pp/8/8/8/8/PP4PP/3RK3 w - - 0 1", "4k3/pp1p2pp/8/8/8/8/PP1P2PP/3RK3 w - - 0 1"},
+		{"Rook on seventh", "4k3/R4ppp/8/8/8/8/5PPP/4K3 w - - 0 1", "4k3/5ppp/R7/8/8/8/5PPP/4K3 w - - 0 1"},
+		{"Knight outpost", "4k3/p7/8/4N3/3P4/8/8/4K3 w - - 0 1", "4k3/5p2/8/4N3/3P4/8/8/4K3 w - - 0 1"},
+		{"Trapped bishop", "4k3/B7/2p5/8/8/8/8/4K3 w - - 0 1", "4k3/B7/1p6/8/8/8/8/4K3 w - - 0 1"},
+		{"Trapped rook", "4k3/8/8/8/8/8/5PPP/5RK1 w - - 0 1", "4k3/8/8/8/8/8/5PPP/5K1R w - - 0 1"},
+	}
+
+	for _, test := range cases {
+		checkActivity(t, test, func(pieces [2][8]uint64, occupied uint64) [2]score {
+			kings := [2]int{kingSquare(pieces[0][King]), kingSquare(pieces[1][King])}
+			return evaluatePieces(pieces, kings, occupied)
+		})
+	}
+}
+
+// Check that an evaluation term is symmetrical, and prefers the better position
+// for white in the test case to the worse one in both the middlegame and
+// endgame.
+func checkActivity(t *testing.T, test pieceActivityTest, term func([2][8]uint64, uint64) [2]score) {
+	var scores [2]score
+
+	for i, fen := range []string{test.better, test.worse} {
+		pieces, _, occupied := evaluationBitboards(mustFromFEN(fen))
+		sides := term(pieces, occupied)
+
+		pieces, _, occupied = evaluationBitboards(mustParseFEN(mirrorFEN(fen)))
+		mirroredSides := term(pieces, occupied)
+
+		if sides[0] != mirroredSides[1] || sides[1] != mirroredSides[0] {
+			t.Errorf("Symmetry test failed! (%v)\nFEN: %v\nScores: %v\nMirrored scores: %v\n", test.name, fen, sides, mirroredSides)
+		}
+
+		scores[i] = score{sides[0].mg - sides[1].mg, sides[0].eg - sides[1].eg}
+	}
+
+	if scores[0].mg < scores[1].mg || scores[0].eg < scores[1].eg || scores[0] == scores[1] {
+		t.Errorf("Activity test failed! (%v)\nBetter FEN: %v %v\nWorse FEN: %v %v\n", test.name, test.better, scores[0], test.worse, scores[1])
+	}
+}
@@ -82,6 +82,15 @@ func (m move) isQueenCastle() bool {
 	return ((m&moveTypeMask)>>16 == 3)
 }
 
+// Find the side a castle is to, either KingCastle or QueenCastle.
+func (m move) castleSide() int {
+	if m.isQueenCastle() {
+		return QueenCastle
+	}
+
+	return KingCastle
+}
+
 // Is the move a double pawn push?
 func (m move) isDoublePawnPush() bool {
 	return ((m&moveTypeMask)>>16 == 1)
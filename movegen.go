@@ -1,32 +1,28 @@
 package main
 
+import "math/bits"
+
 /*
-moveOffsets maps each piece to the directions it can move. For example, the king
-can move left, with an index offset of -1, or directly upwards, with a move
-offset of 16.
+Find the indices a castle's king and rook start and finish on. Wherever they
+start, which in Chess960 can be any file, the king finishes on the g file after
+castling kingside and the c file after castling queenside, with the rook beside
+it on the f or d file.
 */
-var moveOffsets = map[piece][]int{
-	King:   {15, 16, 17, -1, 1, -15, -16, -17},
-	Queen:  {15, 16, 17, -1, 1, -15, -16, -17},
-	Bishop: {15, 17, -15, -17},
-	Rook:   {16, -16, 1, -1},
-	Knight: {14, 31, 33, 18, -14, -31, -33, -18},
-}
+func castlingSquares(position position, side int, color byte) (kingOrigin int, rookOrigin int, kingFinal int, rookFinal int) {
+	kingOrigin = int(position.castlingKings[sideIndex(color)])
+	rookOrigin = int(position.castlingRooks[castleOffset(side, color)])
 
-/*
-castlingBlocks declares the indices which, if they contain a piece, can block
-castling to that side for each colour.
+	backRank := kingOrigin - kingOrigin%16
 
-castlingChecks declares the indices which, if in check, can block castling.
-*/
-var castlingBlocks = map[byte]map[int][]int{
-	White: map[int][]int{KingCastle: {5, 6}, QueenCastle: {1, 2, 3}},
-	Black: map[int][]int{KingCastle: {117, 118}, QueenCastle: {113, 114, 115}},
-}
+	if side == QueenCastle {
+		kingFinal = backRank + 2
+		rookFinal = backRank + 3
+	} else {
+		kingFinal = backRank + 6
+		rookFinal = backRank + 5
+	}
 
-var castlingChecks = map[byte]map[int][]int{
-	White: map[int][]int{KingCastle: {5, 6}, QueenCastle: {2, 3}},
-	Black: map[int][]int{KingCastle: {117, 118}, QueenCastle: {114, 115}},
+	return kingOrigin, rookOrigin, kingFinal, rookFinal
 }
 
 // Create a quiet move between two indices.
@@ -106,253 +102,561 @@ func createDoublePawnPush(from int, to int) move {
 }
 
 // Given a position and the side to castle (either KingSide or QueenSide),
-// determine if the side is able to legally castle.
-func clearToCastle(position position, side int) bool {
-	// For each index in the potential blockers, check that there is no piece
-	// present.
-	for _, index := range castlingBlocks[position.toMove][side] {
-		if piecePresent(position, index) {
+// determine if every index the king and rook pass over, or finish on, is empty,
+// apart from the king and rook themselves.
+func castlingPathEmpty(position position, side int) bool {
+	kingOrigin, rookOrigin, kingFinal, rookFinal := castlingSquares(position, side, position.toMove)
+
+	for index := min(kingOrigin, rookOrigin, kingFinal, rookFinal); index <= max(kingOrigin, rookOrigin, kingFinal, rookFinal); index++ {
+		if index != kingOrigin && index != rookOrigin && piecePresent(position, index) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Given a position, the side to castle (either KingSide or QueenSide), whose
+// path is empty, and the squares the enemy attacks, determine if the side is
+// able to legally castle.
+func clearToCastle(position position, side int, attacked uint64) bool {
+	kingOrigin, rookOrigin, kingFinal, rookFinal := castlingSquares(position, side, position.toMove)
+
+	// The king can't castle out of, through or into check. Its final index is
+	// checked again once the king and rook have moved, since the rook may have
+	// been shielding it from an attack along the back rank.
+	for index := min(kingOrigin, kingFinal); index <= max(kingOrigin, kingFinal); index++ {
+		if attacked&(1<<map0x88ToStandard(index)) != 0 {
 			return false
 		}
 	}
 
-	// For each index in the potentially-checked indices, ensure that the index
-	// is not attacked. This could be optimised by only generating the attack
-	// map once.
-	for _, index := range castlingChecks[position.toMove][side] {
-		var attackingColor byte
-		if position.toMove == White {
-			attackingColor = Black
+	occupied := position.occupied[0] | position.occupied[1]
+	occupied &^= 1<<map0x88ToStandard(kingOrigin) | 1<<map0x88ToStandard(rookOrigin)
+	occupied |= 1 << map0x88ToStandard(rookFinal)
+
+	return attackersOf(&position, int(map0x88ToStandard(kingFinal)), occupied, opposingColor(position.toMove)) == 0
+}
+
+/*
+A moveList is a fixed-size list which the move generators add moves to. No
+position reachable in a game has more than 218 legal moves, so the list can be
+kept on the stack and reused, rather than allocating a slice for the moves of
+every position the search visits.
+*/
+type moveList struct {
+	moves [maxMoves]move
+	count int
+}
+
+const maxMoves = 256
+
+// Add a move to the end of the list.
+func (list *moveList) add(m move) {
+	list.moves[list.count] = m
+	list.count++
+}
+
+// Get the moves in the list. The slice shares the list's storage.
+func (list *moveList) slice() []move {
+	return list.moves[:list.count]
+}
+
+/*
+The kinds of moves a stage of generation produces. Captures are every move
+which changes the material on the board: captures, including en passant, and
+promotions. Quiets are every other move, including castling.
+*/
+type moveKinds byte
+
+const captureKind moveKinds = 1
+const quietKind moveKinds = 2
+const allKinds = captureKind | quietKind
+
+// Add the castling moves of the side to move to a list.
+func generateCastlingMoves(position *position, list *moveList) {
+	// The enemy's attack map is only found once a castle's path is empty,
+	// which is rare, and is then shared by both castles.
+	var attacked uint64
+	found := false
+
+	for _, side := range [...]int{KingCastle, QueenCastle} {
+		if !getCastle(position.castling, side, position.toMove) || !castlingPathEmpty(*position, side) {
+			continue
+		}
+
+		if !found {
+			occupied := position.occupied[0] | position.occupied[1]
+			attacked = generateAttackMap(&position.pieces, occupied, opposingColor(position.toMove)).attacked
+			found = true
+		}
+
+		if clearToCastle(*position, side, attacked) {
+			list.add(move(side))
+		}
+	}
+}
+
+// Add each promotion of a pawn moving between two indices to a list.
+func addPromotions(list *moveList, from int, to int, capture bool) {
+	for _, pieceType := range [...]byte{Knight, Bishop, Rook, Queen} {
+		if capture {
+			list.add(createPromotionCaptureMove(from, to, pieceType))
 		} else {
-			attackingColor = White
+			list.add(createPromotionMove(from, to, pieceType))
 		}
+	}
+}
 
-		if isAttacked(position, attackingColor, index) {
-			return false
+// Add a move from an index to each square of a bitboard of targets to a list,
+// capturing on the squares of the enemies.
+func addMoves(list *moveList, from int, targets uint64, enemies uint64) {
+	for ; targets != 0; targets &= targets - 1 {
+		square := bits.TrailingZeros64(targets)
+
+		if enemies&(1<<square) != 0 {
+			list.add(createCaptureMove(from, standardTo0x88(square)))
+		} else {
+			list.add(createQuietMove(from, standardTo0x88(square)))
 		}
 	}
+}
 
-	return true
+/*
+The restrictions on the moves of the side to move which keep its king out of
+check. checkers holds the pieces giving check, and pinned the side's pieces
+which stand alone between their king and an enemy slider, and so can only move
+along the line between them. Every move but the king's must end on one of the
+targets, which while in check are the checker and the squares between it and
+the king. In double check there are none, and only the king can move.
+
+A side without a king has no restrictions. Neither do pseudo-legal moves, which
+are found with unrestricted.
+*/
+type moveRestrictions struct {
+	legal    bool
+	king     int
+	checkers uint64
+	pinned   uint64
+	targets  uint64
 }
 
-// Generate a slice of legal moves involving castling.
-func generateCastlingMoves(position position) []move {
-	var moves []move
+var unrestricted = moveRestrictions{targets: ^uint64(0)}
 
-	var attackingColor byte
-	if position.toMove == White {
-		attackingColor = Black
-	} else {
-		attackingColor = White
+// Find the restrictions on the moves of the side to move.
+func findRestrictions(position *position) moveRestrictions {
+	side := sideIndex(position.toMove)
+	king := position.kings[side]
+
+	if king < 0 {
+		return unrestricted
+	}
+
+	restrictions := moveRestrictions{legal: true, king: king, targets: ^uint64(0)}
+
+	enemies := &position.pieces[1-side]
+	occupied := position.occupied[0] | position.occupied[1]
+
+	restrictions.checkers = attackersOf(position, restrictions.king, occupied, opposingColor(position.toMove))
+
+	switch bits.OnesCount64(restrictions.checkers) {
+	case 0:
+	case 1:
+		restrictions.targets = restrictions.checkers | betweenTable[restrictions.king][bits.TrailingZeros64(restrictions.checkers)]
+	default:
+		restrictions.targets = 0
 	}
 
-	if getCastle(position.castling, KingCastle, position.toMove) && clearToCastle(position, KingCastle) && !isKingInCheck(position, attackingColor) {
-		moves = append(moves, move(KingCastle))
+	// Find the sliders which would attack the king if the side's pieces were
+	// out of the way. A piece is pinned if it's the only piece between the
+	// king and one of them.
+	snipers := rookAttacksFrom(restrictions.king, position.occupied[1-side])&(enemies[Rook]|enemies[Queen]) |
+		bishopAttacksFrom(restrictions.king, position.occupied[1-side])&(enemies[Bishop]|enemies[Queen])
+
+	for ; snipers != 0; snipers &= snipers - 1 {
+		blockers := betweenTable[restrictions.king][bits.TrailingZeros64(snipers)] & occupied
+
+		if blockers&(blockers-1) == 0 && blockers&position.occupied[side] != 0 {
+			restrictions.pinned |= blockers
+		}
 	}
 
-	if getCastle(position.castling, QueenCastle, position.toMove) && clearToCastle(position, QueenCastle) && !isKingInCheck(position, attackingColor) {
-		moves = append(moves, move(QueenCastle))
+	return restrictions
+}
+
+// Find the squares the side to move's piece on a standard square, other than
+// its king, may move to under the restrictions.
+func (restrictions *moveRestrictions) allowed(square int) uint64 {
+	if restrictions.pinned&(1<<square) != 0 {
+		return restrictions.targets & lineTable[restrictions.king][square]
 	}
 
-	return moves
+	return restrictions.targets
+}
+
+/*
+Determine whether an en passant capture between two standard squares leaves the
+side to move's king out of check. Since the captured pawn isn't on the square
+the capturing pawn moves to, this is the one move whose legality the checkers
+and pins can't decide: taking both pawns off their rank can uncover an attack
+along it, and the captured pawn may be the checker.
+*/
+func isLegalEnPassant(position *position, restrictions *moveRestrictions, from int, to int) bool {
+	captured := uint64(1) << (from - from%8 + to%8)
+
+	occupied := position.occupied[0] | position.occupied[1]
+	occupied = occupied&^(1<<from|captured) | 1<<to
+
+	return attackersOf(position, restrictions.king, occupied, opposingColor(position.toMove))&^captured == 0
 }
 
-// Generate a slice of legal pawn moves.
-func generatePawnMoves(position position, index int) []move {
-	var moves []move
+// Add the moves of the kinds given of the side to move's pawns to a list, under
+// the restrictions.
+func generatePawnMoves(position *position, list *moveList, restrictions *moveRestrictions, kinds moveKinds) {
+	side := sideIndex(position.toMove)
+	enemies := position.occupied[1-side]
+	empty := ^(position.occupied[0] | position.occupied[1])
 
 	// The offset of pawn moves depends on the colour of the pawn, since they
 	// can only move forwards.
-	var direction int
-	if position.toMove == White {
-		direction = 1
-	} else {
-		direction = -1
+	forward := 16
+	if position.toMove == Black {
+		forward = -16
 	}
 
-	// If the pawn is on the starting row, it can perform a double push and move
-	// forward two spaces.
-	if isOnStartingRow(index, position.toMove) {
-		newIndex := index + 32*direction
-		jumpIndex := index + 16*direction
+	for pawns := position.pieces[side][Pawn]; pawns != 0; pawns &= pawns - 1 {
+		square := bits.TrailingZeros64(pawns)
+		index := standardTo0x88(square)
+		allowed := restrictions.allowed(square)
+
+		// Generate a regular move forwards if the square in front is empty,
+		// and if the pawn is on the starting row, a double push if the square
+		// beyond it is empty too. Moves to the final rank are promotions.
+		pushIndex := index + forward
+		push := uint64(1) << map0x88ToStandard(pushIndex)
+
+		if empty&push != 0 {
+			promotes := isOnFinalRank(pushIndex, position.toMove)
+
+			if allowed&push != 0 {
+				if promotes && kinds&captureKind != 0 {
+					addPromotions(list, index, pushIndex, false)
+				} else if !promotes && kinds&quietKind != 0 {
+					list.add(createQuietMove(index, pushIndex))
+				}
+			}
+
+			jumpIndex := pushIndex + forward
 
-		if !piecePresent(position, jumpIndex) && !piecePresent(position, newIndex) {
-			moves = append(moves, createDoublePawnPush(index, newIndex))
+			if kinds&quietKind != 0 && isOnStartingRow(index, position.toMove) && empty&allowed&(1<<map0x88ToStandard(jumpIndex)) != 0 {
+				list.add(createDoublePawnPush(index, jumpIndex))
+			}
 		}
-	}
 
-	// Generate a regular move forwards, and check that the target square is not
-	// occupied.
-	newIndex := index + 16*direction
+		if kinds&captureKind == 0 {
+			continue
+		}
 
-	if !piecePresent(position, newIndex) {
-		// If the pawn is moving to the final rank, generate promotions.
-		if isOnFinalRank(newIndex, position.toMove) {
-			moves = append(moves, createPromotionMove(index, newIndex, Knight))
-			moves = append(moves, createPromotionMove(index, newIndex, Rook))
-			moves = append(moves, createPromotionMove(index, newIndex, Queen))
-			moves = append(moves, createPromotionMove(index, newIndex, Bishop))
-		} else {
-			// Otherwise, generate a quiet move.
-			moves = append(moves, createQuietMove(index, newIndex))
+		// Generate captures of the enemies on the squares the pawn attacks.
+		for captures := pawnAttackTable[side][square] & enemies & allowed; captures != 0; captures &= captures - 1 {
+			captureIndex := standardTo0x88(bits.TrailingZeros64(captures))
+
+			if isOnFinalRank(captureIndex, position.toMove) {
+				addPromotions(list, index, captureIndex, true)
+			} else {
+				list.add(createCaptureMove(index, captureIndex))
+			}
 		}
 
+		// If the en passant target saved in the current position is attacked
+		// by the pawn, generate an en passant move.
+		if position.enPassantTarget == NoEnPassant {
+			continue
+		}
+
+		target := int(map0x88ToStandard(int(position.enPassantTarget)))
+
+		if pawnAttackTable[side][square]&(1<<target) != 0 && (!restrictions.legal || isLegalEnPassant(position, restrictions, square, target)) {
+			list.add(createEnPassantCaptureMove(index, int(position.enPassantTarget)))
+		}
 	}
+}
 
-	// Generate attacks.
-	leftAttack := index + 15*direction
-	rightAttack := index + 17*direction
+// Add the moves of the kinds given of the side to move's pieces to a list,
+// under the restrictions.
+func generateRestrictedMoves(position *position, list *moveList, restrictions *moveRestrictions, kinds moveKinds) {
+	side := sideIndex(position.toMove)
+	own := position.occupied[side]
+	enemies := position.occupied[1-side]
+	occupied := own | enemies
+
+	// Pieces other than pawns can only capture on the squares of the enemies,
+	// and only move quietly to empty squares.
+	var destinations uint64
+	if kinds&captureKind != 0 {
+		destinations |= enemies
+	}
+	if kinds&quietKind != 0 {
+		destinations |= ^occupied
+	}
 
-	attackIndices := [2]int{leftAttack, rightAttack}
+	// In double check, only the king can move.
+	if restrictions.targets != 0 {
+		generatePawnMoves(position, list, restrictions, kinds)
 
-	// For each attack, check if a capture is possible.
-	for _, attackIndex := range attackIndices {
-		if isOnBoard(attackIndex) && piecePresent(position, attackIndex) && position.board[attackIndex].color() != position.toMove {
-			// If the pawn is capturing a piece on the final rank, generate
-			// promotion captures.
-			if isOnFinalRank(attackIndex, position.toMove) {
-				moves = append(moves, createPromotionCaptureMove(index, attackIndex, Knight))
-				moves = append(moves, createPromotionCaptureMove(index, attackIndex, Bishop))
-				moves = append(moves, createPromotionCaptureMove(index, attackIndex, Rook))
-				moves = append(moves, createPromotionCaptureMove(index, attackIndex, Queen))
-			} else {
-				// Otherwise, generate a regular capture.
-				moves = append(moves, createCaptureMove(index, attackIndex))
+		for _, identity := range [...]piece{Knight, Bishop, Rook, Queen} {
+			for pieces := position.pieces[side][identity]; pieces != 0; pieces &= pieces - 1 {
+				square := bits.TrailingZeros64(pieces)
+				targets := attacksFrom(identity, square, occupied) & restrictions.allowed(square) & destinations
+
+				addMoves(list, standardTo0x88(square), targets, enemies)
+			}
+		}
+	}
+
+	for kings := position.pieces[side][King]; kings != 0; kings &= kings - 1 {
+		square := bits.TrailingZeros64(kings)
+		targets := kingAttackTable[square] & destinations
+
+		// The king can't move to an attacked square. It's taken off the board
+		// first, so that a slider checking it still attacks the squares behind
+		// it.
+		if restrictions.legal {
+			for remaining := targets; remaining != 0; remaining &= remaining - 1 {
+				target := bits.TrailingZeros64(remaining)
+
+				if attackersOf(position, target, occupied&^(1<<square), opposingColor(position.toMove)) != 0 {
+					targets &^= 1 << target
+				}
 			}
 		}
 
+		addMoves(list, standardTo0x88(square), targets, enemies)
 	}
 
-	// If the en passant target saved in the current position is capturable by
-	// the pawn, generate an en passant move.
-	if isEnPassantTarget(position, index, direction) {
-		moves = append(moves, createEnPassantCaptureMove(index, int(position.enPassantTarget)))
+	if kinds&quietKind != 0 && position.pieces[side][King] != 0 && restrictions.checkers == 0 {
+		generateCastlingMoves(position, list)
 	}
+}
+
+/*
+The search generates moves in stages, so that it can stop once a move causes a
+cutoff without having generated the rest. Each stage adds the legal moves of
+one kind to a list, given the restrictions on the position, which are found
+once for all of its stages.
+*/
 
-	return moves
+// Add the captures and promotions of the side to move to a list.
+func generateCaptures(position *position, restrictions *moveRestrictions, list *moveList) {
+	generateRestrictedMoves(position, list, restrictions, captureKind)
 }
 
-// Generate a slice of moves for a non-pawn piece.
-func generateRegularMoves(position position, index int, piece piece) []move {
-	var moves []move
+// Add the moves of the side to move which aren't captures or promotions to a
+// list.
+func generateQuiets(position *position, restrictions *moveRestrictions, list *moveList) {
+	generateRestrictedMoves(position, list, restrictions, quietKind)
+}
 
-	// For each offset in the piece's offset map, attempt to make a move.
-	for _, offset := range moveOffsets[piece.identity()] {
-		newIndex := index
+// Add the moves of the side to move out of check to a list. These are the king's
+// moves, and while there's only one checker, capturing it or blocking its
+// attack.
+func generateEvasions(position *position, restrictions *moveRestrictions, list *moveList) {
+	generateRestrictedMoves(position, list, restrictions, allKinds)
+}
 
-		// Slide along the offset for as long as possible, generating the attack
-		// rays for sliding pieces (such as queens).
-		for {
-			newIndex = newIndex + offset
+/*
+Add the quiet moves of the side to move which give check to a list. A piece
+gives check directly by moving to one of the squares from which it attacks the
+enemy king, and a piece which stands alone between the king and one of the
+side's sliders gives check by moving off the line between them. Only castling,
+which checks with the rook, is rare enough to be found by making the move.
+*/
+func generateQuietChecks(position *position, restrictions *moveRestrictions, list *moveList) {
+	side := sideIndex(position.toMove)
+	king := position.kings[1-side]
 
-			// If the new position is off the board, stop sliding.
-			if !isOnBoard(newIndex) {
-				break
-			}
+	if king < 0 {
+		return
+	}
 
-			var newMove move
-			if piecePresent(position, newIndex) {
-				// If the sliding piece encounters another piece of its own
-				// colour, stop sliding.
-				if position.board[newIndex].color() == position.toMove {
-					break
-				}
+	own := position.occupied[side]
+	occupied := own | position.occupied[1-side]
+	empty := ^occupied
+	pieces := &position.pieces[side]
 
-				// If it encounters a piece of a different colour, capture that
-				// piece.
-				newMove = createCaptureMove(index, newIndex)
-				moves = append(moves, newMove)
+	// Find the side's pieces which give a discovered check by moving.
+	var discoverers uint64
 
-				break
-			} else {
-				// If there is no piece present, generate a quiet move to the
-				// current index.
-				newMove = createQuietMove(index, newIndex)
-			}
+	snipers := rookAttacksFrom(king, 0)&(pieces[Rook]|pieces[Queen]) | bishopAttacksFrom(king, 0)&(pieces[Bishop]|pieces[Queen])
 
-			moves = append(moves, newMove)
+	for ; snipers != 0; snipers &= snipers - 1 {
+		blockers := betweenTable[king][bits.TrailingZeros64(snipers)] & occupied
 
-			// If the piece isn't a sliding piece (i.e. the king and knight),
-			// only slide once.
-			if !piece.isSliding() {
-				break
-			}
+		if blockers != 0 && blockers&(blockers-1) == 0 && blockers&own != 0 {
+			discoverers |= blockers
 		}
 	}
 
-	return moves
-}
+	// The squares from which each piece attacks the king. A pawn attacks the
+	// king from the squares an enemy pawn on its square would attack.
+	checkSquares := [8]uint64{
+		Pawn:   pawnAttackTable[1-side][king],
+		Knight: knightAttackTable[king],
+		Bishop: bishopAttacksFrom(king, occupied),
+		Rook:   rookAttacksFrom(king, occupied),
+	}
+	checkSquares[Queen] = checkSquares[Bishop] | checkSquares[Rook]
 
-// Given a position, generate a slice of moves representing all the possible
-// moves for the attacking player. This function generates pseudo-legal moves,
-// meaning that the move may cause the player to move into check, which is
-// illegal. These moves are filtered in a later step.
-func generateMoves(position position) []move {
-	var moves []move
+	// Find the squares a piece checks from, including those off the line of a
+	// discovered check.
+	checks := func(identity piece, square int) uint64 {
+		if discoverers&(1<<square) != 0 {
+			return checkSquares[identity] | ^lineTable[king][square]
+		}
 
-	// For each piece of the player's colour, generate all possible moves.
-	var piece piece
-	for i := 0; i < BoardSize; i++ {
+		return checkSquares[identity]
+	}
 
-		piece = position.board[i]
+	forward := 8
+	if position.toMove == Black {
+		forward = -8
+	}
 
-		if isOnBoard(i) && position.board[i].exists() && piece.color() == position.toMove {
-			var pieceMoves []move
+	// Pawn moves to the final rank are promotions, which aren't quiet.
+	for pawns := pieces[Pawn]; pawns != 0; pawns &= pawns - 1 {
+		square := bits.TrailingZeros64(pawns)
+		targets := checks(Pawn, square) & restrictions.allowed(square)
+		push := square + forward
 
-			if piece.is(King) {
-				pieceMoves = append(pieceMoves, generateCastlingMoves(position)...)
-			}
+		if empty&(1<<push) == 0 || isOnFinalRank(standardTo0x88(push), position.toMove) {
+			continue
+		}
 
-			if piece.is(Pawn) {
-				pieceMoves = append(pieceMoves, generatePawnMoves(position, i)...)
+		if targets&(1<<push) != 0 {
+			list.add(createQuietMove(standardTo0x88(square), standardTo0x88(push)))
+		}
 
-			} else {
-				pieceMoves = append(pieceMoves, generateRegularMoves(position, i, piece)...)
+		if jump := push + forward; isOnStartingRow(standardTo0x88(square), position.toMove) && empty&targets&(1<<jump) != 0 {
+			list.add(createDoublePawnPush(standardTo0x88(square), standardTo0x88(jump)))
+		}
+	}
+
+	for _, identity := range [...]piece{Knight, Bishop, Rook, Queen} {
+		for remaining := pieces[identity]; remaining != 0; remaining &= remaining - 1 {
+			square := bits.TrailingZeros64(remaining)
+			targets := attacksFrom(identity, square, occupied) & empty & checks(identity, square) & restrictions.allowed(square)
+
+			addMoves(list, standardTo0x88(square), targets, 0)
+		}
+	}
+
+	// The king can only give a discovered check, and can't move into check.
+	for kings := pieces[King] & discoverers; kings != 0; kings &= kings - 1 {
+		square := bits.TrailingZeros64(kings)
+		targets := kingAttackTable[square] & empty &^ lineTable[king][square]
+
+		if restrictions.legal {
+			for remaining := targets; remaining != 0; remaining &= remaining - 1 {
+				target := bits.TrailingZeros64(remaining)
+
+				if attackersOf(position, target, occupied&^(1<<square), opposingColor(position.toMove)) != 0 {
+					targets &^= 1 << target
+				}
 			}
+		}
+
+		addMoves(list, standardTo0x88(square), targets, 0)
+	}
+
+	if pieces[King] != 0 && restrictions.checkers == 0 {
+		var castles moveList
+		generateCastlingMoves(position, &castles)
 
-			moves = append(moves, pieceMoves...)
+		for _, move := range castles.slice() {
+			if givesCheck(position, move) {
+				list.add(move)
+			}
 		}
+	}
+}
 
+/*
+Determine whether a legal move gives check. Most moves only change the attacks
+on the enemy king by moving a piece from one square to another, so the check
+can be found from the occupied squares after the move: either the moved piece
+attacks the king, or one of the side's sliders does now that the piece is out
+of its way. Castling, promotions and en passant are rare enough to be made.
+*/
+func givesCheck(position *position, move move) bool {
+	attackingColor := position.toMove
+	side := sideIndex(attackingColor)
+
+	king := position.kings[1-side]
+	if king < 0 {
+		return false
 	}
 
-	return moves
+	if move.isCastle() || move.isPromotion() || move.isEnPassantCapture() {
+		artifacts := makeMove(position, move)
+		check := isKingInCheck(*position, attackingColor)
+		unmakeMove(position, move, artifacts)
+
+		return check
+	}
+
+	from := uint64(1) << map0x88ToStandard(int(move.From()))
+	to := int(map0x88ToStandard(int(move.To())))
+	identity := position.board[move.From()].identity()
+
+	occupied := (position.occupied[0]|position.occupied[1])&^from | 1<<to
+
+	var attacks uint64
+	if identity == Pawn {
+		attacks = pawnAttackTable[side][to]
+	} else {
+		attacks = attacksFrom(identity, to, occupied)
+	}
+
+	if attacks&(1<<king) != 0 {
+		return true
+	}
+
+	pieces := &position.pieces[side]
+
+	return (bishopAttacksFrom(king, occupied)&(pieces[Bishop]|pieces[Queen])|
+		rookAttacksFrom(king, occupied)&(pieces[Rook]|pieces[Queen]))&^from != 0
 }
 
 // Given a position, generate a slice of moves representing all the possible
-// legal moves for the attacking player.
-func generateLegalMoves(position position) []move {
-	var legal []move
+// moves for the attacking player. This function generates pseudo-legal moves,
+// meaning that the move may cause the player to move into check, which is
+// illegal.
+func generateMoves(position position) []move {
+	var list moveList
+	generateRestrictedMoves(&position, &list, &unrestricted, allKinds)
 
-	// Generate pseudo-legal moves.
-	moves := generateMoves(position)
+	return append([]move(nil), list.slice()...)
+}
 
-	// For each pseudo-legal move, make the move, then see if the king is in
-	// check. If it isn't, the move is legal.
-	for _, move := range moves {
-		artifacts := makeMove(&position, move)
-		if !isKingInCheck(position, position.toMove) {
-			legal = append(legal, move)
-		}
-		unmakeMove(&position, move, artifacts)
-	}
+// Given a position, generate a slice of moves representing all the possible
+// legal moves for the attacking player. Rather than making each move to see
+// whether it leaves the king in check, the checkers and pinned pieces are found
+// once, and only the moves they allow are generated.
+func generateLegalMoves(position position) []move {
+	var list moveList
+	restrictions := findRestrictions(&position)
+	generateRestrictedMoves(&position, &list, &restrictions, allKinds)
 
-	return legal
+	return append([]move(nil), list.slice()...)
 }
 
 // Determine whether the king is in check, given a position and an attacking
-// colour.
+// colour. A side without a king can't be in check.
 func isKingInCheck(position position, attackingColor byte) bool {
-	// Find the index of the king on the board.
-	var kingIndex int
-	for i := 0; i < BoardSize; i++ {
-		piece := position.board[i]
-
-		if isOnBoard(i) && piece.exists() && piece.is(King) && piece.color() != attackingColor {
-			kingIndex = i
-			break
-		}
+	king := position.kings[sideIndex(opposingColor(attackingColor))]
+	if king < 0 {
+		return false
 	}
 
-	// Determine whether the index is attacked.
-	return isAttacked(position, attackingColor, kingIndex)
+	return isAttacked(position, attackingColor, standardTo0x88(king))
 }
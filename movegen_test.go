@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"testing"
 )
 
@@ -25,7 +26,7 @@ func TestCheck(t *testing.T) {
 	}
 
 	for _, test := range cases {
-		position := fromFEN(test.fen)
+		position := mustParseFEN(test.fen)
 
 		var attackingColor byte
 		if position.toMove == White {
@@ -63,7 +64,7 @@ func TestLegalMoveGen(t *testing.T) {
 	}
 
 	for _, test := range cases {
-		position := fromFEN(test.fen)
+		position := mustParseFEN(test.fen)
 
 		moves := generateLegalMoves(position)
 
@@ -125,7 +126,7 @@ func TestMoveGen(t *testing.T) {
 	}
 
 	for _, test := range cases {
-		position := fromFEN(test.fen)
+		position := mustParseFEN(test.fen)
 
 		moves := generateMoves(position)
 
@@ -134,3 +135,217 @@ func TestMoveGen(t *testing.T) {
 		}
 	}
 }
+
+func TestChess960Castling(t *testing.T) {
+	// The position after castling, or an empty string if the castle is illegal.
+	cases := []struct {
+		name     string
+		fen      string
+		side     int
+		expected string
+	}{
+		{"King doesn't move", "4k3/8/8/8/8/8/8/6KR w K - 0 1", KingCastle, "4k3/8/8/8/8/8/8/5RK1 b - - 1 1"},
+		{"Rook doesn't move", "4k3/8/8/8/8/8/8/3RK3 w Q - 0 1", QueenCastle, "4k3/8/8/8/8/8/8/2KR4 b - - 1 1"},
+		{"King and rook swap kingside", "4k3/8/8/8/8/8/8/5KR1 w K - 0 1", KingCastle, "4k3/8/8/8/8/8/8/5RK1 b - - 1 1"},
+		{"King and rook swap queenside", "4k3/8/8/8/8/8/8/2RK4 w Q - 0 1", QueenCastle, "4k3/8/8/8/8/8/8/2KR4 b - - 1 1"},
+		{"Black king beside the corner", "rk6/8/8/8/8/8/8/4K3 b q - 0 1", QueenCastle, "2kr4/8/8/8/8/8/8/4K3 w - - 1 2"},
+		{"Inner rook", "4k3/8/8/8/8/8/8/RR2K3 w B - 0 1", QueenCastle, "4k3/8/8/8/8/8/8/R1KR4 b - - 1 1"},
+		{"Piece on the rook's final square", "4k3/8/8/8/8/8/8/RK1N4 w Q - 0 1", QueenCastle, ""},
+		{"Piece on the king's final square", "4k3/8/8/8/8/8/8/1K3RBR w H - 0 1", KingCastle, ""},
+		{"King crosses an attacked square", "3rk3/8/8/8/8/8/8/1K5R w K - 0 1", KingCastle, ""},
+		{"Rook crosses an attacked square", "1r2k3/8/8/8/8/8/8/1R3K2 w Q - 0 1", QueenCastle, "1r2k3/8/8/8/8/8/8/2KR4 b - - 1 1"},
+		{"Rook shields the king's final square", "4k3/8/8/8/8/8/8/rRK5 w Q - 0 1", QueenCastle, ""},
+	}
+
+	for _, test := range cases {
+		position := mustFromFEN(test.fen)
+
+		var castle move
+		for _, move := range generateLegalMoves(position) {
+			if move.isCastle() && move.castleSide() == test.side {
+				castle = move
+			}
+		}
+
+		if castle == 0 {
+			if test.expected != "" {
+				t.Errorf("Chess960 castling test (%v) failed!\nExpected a legal castle\n", test.name)
+			}
+
+			continue
+		}
+
+		artifacts := makeMove(&position, castle)
+		if after := toFEN(position); after != test.expected {
+			t.Errorf("Chess960 castling test (%v) failed!\nExpected: %v\nActual: %v\n", test.name, test.expected, after)
+		}
+
+		unmakeMove(&position, castle, artifacts)
+		if before := toFEN(position); before != toFEN(mustFromFEN(test.fen)) {
+			t.Errorf("Chess960 castling test (%v) failed!\nUnmaking gave: %v\n", test.name, before)
+		}
+	}
+}
+
+func TestPinsAndChecks(t *testing.T) {
+	cases := []testCase{
+		{"Pinned rook moves along the pin", "4k3/4r3/8/8/8/8/4R3/4K3 w - - 0 1", 9},
+		{"Pinned knight can't move", "4k3/4r3/8/8/8/8/4N3/4K3 w - - 0 1", 4},
+		{"Pinned bishop captures the pinner", "4k3/8/8/8/7q/8/5B2/4K3 w - - 0 1", 6},
+		{"King can't retreat along the checking line", "4k3/4r3/8/8/8/8/4K3/8 w - - 0 1", 6},
+		{"Double check only moves the king", "4r2k/8/8/8/1b6/8/8/1R2K3 w - - 0 1", 3},
+		{"Block or capture the checker", "4k3/4r3/8/8/8/8/1B6/R3K3 w - - 0 1", 5},
+		{"En passant captures the checker", "8/8/8/2k5/3Pp3/8/8/4K3 b - d3 0 1", 9},
+		{"En passant uncovers an attack along the rank", "8/8/8/KPp4r/8/8/8/7k w - c6 0 1", 4},
+		{"En passant by a pinned pawn", "8/8/5k2/8/3pP3/8/1B6/4K3 b - e3 0 1", 7},
+	}
+
+	for _, test := range cases {
+		position := mustParseFEN(test.fen)
+
+		if moves := generateLegalMoves(position); len(moves) != test.expectedMoves {
+			t.Errorf("Pin and check test (%v) failed!\nExpected: %v\nActual: %v\n", test.name, test.expectedMoves, len(moves))
+		}
+	}
+}
+
+func TestLegalMovesMatchFiltered(t *testing.T) {
+	// Check the legal moves against the pseudo-legal moves which don't leave the
+	// king in check, throughout the first plies of tricky positions.
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"8/8/1k6/2b5/2pP4/8/5K2/8 b - d3 0 1",
+	}
+
+	var walk func(position position, depth int)
+	walk = func(position position, depth int) {
+		legal := generateLegalMoves(position)
+
+		var filtered []move
+		for _, move := range generateMoves(position) {
+			artifacts := makeMove(&position, move)
+			if !isKingInCheck(position, position.toMove) {
+				filtered = append(filtered, move)
+			}
+			unmakeMove(&position, move, artifacts)
+		}
+
+		if fmt.Sprint(sortedMoves(legal)) != fmt.Sprint(sortedMoves(filtered)) {
+			t.Errorf("Legal move test failed!\nFEN: %v\nExpected: %v\nActual: %v\n", toFEN(position), sortedMoves(filtered), sortedMoves(legal))
+			return
+		}
+
+		if depth == 1 {
+			return
+		}
+
+		for _, move := range legal {
+			artifacts := makeMove(&position, move)
+			walk(position, depth-1)
+			unmakeMove(&position, move, artifacts)
+		}
+	}
+
+	for _, fen := range fens {
+		walk(mustParseFEN(fen), 3)
+	}
+}
+
+// Sort a copy of a slice of moves, so that two generators can be compared.
+func sortedMoves(moves []move) []move {
+	sorted := append([]move(nil), moves...)
+	sort.Slice(sorted, func(i int, j int) bool { return sorted[i] < sorted[j] })
+
+	return sorted
+}
+
+func TestMoveStages(t *testing.T) {
+	// Check that the stages split the legal moves between them, throughout the
+	// first plies of tricky positions.
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"8/8/1k6/2b5/2pP4/8/5K2/8 b - d3 0 1",
+		"4k3/8/8/8/8/8/8/4K2R w K - 0 1",
+		"5k2/8/8/8/8/8/8/4K2R w K - 0 1",
+		"4k3/8/8/8/8/8/4K3/4R3 w - - 0 1",
+		"7k/8/8/3n4/8/8/1P2N3/B3R1K1 w - - 0 1",
+	}
+
+	var walk func(position position, depth int)
+	walk = func(position position, depth int) {
+		restrictions := findRestrictions(&position)
+		legal := generateLegalMoves(position)
+
+		var captures, quiets, checks, expectedChecks moveList
+		generateCaptures(&position, &restrictions, &captures)
+		generateQuiets(&position, &restrictions, &quiets)
+		generateQuietChecks(&position, &restrictions, &checks)
+
+		for _, move := range captures.slice() {
+			if !move.isCapture() && !move.isPromotion() {
+				t.Errorf("Move stage test failed!\nFEN: %v\nCapture stage gave %v\n", toFEN(position), toAlgebraic(position, move))
+			}
+		}
+
+		for _, move := range quiets.slice() {
+			artifacts := makeMove(&position, move)
+			if isKingInCheck(position, opposingColor(position.toMove)) {
+				expectedChecks.add(move)
+			}
+			unmakeMove(&position, move, artifacts)
+		}
+
+		if staged := append(captures.slice(), quiets.slice()...); fmt.Sprint(sortedMoves(staged)) != fmt.Sprint(sortedMoves(legal)) {
+			t.Errorf("Move stage test failed!\nFEN: %v\nExpected: %v\nActual: %v\n", toFEN(position), sortedMoves(legal), sortedMoves(staged))
+		}
+
+		if fmt.Sprint(sortedMoves(checks.slice())) != fmt.Sprint(sortedMoves(expectedChecks.slice())) {
+			t.Errorf("Quiet check test failed!\nFEN: %v\nExpected: %v\nActual: %v\n", toFEN(position), sortedMoves(expectedChecks.slice()), sortedMoves(checks.slice()))
+		}
+
+		if restrictions.checkers != 0 {
+			var evasions moveList
+			generateEvasions(&position, &restrictions, &evasions)
+
+			if fmt.Sprint(sortedMoves(evasions.slice())) != fmt.Sprint(sortedMoves(legal)) {
+				t.Errorf("Evasion test failed!\nFEN: %v\nExpected: %v\nActual: %v\n", toFEN(position), sortedMoves(legal), sortedMoves(evasions.slice()))
+			}
+		}
+
+		if depth == 1 {
+			return
+		}
+
+		for _, move := range legal {
+			artifacts := makeMove(&position, move)
+			walk(position, depth-1)
+			unmakeMove(&position, move, artifacts)
+		}
+	}
+
+	for _, fen := range fens {
+		walk(mustParseFEN(fen), 3)
+	}
+}
+
+func TestMoveStagesDontAllocate(t *testing.T) {
+	position := mustParseFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+
+	var list moveList
+	allocations := testing.AllocsPerRun(100, func() {
+		restrictions := findRestrictions(&position)
+
+		list.count = 0
+		generateCaptures(&position, &restrictions, &list)
+		generateQuiets(&position, &restrictions, &list)
+	})
+
+	if allocations != 0 {
+		t.Errorf("Move stage allocation test failed!\nExpected: 0\nActual: %v\n", allocations)
+	}
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+/*
+The neural network evaluation is an efficiently updatable neural network
+(NNUE), an alternative to the hand-written evaluation which is used when the
+Use NNUE option is enabled and a network has been loaded.
+
+The network has a HalfKP input layer. From each side's perspective, every
+non-king piece on the board activates one input, determined by that side's king
+square and the piece's type, colour and square, giving 64 * 10 * 64 inputs.
+Squares are mirrored vertically for black, so that both sides see the board
+the same way. Each side's inputs feed a hidden layer of nnueHiddenSize neurons,
+known as the accumulator.
+
+The accumulators for both sides are stored in the position, and kept up to date
+as pieces are placed and removed in makeMove and unmakeMove. Only a king move
+requires a side's accumulator to be rebuilt from the whole board, since it
+changes every one of that side's inputs.
+
+To evaluate a position, the two accumulators are joined, with the side to move
+first, passed through a clipped ReLU, and combined by the output layer into a
+score for the side to move.
+
+All arithmetic is in integers. The input layer weights and biases are quantised
+by nnueQA, the output weights by nnueQB and the output bias by both, so the
+output is divided by nnueQA * nnueQB and scaled by nnueScale to give a score in
+centipawns.
+*/
+
+const nnueKingSquares = 64
+const nnuePieceTypes = 10
+const nnueInputSize = nnueKingSquares * nnuePieceTypes * 64
+const nnueHiddenSize = 128
+
+const nnueQA = 255
+const nnueQB = 64
+const nnueScale = 400
+
+/*
+A network file starts with nnueMagic, followed by the format version and the
+hidden layer size as little endian uint32s. The rest of the file is little
+endian, in this order:
+
+	feature weights: nnueInputSize * nnueHiddenSize int16s, grouped by input
+	feature biases:  nnueHiddenSize int16s
+	output weights:  2 * nnueHiddenSize int16s, side to move first
+	output bias:     one int32
+*/
+const nnueMagic = "GCNN"
+const nnueVersion = 1
+
+type nnueNetwork struct {
+	featureWeights []int16
+	featureBiases  [nnueHiddenSize]int16
+	outputWeights  [2 * nnueHiddenSize]int16
+	outputBias     int32
+}
+
+/*
+accumulator holds the hidden layer of each side, indexed by side. kings holds
+the standard square of each side's king that the values were calculated for, or
+-1 if the side has no king, in which case its values are not valid.
+*/
+type accumulator struct {
+	values [2][nnueHiddenSize]int16
+	kings  [2]int8
+}
+
+// The loaded network, or nil if there isn't one, and whether it should be used
+// in place of the hand-written evaluation.
+var nnue *nnueNetwork
+var useNNUE bool
+
+// Map a piece identity to its index among the network's piece types.
+var nnuePieceIndices = [8]int{Pawn: 0, Knight: 1, Bishop: 2, Rook: 3, Queen: 4}
+
+// Find the input activated by a non-king piece on a standard square, from the
+// perspective of the side with the given colour and king square.
+func featureIndex(perspective byte, king int, p piece, square int) int {
+	if perspective == Black {
+		king ^= 56
+		square ^= 56
+	}
+
+	pieceType := nnuePieceIndices[p.identity()] * 2
+	if p.color() != perspective {
+		pieceType++
+	}
+
+	return (king*nnuePieceTypes+pieceType)*64 + square
+}
+
+// Add the weights of an input to an accumulator.
+func addFeature(values *[nnueHiddenSize]int16, feature int) {
+	weights := nnue.featureWeights[feature*nnueHiddenSize : (feature+1)*nnueHiddenSize]
+
+	for i, weight := range weights {
+		values[i] += weight
+	}
+}
+
+// Subtract the weights of an input from an accumulator.
+func subtractFeature(values *[nnueHiddenSize]int16, feature int) {
+	weights := nnue.featureWeights[feature*nnueHiddenSize : (feature+1)*nnueHiddenSize]
+
+	for i, weight := range weights {
+		values[i] -= weight
+	}
+}
+
+// Rebuild both sides' accumulators from the board.
+func refreshAccumulators(position *position) {
+	refreshAccumulator(position, White)
+	refreshAccumulator(position, Black)
+}
+
+// Rebuild the accumulator of one side from the board.
+func refreshAccumulator(position *position, perspective byte) {
+	buildAccumulator(position, perspective, position.kings[sideIndex(perspective)])
+}
+
+// Build the accumulator of one side from the board, with its king on the given
+// standard square, or -1 if it has no king.
+func buildAccumulator(position *position, perspective byte, king int) {
+	side := sideIndex(perspective)
+
+	position.accumulator.kings[side] = int8(king)
+
+	if king == -1 {
+		return
+	}
+
+	values := &position.accumulator.values[side]
+	*values = nnue.featureBiases
+
+	for i := 0; i < BoardSize; i++ {
+		p := position.board[i]
+
+		if isOnBoard(i) && p.exists() && !p.is(King) {
+			addFeature(values, featureIndex(perspective, king, p, int(map0x88ToStandard(i))))
+		}
+	}
+}
+
+/*
+Update the accumulators after the piece removed on a 0x88 index has been
+replaced by the piece added, either of which may be empty. This is called by
+setSquare after the board has been changed.
+
+When a side's king is removed, its accumulator is left invalid until the king is
+placed again, at which point it is rebuilt. While a king moves, it can briefly
+be on the board twice, so the new square is tracked rather than found by
+searching the board.
+*/
+func updateAccumulators(position *position, index int, removed piece, added piece) {
+	square := int(map0x88ToStandard(index))
+
+	for _, perspective := range [2]byte{White, Black} {
+		side := sideIndex(perspective)
+
+		if removed.is(King) && removed.color() == perspective && int(position.accumulator.kings[side]) == square {
+			position.accumulator.kings[side] = -1
+		}
+
+		if added.is(King) && added.color() == perspective {
+			buildAccumulator(position, perspective, square)
+			continue
+		}
+
+		king := int(position.accumulator.kings[side])
+		if king == -1 {
+			continue
+		}
+
+		values := &position.accumulator.values[side]
+
+		if removed.exists() && !removed.is(King) {
+			subtractFeature(values, featureIndex(perspective, king, removed, square))
+		}
+
+		if added.exists() && !added.is(King) {
+			addFeature(values, featureIndex(perspective, king, added, square))
+		}
+	}
+}
+
+// Is the NNUE evaluation available for the position? It needs both kings on the
+// board.
+func canEvaluateNNUE(position position) bool {
+	return nnue != nil && position.accumulator.kings[0] != -1 && position.accumulator.kings[1] != -1
+}
+
+// Evaluate the position with the network, from the perspective of the side to
+// move.
+func evaluateNNUE(position position) int {
+	side := sideIndex(position.toMove)
+	output := int(nnue.outputBias)
+
+	for i := 0; i < nnueHiddenSize; i++ {
+		output += clippedReLU(position.accumulator.values[side][i]) * int(nnue.outputWeights[i])
+		output += clippedReLU(position.accumulator.values[1-side][i]) * int(nnue.outputWeights[nnueHiddenSize+i])
+	}
+
+	return output * nnueScale / (nnueQA * nnueQB)
+}
+
+// Clamp a hidden layer value between 0 and the quantised value of 1.
+func clippedReLU(value int16) int {
+	if value < 0 {
+		return 0
+	}
+
+	if value > nnueQA {
+		return nnueQA
+	}
+
+	return int(value)
+}
+
+// Replace the loaded network, rebuilding the accumulators of the engine's
+// position to match. A nil network unloads it.
+func setNetwork(network *nnueNetwork) {
+	nnue = network
+
+	if nnue != nil {
+		refreshAccumulators(&engineData.position)
+	}
+}
+
+// Check whether a file starts with the network magic number, without reading
+// the rest of it.
+func isNetworkFile(path string) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(nnueMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+
+	return string(magic) == nnueMagic
+}
+
+// Load a network from a file.
+func loadNetwork(path string) (*nnueNetwork, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return readNetwork(bufio.NewReader(file))
+}
+
+// Read a network in the file format.
+func readNetwork(reader io.Reader) (*nnueNetwork, error) {
+	magic := make([]byte, len(nnueMagic))
+	if _, err := io.ReadFull(reader, magic); err != nil {
+		return nil, err
+	}
+
+	if string(magic) != nnueMagic {
+		return nil, errors.New("not a network file")
+	}
+
+	var header [2]uint32
+	if err := binary.Read(reader, binary.LittleEndian, &header); err != nil {
+		return nil, err
+	}
+
+	if header[0] != nnueVersion {
+		return nil, fmt.Errorf("unsupported network version %v", header[0])
+	}
+
+	if header[1] != nnueHiddenSize {
+		return nil, fmt.Errorf("network has %v hidden neurons, expected %v", header[1], nnueHiddenSize)
+	}
+
+	network := &nnueNetwork{featureWeights: make([]int16, nnueInputSize*nnueHiddenSize)}
+
+	for _, data := range []interface{}{network.featureWeights, &network.featureBiases, &network.outputWeights, &network.outputBias} {
+		if err := binary.Read(reader, binary.LittleEndian, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return network, nil
+}
+
+// Save a network to a file.
+func saveNetwork(path string, network *nnueNetwork) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+
+	if err := network.write(writer); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// Write the network in the file format.
+func (network *nnueNetwork) write(writer io.Writer) error {
+	if _, err := io.WriteString(writer, nnueMagic); err != nil {
+		return err
+	}
+
+	header := [2]uint32{nnueVersion, nnueHiddenSize}
+
+	for _, data := range []interface{}{header, network.featureWeights, network.featureBiases, network.outputWeights, network.outputBias} {
+		if err := binary.Write(writer, binary.LittleEndian, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Generate a network with random weights, small enough that the hidden layer
+// values spread across the range of the clipped ReLU.
+func randomNetwork(seed int64) *nnueNetwork {
+	random := rand.New(rand.NewSource(seed))
+	network := &nnueNetwork{featureWeights: make([]int16, nnueInputSize*nnueHiddenSize)}
+
+	for i := range network.featureWeights {
+		network.featureWeights[i] = int16(random.Intn(65) - 32)
+	}
+
+	for i := range network.featureBiases {
+		network.featureBiases[i] = int16(random.Intn(128))
+	}
+
+	for i := range network.outputWeights {
+		network.outputWeights[i] = int16(random.Intn(129) - 64)
+	}
+
+	network.outputBias = int32(random.Intn(2001) - 1000)
+
+	return network
+}
+
+func TestNNUEIncrementalUpdates(t *testing.T) {
+	nnue = randomNetwork(1)
+	defer func() { nnue = nil }()
+
+	random := rand.New(rand.NewSource(2))
+
+	var fens = []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"n1n5/PPPk4/8/8/8/8/4Kppp/5N1N b - - 0 1",
+	}
+
+	for _, fen := range fens {
+		position := mustFromFEN(fen)
+		initial := position
+
+		var moves []move
+		var artifacts []moveArtifacts
+
+		for ply := 0; ply < 40; ply++ {
+			legal := generateLegalMoves(position)
+			if len(legal) == 0 {
+				break
+			}
+
+			move := legal[random.Intn(len(legal))]
+			moves = append(moves, move)
+			artifacts = append(artifacts, makeMove(&position, move))
+
+			checkAccumulators(t, position)
+		}
+
+		for i := len(moves) - 1; i >= 0; i-- {
+			unmakeMove(&position, moves[i], artifacts[i])
+			checkAccumulators(t, position)
+		}
+
+		if position.accumulator != initial.accumulator {
+			t.Errorf("NNUE incremental update failed!\nFEN: %v\nAccumulators changed after unmaking every move\n", fen)
+		}
+	}
+}
+
+// Check that the incrementally updated accumulators of a position match a full
+// refresh, as does the network's output.
+func checkAccumulators(t *testing.T, position position) {
+	refreshed := position
+	refreshAccumulators(&refreshed)
+
+	if position.accumulator != refreshed.accumulator {
+		t.Errorf("NNUE incremental update failed!\nFEN: %v\nAccumulators differ from a full refresh\n", toFEN(position))
+	}
+
+	if evaluateNNUE(position) != evaluateNNUE(refreshed) {
+		t.Errorf("NNUE incremental update failed!\nFEN: %v\nIncremental: %v\nRefreshed: %v\n", toFEN(position), evaluateNNUE(position), evaluateNNUE(refreshed))
+	}
+}
+
+func TestNNUESymmetry(t *testing.T) {
+	nnue = randomNetwork(3)
+	defer func() { nnue = nil }()
+
+	// Mirroring the board and swapping the side to move gives the same position
+	// for the other side.
+	fen := "r3k3/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w - - 0 1"
+
+	original := evaluateNNUE(mustFromFEN(fen))
+	mirrored := evaluateNNUE(mustFromFEN(strings.Replace(mirrorFEN(fen), " w ", " b ", 1)))
+
+	if original != mirrored {
+		t.Errorf("NNUE symmetry failed!\nFEN: %v\nOriginal: %v\nMirrored: %v\n", fen, original, mirrored)
+	}
+}
+
+func TestNetworkRoundtrip(t *testing.T) {
+	dir, err := os.MkdirTemp("", "chess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "network.nnue")
+	network := randomNetwork(4)
+
+	if err := saveNetwork(path, network); err != nil {
+		t.Fatal(err)
+	}
+
+	if !isNetworkFile(path) {
+		t.Errorf("Network file detection failed!\nSaved network was not recognised\n")
+	}
+
+	loaded, err := loadNetwork(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	same := loaded.featureBiases == network.featureBiases && loaded.outputWeights == network.outputWeights && loaded.outputBias == network.outputBias
+	for i := range network.featureWeights {
+		same = same && loaded.featureWeights[i] == network.featureWeights[i]
+	}
+
+	if !same {
+		t.Errorf("Network changed after saving and loading!\n")
+	}
+
+	paramsPath := filepath.Join(dir, "params.json")
+	if err := saveEvalParameters(paramsPath, defaultEvalParameters()); err != nil {
+		t.Fatal(err)
+	}
+
+	if isNetworkFile(paramsPath) {
+		t.Errorf("Network file detection failed!\nEvaluation parameters were recognised as a network\n")
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+/*
+evalParameters holds every weight used by the evaluation, so that they can be
+tuned without recompiling the engine. The parameters in use are stored in
+evalParams, and can be replaced with ones loaded from a JSON file, either with
+the -evalFile command line flag or the EvalFile UCI option.
+
+Fields tagged with tune:"-" are counts or divisors, rather than scores, and are
+left alone by the tune command.
+
+All values are in centipawns. Fields ending in Mg and Eg are the middlegame and
+endgame values of a term. Tables indexed by rank use the rank relative to the
+owner of the piece, so that index 0 is its back rank.
+
+The piece-square tables are laid out as a board viewed from white's side, so
+the first row is the eighth rank. Their values, and the material weights, are
+from Tomasz Michniewski and can be found at
+https://chessprogramming.wikispaces.com/Simplified+evaluation+function.
+*/
+type evalParameters struct {
+	// The base value of each piece. The king's weight is the same for both
+	// sides, so it can't be tuned.
+	KingWeight   int `tune:"-"`
+	QueenWeight  int
+	RookWeight   int
+	BishopWeight int
+	KnightWeight int
+	PawnWeight   int
+
+	// The modifier for each piece depending on its square.
+	PawnPositions   [64]int
+	KnightPositions [64]int
+	BishopPositions [64]int
+	RookPositions   [64]int
+	QueenPositions  [64]int
+	KingPositions   [64]int
+
+	// Bonus for a passed pawn, by rank.
+	PassedPawnMg [8]int
+	PassedPawnEg [8]int
+
+	// Bonus for a passed pawn with no pieces at all between it and promotion,
+	// by rank.
+	PassedFreePathEg [8]int
+
+	// In the endgame, a passed pawn is stronger when the enemy king is far
+	// away from the square in front of it, and the friendly king is close.
+	// These are multiplied by the distance in squares and by how advanced the
+	// pawn is.
+	PassedEnemyKingDistanceEg int
+	PassedOwnKingDistanceEg   int
+
+	// Bonus for a pawn defended by another pawn, by rank.
+	SupportedPawnMg [8]int
+	SupportedPawnEg [8]int
+
+	// Bonus for a pawn standing beside another pawn on the same rank, by rank.
+	PhalanxPawnMg [8]int
+	PhalanxPawnEg [8]int
+
+	IsolatedPawnMg int
+	IsolatedPawnEg int
+	DoubledPawnMg  int
+	DoubledPawnEg  int
+	BackwardPawnMg int
+	BackwardPawnEg int
+
+	// Penalty for each group of pawns on adjacent files beyond the first.
+	PawnIslandMg int
+	PawnIslandEg int
+
+	// The attack units added for each square in the king zone attacked by a
+	// piece of each type.
+	KnightAttackUnits int
+	BishopAttackUnits int
+	RookAttackUnits   int
+	QueenAttackUnits  int
+
+	// The king safety penalty is only applied once this many pieces attack the
+	// king zone.
+	MinimumKingAttackers int `tune:"-"`
+
+	// The king safety penalty for each number of attack units. The weights and
+	// table are from the king safety page of the Chess programming wiki, at
+	// https://chessprogramming.wikispaces.com/King+Safety.
+	KingSafetyTable [100]int
+
+	// Attacks on the king matter much less in the endgame, so the endgame
+	// penalty is the table value divided by this.
+	KingSafetyEndgameDivisor int `tune:"-"`
+
+	// Bonus for the nearest friendly pawn on each file around the king, and
+	// penalty for the nearest enemy pawn, indexed by the number of ranks it
+	// stands in front of the king.
+	KingShieldMg [8]int
+	KingStormMg  [8]int
+
+	// Penalties for a file near the king with no friendly pawns, depending on
+	// whether the enemy has pawns on it (semi-open) or not (open).
+	KingOpenFileMg     int
+	KingSemiOpenFileMg int
+
+	// The average number of safe squares attacked by each piece type, and the
+	// value of each square above or below it, indexed by piece identity.
+	MobilityBaseline [8]int `tune:"-"`
+	MobilityMg       [8]int
+	MobilityEg       [8]int
+
+	// Bonus for having bishops on both colours of square.
+	BishopPairMg int
+	BishopPairEg int
+
+	// Bonuses for a rook on a file with no pawns (open), or no friendly pawns
+	// (semi-open).
+	RookOpenFileMg     int
+	RookOpenFileEg     int
+	RookSemiOpenFileMg int
+	RookSemiOpenFileEg int
+
+	// Bonus for a rook on the seventh rank, when the enemy king is on the
+	// eighth or there are enemy pawns to attack.
+	RookSeventhMg int
+	RookSeventhEg int
+
+	// Bonus for a knight on the fourth to sixth rank, defended by a pawn, which
+	// can never be attacked by an enemy pawn.
+	KnightOutpostMg int
+	KnightOutpostEg int
+
+	// Penalty for each friendly pawn on the same colour of square as a bishop.
+	BadBishopMg int
+	BadBishopEg int
+
+	// Penalty for a bishop trapped on a7 or h7 by a pawn on b6 or g6 (or the
+	// equivalent squares for black).
+	TrappedBishopMg int
+	TrappedBishopEg int
+
+	// Penalty for a rook shut in by its own uncastled king, with at most
+	// TrappedRookMobility moves.
+	TrappedRookMg       int
+	TrappedRookEg       int
+	TrappedRookMobility int `tune:"-"`
+
+	// Penalty for each piece, other than the king, which the enemy wins
+	// material by capturing.
+	HangingPieceMg int
+	HangingPieceEg int
+}
+
+// The parameters used by the evaluation.
+var evalParams = defaultEvalParameters()
+
+// Return the built-in evaluation parameters.
+func defaultEvalParameters() evalParameters {
+	return evalParameters{
+		KingWeight:   10000,
+		QueenWeight:  900,
+		RookWeight:   500,
+		BishopWeight: 300,
+		KnightWeight: 300,
+		PawnWeight:   100,
+
+		PawnPositions: [64]int{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			50, 50, 50, 50, 50, 50, 50, 50,
+			10, 10, 20, 30, 30, 20, 10, 10,
+			5, 5, 10, 25, 25, 10, 5, 5,
+			0, 0, 0, 20, 20, 0, 0, 0,
+			5, -5, -10, 0, 0, -10, -5, 5,
+			5, 10, 10, -20, -20, 10, 10, 5,
+			0, 0, 0, 0, 0, 0, 0, 0,
+		},
+
+		KnightPositions: [64]int{
+			-50, -40, -30, -30, -30, -30, -40, -50,
+			-40, -20, 0, 0, 0, 0, -20, -40,
+			-30, 0, 10, 15, 15, 10, 0, -30,
+			-30, 5, 15, 20, 20, 15, 5, -30,
+			-30, 0, 15, 20, 20, 15, 0, -30,
+			-30, 5, 10, 15, 15, 10, 5, -30,
+			-40, -20, 0, 5, 5, 0, -20, -40,
+			-50, -40, -30, -30, -30, -30, -40, -50,
+		},
+
+		BishopPositions: [64]int{
+			-20, -10, -10, -10, -10, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 10, 10, 5, 0, -10,
+			-10, 5, 5, 10, 10, 5, 5, -10,
+			-10, 0, 10, 10, 10, 10, 0, -10,
+			-10, 10, 10, 10, 10, 10, 10, -10,
+			-10, 5, 0, 0, 0, 0, 5, -10,
+			-20, -10, -10, -10, -10, -10, -10, -20,
+		},
+
+		RookPositions: [64]int{
+			0, 0, 0, 0, 0, 0, 0, 0,
+			5, 10, 10, 10, 10, 10, 10, 5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			-5, 0, 0, 0, 0, 0, 0, -5,
+			0, 0, 0, 5, 5, 0, 0, 0,
+		},
+
+		QueenPositions: [64]int{
+			-20, -10, -10, -5, -5, -10, -10, -20,
+			-10, 0, 0, 0, 0, 0, 0, -10,
+			-10, 0, 5, 5, 5, 5, 0, -10,
+			-5, 0, 5, 5, 5, 5, 0, -5,
+			0, 0, 5, 5, 5, 5, 0, -5,
+			-10, 5, 5, 5, 5, 5, 0, -10,
+			-10, 0, 5, 0, 0, 0, 0, -10,
+			-20, -10, -10, -5, -5, -10, -10, -20,
+		},
+
+		KingPositions: [64]int{
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-30, -40, -40, -50, -50, -40, -40, -30,
+			-20, -30, -30, -40, -40, -30, -30, -20,
+			-10, -20, -20, -20, -20, -20, -20, -10,
+			20, 20, 0, 0, 0, 0, 20, 20,
+			20, 30, 10, 0, 0, 10, 30, 20,
+		},
+
+		PassedPawnMg:              [8]int{0, 0, 5, 10, 20, 35, 60, 0},
+		PassedPawnEg:              [8]int{0, 10, 15, 25, 45, 75, 120, 0},
+		PassedFreePathEg:          [8]int{0, 0, 0, 5, 10, 20, 35, 0},
+		PassedEnemyKingDistanceEg: 5,
+		PassedOwnKingDistanceEg:   2,
+		SupportedPawnMg:           [8]int{0, 0, 5, 8, 12, 20, 35, 0},
+		SupportedPawnEg:           [8]int{0, 0, 3, 5, 10, 15, 25, 0},
+		PhalanxPawnMg:             [8]int{0, 3, 5, 8, 15, 25, 40, 0},
+		PhalanxPawnEg:             [8]int{0, 0, 3, 5, 10, 20, 30, 0},
+		IsolatedPawnMg:            -10,
+		IsolatedPawnEg:            -15,
+		DoubledPawnMg:             -10,
+		DoubledPawnEg:             -25,
+		BackwardPawnMg:            -8,
+		BackwardPawnEg:            -12,
+		PawnIslandMg:              -5,
+		PawnIslandEg:              -10,
+
+		KnightAttackUnits:    2,
+		BishopAttackUnits:    2,
+		RookAttackUnits:      3,
+		QueenAttackUnits:     5,
+		MinimumKingAttackers: 2,
+
+		KingSafetyTable: [100]int{
+			0, 0, 1, 2, 3, 5, 7, 9, 12, 15,
+			18, 22, 26, 30, 35, 39, 44, 50, 56, 62,
+			68, 75, 82, 85, 89, 97, 105, 113, 122, 131,
+			140, 150, 169, 180, 191, 202, 213, 225, 237, 248,
+			260, 272, 283, 295, 307, 319, 330, 342, 354, 366,
+			377, 389, 401, 412, 424, 436, 448, 459, 471, 483,
+			494, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+			500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+			500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+			500, 500, 500, 500, 500, 500, 500, 500, 500, 500,
+		},
+
+		KingSafetyEndgameDivisor: 4,
+		KingShieldMg:             [8]int{0, 20, 10, 0, 0, 0, 0, 0},
+		KingStormMg:              [8]int{0, -10, -30, -20, -10, 0, 0, 0},
+		KingOpenFileMg:           -20,
+		KingSemiOpenFileMg:       -10,
+
+		MobilityBaseline: [8]int{Knight: 4, Bishop: 7, Rook: 7, Queen: 14},
+		MobilityMg:       [8]int{Knight: 4, Bishop: 5, Rook: 2, Queen: 1},
+		MobilityEg:       [8]int{Knight: 4, Bishop: 5, Rook: 4, Queen: 2},
+
+		BishopPairMg:        30,
+		BishopPairEg:        50,
+		RookOpenFileMg:      25,
+		RookOpenFileEg:      10,
+		RookSemiOpenFileMg:  10,
+		RookSemiOpenFileEg:  5,
+		RookSeventhMg:       20,
+		RookSeventhEg:       30,
+		KnightOutpostMg:     20,
+		KnightOutpostEg:     10,
+		BadBishopMg:         -3,
+		BadBishopEg:         -5,
+		TrappedBishopMg:     -100,
+		TrappedBishopEg:     -100,
+		TrappedRookMg:       -50,
+		TrappedRookEg:       0,
+		TrappedRookMobility: 3,
+
+		HangingPieceMg: -30,
+		HangingPieceEg: -15,
+	}
+}
+
+// Replace the evaluation parameters in use. Cached pawn evaluations and the
+// piece scores of the engine's position were made with the old parameters, so
+// the pawn hash table is invalidated and the scores are recalculated. Any other
+// position must have its piece scores recalculated before it is evaluated.
+func setEvalParameters(params evalParameters) {
+	evalParams = params
+	pawnTableGeneration++
+
+	initialisePieceScores(&engineData.position)
+}
+
+/*
+Load evaluation parameters from a JSON file. Any parameter missing from the
+file keeps its built-in default, so the file only needs to contain the values
+being changed.
+*/
+func loadEvalParameters(path string) (evalParameters, error) {
+	params := defaultEvalParameters()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return params, err
+	}
+
+	err = json.Unmarshal(data, &params)
+	if err != nil {
+		return params, err
+	}
+
+	if params.KingSafetyEndgameDivisor == 0 {
+		return params, errors.New("KingSafetyEndgameDivisor must not be 0")
+	}
+
+	return params, nil
+}
+
+// Save evaluation parameters to a JSON file.
+func saveEvalParameters(path string, params evalParameters) error {
+	data, err := json.MarshalIndent(params, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0644)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEvalParametersRoundtrip(t *testing.T) {
+	dir, err := os.MkdirTemp("", "chess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "params.json")
+
+	params := defaultEvalParameters()
+	params.QueenWeight = 950
+	params.KingSafetyTable[10] = 1
+	params.PassedPawnEg[6] = 200
+
+	if err := saveEvalParameters(path, params); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadEvalParameters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if loaded != params {
+		t.Errorf("Evaluation parameters changed after saving and loading!\nSaved: %+v\nLoaded: %+v\n", params, loaded)
+	}
+}
+
+func TestPartialEvalParameters(t *testing.T) {
+	dir, err := os.MkdirTemp("", "chess")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "params.json")
+
+	if err := os.WriteFile(path, []byte(`{"PawnWeight": 120}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := loadEvalParameters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := defaultEvalParameters()
+	expected.PawnWeight = 120
+
+	if loaded != expected {
+		t.Errorf("Partial evaluation parameters were not merged with the defaults!\nExpected: %+v\nLoaded: %+v\n", expected, loaded)
+	}
+
+	// Evaluating with the new parameters must not use pawn structures cached
+	// under the old ones.
+	fen := "4k3/pp6/8/8/8/8/PPP5/4K3 w - - 0 1"
+	before := evaluate(mustFromFEN(fen))
+
+	setEvalParameters(loaded)
+	defer setEvalParameters(defaultEvalParameters())
+
+	if after := evaluate(mustFromFEN(fen)); after != before+20 {
+		t.Errorf("Evaluation did not use the new parameters!\nBefore: %v\nAfter: %v\n", before, after)
+	}
+}
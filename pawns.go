@@ -0,0 +1,309 @@
+package main
+
+import (
+	"math/bits"
+	"sync"
+)
+
+/*
+Pawn structure changes slowly during a game, so the parts of its evaluation
+that depend only on the pawns are cached in a hash table, keyed by the pawn-only
+Zobrist hash stored in position.pawnKey.
+
+Like the rest of the evaluation, each term has a middlegame and an endgame
+value, which are blended according to the game phase. The values are stored in
+evalParams.
+*/
+
+/*
+pawnEntry holds the cached evaluation of a pawn structure. scores holds the
+structural score of each side, while passed is a bitboard of every passed pawn
+of either colour, which is scored separately since its value depends on the
+pieces around it. generation is the value of pawnTableGeneration when the entry
+was stored.
+*/
+type pawnEntry struct {
+	key        uint64
+	generation uint32
+	scores     [2]score
+	passed     uint64
+}
+
+const pawnTableSize = 1 << 14
+
+// The pawn hash table. An entry whose key is 0 is empty, which is also the
+// correct evaluation for a position with no pawns.
+var pawnTable [pawnTableSize]pawnEntry
+
+// The table is shared by every search, so each entry is guarded by one of a set
+// of locks, allowing searches to run in parallel.
+const pawnTableLockCount = 64
+
+var pawnTableLocks [pawnTableLockCount]sync.Mutex
+
+// pawnTableGeneration is increased whenever the evaluation parameters change,
+// which invalidates every entry in the pawn hash table without having to clear
+// it.
+var pawnTableGeneration uint32
+
+// Bitboards of each file, and the files adjacent to it.
+var fileMasks = generateFileMasks()
+var adjacentFileMasks = generateAdjacentFileMasks()
+
+// For each side and square, the bitboard of squares in front of it on the same
+// file (forwardFileMasks), and on the same and adjacent files (passedMasks).
+var forwardFileMasks = generateForwardMasks(false)
+var passedMasks = generateForwardMasks(true)
+
+func generateFileMasks() [8]uint64 {
+	var masks [8]uint64
+
+	for file := 0; file < 8; file++ {
+		masks[file] = 0x0101010101010101 << uint(file)
+	}
+
+	return masks
+}
+
+func generateAdjacentFileMasks() [8]uint64 {
+	var masks [8]uint64
+
+	for file := 0; file < 8; file++ {
+		if file > 0 {
+			masks[file] |= fileMasks[file-1]
+		}
+
+		if file < 7 {
+			masks[file] |= fileMasks[file+1]
+		}
+	}
+
+	return masks
+}
+
+func generateForwardMasks(includeAdjacent bool) [2][64]uint64 {
+	var masks [2][64]uint64
+
+	for square := 0; square < 64; square++ {
+		files := fileMasks[square%8]
+		if includeAdjacent {
+			files |= adjacentFileMasks[square%8]
+		}
+
+		masks[0][square] = files & ranksAbove(square/8)
+		masks[1][square] = files & ranksBelow(square/8)
+	}
+
+	return masks
+}
+
+// Return a bitboard of every square on a rank strictly above the given rank.
+func ranksAbove(rank int) uint64 {
+	if rank == 7 {
+		return 0
+	}
+
+	return ^uint64(0) << uint(8*(rank+1))
+}
+
+// Return a bitboard of every square on a rank strictly below the given rank.
+func ranksBelow(rank int) uint64 {
+	if rank == 0 {
+		return 0
+	}
+
+	return ^uint64(0) >> uint(8*(8-rank))
+}
+
+// Find the rank of a standard 8x8 square, from 0 to 7, relative to the side
+// that owns it.
+func relativeRank(square int, color byte) int {
+	if color == White {
+		return square / 8
+	}
+
+	return 7 - square/8
+}
+
+// Find the number of king moves between two standard 8x8 squares.
+func squareDistance(a int, b int) int {
+	rankDistance := a/8 - b/8
+	if rankDistance < 0 {
+		rankDistance = -rankDistance
+	}
+
+	fileDistance := a%8 - b%8
+	if fileDistance < 0 {
+		fileDistance = -fileDistance
+	}
+
+	if rankDistance > fileDistance {
+		return rankDistance
+	}
+
+	return fileDistance
+}
+
+/*
+evaluatePawns returns the pawn structure score of each side. pawns holds the
+pawn bitboards for each side, kings the standard square of each king (or -1 if
+it is missing), and occupied every piece on the board.
+*/
+func evaluatePawns(position position, pawns [2]uint64, kings [2]int, occupied uint64) [2]score {
+	index := position.pawnKey % pawnTableSize
+	lock := &pawnTableLocks[index%pawnTableLockCount]
+
+	lock.Lock()
+
+	entry := &pawnTable[index]
+	if entry.key != position.pawnKey || entry.generation != pawnTableGeneration {
+		*entry = evaluatePawnStructure(pawns)
+		entry.key = position.pawnKey
+		entry.generation = pawnTableGeneration
+	}
+
+	cached := *entry
+
+	lock.Unlock()
+
+	scores := evaluatePassedPawns(cached.passed, pawns, kings, occupied)
+
+	for side := range scores {
+		scores[side].add(cached.scores[side])
+	}
+
+	return scores
+}
+
+// Evaluate the parts of the pawn structure which depend only on the pawns, for
+// storage in the pawn hash table.
+func evaluatePawnStructure(pawns [2]uint64) pawnEntry {
+	var entry pawnEntry
+
+	for _, color := range [2]byte{White, Black} {
+		side := sideIndex(color)
+		own := pawns[side]
+		enemy := pawns[1-side]
+		enemyAttacks := pawnAttacks(enemy, opposingColor(color))
+
+		var mg int
+		var eg int
+		var files uint
+
+		for remaining := own; remaining != 0; remaining &= remaining - 1 {
+			square := bits.TrailingZeros64(remaining)
+			file := square % 8
+			rank := relativeRank(square, color)
+			squareMask := uint64(1) << uint(square)
+
+			files |= 1 << uint(file)
+
+			var stop int
+			if color == White {
+				stop = square + 8
+			} else {
+				stop = square - 8
+			}
+
+			// A pawn is defended by the squares from which an enemy pawn on
+			// its square would attack.
+			supported := own & pawnAttacks(squareMask, opposingColor(color))
+			phalanx := own & adjacentFileMasks[file] & (0xFF << uint(8*(square/8)))
+			doubled := own&forwardFileMasks[side][square] != 0
+
+			if supported != 0 {
+				mg += evalParams.SupportedPawnMg[rank]
+				eg += evalParams.SupportedPawnEg[rank]
+			}
+
+			if phalanx != 0 {
+				mg += evalParams.PhalanxPawnMg[rank]
+				eg += evalParams.PhalanxPawnEg[rank]
+			}
+
+			if doubled {
+				mg += evalParams.DoubledPawnMg
+				eg += evalParams.DoubledPawnEg
+			}
+
+			// An isolated pawn has no friendly pawns on adjacent files. A
+			// backward pawn has them, but they are all further advanced, so
+			// it can't be defended, and it can't safely advance either.
+			if own&adjacentFileMasks[file] == 0 {
+				mg += evalParams.IsolatedPawnMg
+				eg += evalParams.IsolatedPawnEg
+			} else if own&adjacentFileMasks[file]&^passedMasks[side][square] == 0 && enemyAttacks&(1<<uint(stop)) != 0 {
+				mg += evalParams.BackwardPawnMg
+				eg += evalParams.BackwardPawnEg
+			}
+
+			// A pawn is passed if no enemy pawn can block or capture it on its
+			// way to promotion. Only the front pawn of a doubled pair counts.
+			if enemy&passedMasks[side][square] == 0 && !doubled {
+				entry.passed |= squareMask
+			}
+		}
+
+		// Count the groups of adjacent files containing pawns.
+		islands := bits.OnesCount(files &^ (files << 1))
+		if islands > 1 {
+			mg += evalParams.PawnIslandMg * (islands - 1)
+			eg += evalParams.PawnIslandEg * (islands - 1)
+		}
+
+		entry.scores[side] = score{mg, eg}
+	}
+
+	return entry
+}
+
+// Score the passed pawns of both sides, taking into account whether their path
+// is blocked and how close each king is.
+func evaluatePassedPawns(passed uint64, pawns [2]uint64, kings [2]int, occupied uint64) [2]score {
+	var scores [2]score
+
+	for _, color := range [2]byte{White, Black} {
+		side := sideIndex(color)
+
+		var mg int
+		var eg int
+
+		for remaining := passed & pawns[side]; remaining != 0; remaining &= remaining - 1 {
+			square := bits.TrailingZeros64(remaining)
+			rank := relativeRank(square, color)
+
+			var stop int
+			if color == White {
+				stop = square + 8
+			} else {
+				stop = square - 8
+			}
+
+			bonusMg := evalParams.PassedPawnMg[rank]
+			bonusEg := evalParams.PassedPawnEg[rank]
+
+			// A blocked pawn is worth half as much, while one with a free run
+			// to the final rank is worth more.
+			if occupied&(1<<uint(stop)) != 0 {
+				bonusMg /= 2
+				bonusEg /= 2
+			} else if occupied&forwardFileMasks[side][square] == 0 {
+				bonusEg += evalParams.PassedFreePathEg[rank]
+			}
+
+			if rank > 2 && kings[side] != -1 && kings[1-side] != -1 {
+				weight := rank - 2
+
+				bonusEg += evalParams.PassedEnemyKingDistanceEg * squareDistance(kings[1-side], stop) * weight
+				bonusEg -= evalParams.PassedOwnKingDistanceEg * squareDistance(kings[side], stop) * weight
+			}
+
+			mg += bonusMg
+			eg += bonusEg
+		}
+
+		scores[side] = score{mg, eg}
+	}
+
+	return scores
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+type pawnStructureTest struct {
+	name   string
+	fen    string
+	white  score
+	black  score
+	passed uint64
+}
+
+func TestPawnStructure(t *testing.T) {
+	cases := []pawnStructureTest{
+		{"No pawns", "4k3/8/8/8/8/8/8/4K3 w - - 0 1", score{0, 0}, score{0, 0}, 0},
+		{"Doubled isolated pawns", "4k3/8/8/8/8/P7/P7/4K3 w - - 0 1", score{-30, -55}, score{0, 0}, 1 << 16},
+		{"Backward pawn", "4k3/8/8/4p3/2P5/3P4/8/4K3 w - - 0 1", score{0, -7}, score{-10, -15}, 1 << 26},
+		{"Starting position", "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", score{24, 0}, score{24, 0}, 0},
+	}
+
+	for _, test := range cases {
+		position := mustFromFEN(test.fen)
+		pieces, _, _ := evaluationBitboards(position)
+
+		entry := evaluatePawnStructure([2]uint64{pieces[0][Pawn], pieces[1][Pawn]})
+
+		if entry.scores != [2]score{test.white, test.black} || entry.passed != test.passed {
+			t.Errorf("Pawn structure test failed! (%v)\nFEN: %v\nExpected: %v %v %x\nActual: %v %v %x\n", test.name, test.fen, test.white, test.black, test.passed, entry.scores[0], entry.scores[1], entry.passed)
+		}
+	}
+}
+
+func TestPawnSymmetry(t *testing.T) {
+	cases := []string{
+		"4k3/8/8/4p3/2P5/3P4/8/4K3 w - - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"8/k1P5/8/1K6/8/8/8/8 w - - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/p4pp1/1p5p/2P5/P7/5PK1/6PP/3k4 w - - 0 1",
+	}
+
+	for _, fen := range cases {
+		position := mustFromFEN(fen)
+		pieces, kings, occupied := evaluationBitboards(position)
+		scores := evaluatePawns(position, [2]uint64{pieces[0][Pawn], pieces[1][Pawn]}, kings, occupied)
+
+		mirrored := mustParseFEN(mirrorFEN(fen))
+		pieces, kings, occupied = evaluationBitboards(mirrored)
+		mirroredScores := evaluatePawns(mirrored, [2]uint64{pieces[0][Pawn], pieces[1][Pawn]}, kings, occupied)
+
+		if scores[0] != mirroredScores[1] || scores[1] != mirroredScores[0] {
+			t.Errorf("Pawn symmetry test failed!\nFEN: %v\nScores: %v\nMirrored scores: %v\n", fen, scores, mirroredScores)
+		}
+	}
+}
+
+// Flip the board of a FEN vertically and swap the colours of the pieces, so
+// that the evaluation of each side in the new position is the evaluation of the
+// other side in the old.
+func mirrorFEN(fen string) string {
+	sections := strings.Split(fen, " ")
+
+	ranks := strings.Split(sections[0], "/")
+	for i, j := 0, len(ranks)-1; i < j; i, j = i+1, j-1 {
+		ranks[i], ranks[j] = ranks[j], ranks[i]
+	}
+
+	var swapped []rune
+	for _, char := range strings.Join(ranks, "/") {
+		if char >= 'a' && char <= 'z' {
+			swapped = append(swapped, char-'a'+'A')
+		} else if char >= 'A' && char <= 'Z' {
+			swapped = append(swapped, char-'A'+'a')
+		} else {
+			swapped = append(swapped, char)
+		}
+	}
+
+	sections[0] = string(swapped)
+
+	return strings.Join(sections, " ")
+}
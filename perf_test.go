@@ -64,7 +64,7 @@ func TestPerft(t *testing.T) {
 	}
 
 	for _, test := range cases {
-		position := fromFEN(test.fen)
+		position := mustFromFEN(test.fen)
 
 		results := perft(position, test.depth)
 
@@ -74,3 +74,26 @@ func TestPerft(t *testing.T) {
 
 	}
 }
+
+func TestChess960Perft(t *testing.T) {
+	// Positions from the Chess960 perft suite, with Shredder-FEN castling
+	// rights.
+	cases := []testPerft{
+		{"bqnb1rkr/pp3ppp/3ppn2/2p5/5P2/P2P4/NPP1P1PP/BQ1BNRKR w HFhf - 2 9", 4, 326672},
+		{"2nnrbkr/p1qppppp/8/1ppb4/6PP/3PP3/PPP2P2/BQNNRBKR w HEhe - 1 9", 4, 667366},
+		{"b1q1rrkb/pppppppp/3nn3/8/P7/1PPP4/4PPPP/BQNNRKRB w GE - 1 9", 4, 273318},
+		{"qbbnnrkr/2pp2pp/p7/1p2pp2/8/P3PP2/1PPP1KPP/QBBNNR1R w hf - 0 9", 4, 382958},
+		{"1nbbnrkr/p1p1ppp1/3p4/1p3P1p/3Pq2P/8/PPP1P1P1/QNBBNRKR w HFhf - 0 9", 4, 1171749},
+		{"qnbnr1kr/ppp1b1pp/4p3/3p1p2/8/2NPP3/PPP1BPPP/QNB1R1KR w HEhe - 1 9", 3, 26578},
+	}
+
+	for _, test := range cases {
+		position := mustFromFEN(test.fen)
+
+		results := perft(position, test.depth)
+
+		if int(results.nodes) != test.expected {
+			t.Errorf("Chess960 perft test failed!\nFEN: %v\nExpected: %v\nActual: %v\n", test.fen, test.expected, results.nodes)
+		}
+	}
+}
@@ -33,61 +33,49 @@ func perft(position position, depth int) perftResults {
 		return perftResults{1, 0, 0, 0, 0, 0, 0, 0, 0, 0}
 	}
 
-	// Generate all moves for the position.
-	moves := generateMoves(position)
-
-	checked := 0
+	// Generate all legal moves for the position.
+	moves := generateLegalMoves(position)
 
 	// Make each move, recording information about the move.
 	for _, move := range moves {
 
 		artifacts := makeMove(&position, move)
 
-		if !isKingInCheck(position, position.toMove) {
-			if move.isQuiet() {
-				results.quiet++
-			} else if move.isQueenCastle() {
-				results.castleQueenSide++
-			} else if move.isKingCastle() {
-				results.castleKingSide++
-			} else if move.isPromotionCapture() {
-				results.promoCapture++
-			} else if move.isPromotion() {
-				results.promotion++
-			} else if move.isEnPassantCapture() {
-				results.enpassant++
-			} else if move.isDoublePawnPush() {
-				results.pawnJump++
-			} else if move.isCapture() {
-				results.captures++
-			}
-
-			if isKingInCheck(position, position.toMove) {
-				results.checks++
-			}
-
-			perftResults := perft(position, depth-1)
-			results.nodes += perftResults.nodes
-			results.quiet += perftResults.quiet
-			results.captures += perftResults.captures
-			results.enpassant += perftResults.enpassant
-			results.promotion += perftResults.promotion
-			results.promoCapture += perftResults.promoCapture
-			results.castleKingSide += perftResults.castleKingSide
-			results.castleQueenSide += perftResults.castleQueenSide
-			results.pawnJump += perftResults.pawnJump
-			results.checks += perftResults.checks
-		} else {
-			checked++
+		if move.isQuiet() {
+			results.quiet++
+		} else if move.isQueenCastle() {
+			results.castleQueenSide++
+		} else if move.isKingCastle() {
+			results.castleKingSide++
+		} else if move.isPromotionCapture() {
+			results.promoCapture++
+		} else if move.isPromotion() {
+			results.promotion++
+		} else if move.isEnPassantCapture() {
+			results.enpassant++
+		} else if move.isDoublePawnPush() {
+			results.pawnJump++
+		} else if move.isCapture() {
+			results.captures++
 		}
 
-		unmakeMove(&position, move, artifacts)
-	}
+		if isKingInCheck(position, position.toMove) {
+			results.checks++
+		}
+
+		perftResults := perft(position, depth-1)
+		results.nodes += perftResults.nodes
+		results.quiet += perftResults.quiet
+		results.captures += perftResults.captures
+		results.enpassant += perftResults.enpassant
+		results.promotion += perftResults.promotion
+		results.promoCapture += perftResults.promoCapture
+		results.castleKingSide += perftResults.castleKingSide
+		results.castleQueenSide += perftResults.castleQueenSide
+		results.pawnJump += perftResults.pawnJump
+		results.checks += perftResults.checks
 
-	// If every move results in a check, return an empty statistics list, since
-	// the game has ended and there are no nodes to record.
-	if checked == len(moves) {
-		return perftResults{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+		unmakeMove(&position, move, artifacts)
 	}
 
 	return results
@@ -0,0 +1,631 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+Portable Game Notation (PGN) is the standard format for recording games. A PGN
+file holds any number of games, each made of tag pairs, such as [White "Tal"],
+followed by the movetext: the moves of the game in SAN, with move numbers, and
+finally the result.
+
+The movetext can also hold comments, in braces or after a semicolon, Numeric
+Annotation Glyphs (NAGs) such as $1, and variations in parentheses. Variations
+are alternatives to the move they follow, and can hold variations of their own.
+*/
+type pgnTag struct {
+	name  string
+	value string
+}
+
+// A move of a game or variation, with its annotations. preComment is only set
+// for a comment before the first move of the game or of a variation, since
+// every other comment follows a move.
+type pgnMove struct {
+	move       move
+	nags       []int
+	preComment string
+	comment    string
+	variations [][]pgnMove
+}
+
+type pgnGame struct {
+	tags    []pgnTag
+	comment string
+	moves   []pgnMove
+	result  string
+}
+
+// The tags which every exported game has, in the order they are written, with
+// the values used when they are missing.
+var pgnSevenTagRoster = []pgnTag{
+	{"Event", "?"},
+	{"Site", "?"},
+	{"Date", "????.??.??"},
+	{"Round", "?"},
+	{"White", "?"},
+	{"Black", "?"},
+	{"Result", "*"},
+}
+
+// The suffix annotations which can be written after a move, and the NAGs they
+// stand for.
+var pgnSuffixAnnotations = map[string]int{"!": 1, "?": 2, "!!": 3, "??": 4, "!?": 5, "?!": 6}
+
+// Lines of exported movetext are kept shorter than 80 characters.
+const pgnLineLength = 79
+
+// Find the value of one of a game's tags, or an empty string if it has none.
+func (game *pgnGame) tag(name string) string {
+	for _, tag := range game.tags {
+		if tag.name == name {
+			return tag.value
+		}
+	}
+
+	return ""
+}
+
+// Set the value of one of a game's tags, adding it if necessary.
+func (game *pgnGame) setTag(name string, value string) {
+	for i := range game.tags {
+		if game.tags[i].name == name {
+			game.tags[i].value = value
+			return
+		}
+	}
+
+	game.tags = append(game.tags, pgnTag{name, value})
+}
+
+// Find the position a game starts from, which is given by its FEN tag if it
+// doesn't start from the usual one.
+func (game *pgnGame) initialPosition() (position, error) {
+	if fen := game.tag("FEN"); fen != "" {
+		return fromFEN(fen)
+	}
+
+	return mustFromFEN(startPosition), nil
+}
+
+// A syntax error, or illegal move, in a PGN file. The reader skips the rest of
+// the game, so reading can continue with the next.
+type pgnError struct {
+	game int
+	line int
+	err  string
+}
+
+func (e *pgnError) Error() string {
+	return fmt.Sprintf("game %v, line %v: %v", e.game, e.line, e.err)
+}
+
+/*
+The tokens of PGN. Punctuation, such as brackets and periods, is a token of its
+own, with its character as its kind. The others are symbols, such as moves, tag
+names and move numbers, strings, comments, NAGs, and suffix annotations.
+*/
+type pgnToken struct {
+	kind byte
+	text string
+}
+
+const pgnSymbol = 's'
+const pgnString = '"'
+const pgnComment = '{'
+const pgnNAG = '$'
+const pgnAnnotation = '!'
+const pgnEOF = 0
+
+// A streaming reader of the games in a PGN file.
+type pgnReader struct {
+	reader  *bufio.Reader
+	line    int
+	games   int
+	pending *pgnToken
+	err     error
+
+	// Whether the last character read was a newline, and whether the one
+	// before it was, for escaped lines.
+	afterNewline    bool
+	wasAfterNewline bool
+}
+
+func newPGNReader(reader io.Reader) *pgnReader {
+	return &pgnReader{reader: bufio.NewReader(reader), line: 1, afterNewline: true}
+}
+
+/*
+Read the next game, returning io.EOF when there are none left. Any other error
+from the underlying reader is returned for every later call. A *pgnError is
+returned for a game which can't be read, after which the next game can be.
+*/
+func (r *pgnReader) next() (*pgnGame, error) {
+	game := &pgnGame{}
+	r.games++
+
+	token := r.nextToken()
+	for ; token.kind == '['; token = r.nextToken() {
+		name := r.nextToken()
+		value := r.nextToken()
+
+		if name.kind != pgnSymbol || value.kind != pgnString || r.nextToken().kind != ']' {
+			return nil, r.fail("invalid tag pair")
+		}
+
+		game.tags = append(game.tags, pgnTag{name.text, value.text})
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if token.kind == pgnEOF && len(game.tags) == 0 {
+		r.games--
+		return nil, io.EOF
+	}
+
+	r.pending = &token
+
+	initial, err := game.initialPosition()
+	if err != nil {
+		return nil, r.fail("invalid FEN: " + err.Error())
+	}
+
+	moves, comment, err := r.readMoves(game, initial, false)
+	if err != nil {
+		return nil, err
+	}
+
+	game.moves = moves
+	if len(moves) == 0 {
+		game.comment = comment
+	}
+
+	if game.result == "" {
+		game.result = game.tag("Result")
+	}
+
+	return game, nil
+}
+
+/*
+Read the moves of a game, or of a variation starting from position, up to its
+end. Comments before the first move are returned separately if there isn't one,
+and the result of the game is stored in it.
+*/
+func (r *pgnReader) readMoves(game *pgnGame, position position, variation bool) ([]pgnMove, string, error) {
+	var moves []pgnMove
+	var comment string
+
+	// The position before the last move, from which its variations start.
+	previous := position
+
+	for {
+		token := r.nextToken()
+
+		if r.err != nil {
+			return nil, "", r.err
+		}
+
+		switch token.kind {
+		case pgnComment:
+			if len(moves) == 0 {
+				comment = joinComments(comment, token.text)
+			} else {
+				moves[len(moves)-1].comment = joinComments(moves[len(moves)-1].comment, token.text)
+			}
+		case pgnNAG, pgnAnnotation:
+			nag, ok := pgnSuffixAnnotations[token.text]
+			if token.kind == pgnNAG {
+				number, err := strconv.Atoi(token.text)
+				nag, ok = number, err == nil && number >= 0 && number <= 255
+			}
+
+			if !ok || len(moves) == 0 {
+				return nil, "", r.fail("unexpected annotation " + token.text)
+			}
+
+			moves[len(moves)-1].nags = append(moves[len(moves)-1].nags, nag)
+		case '(':
+			if len(moves) == 0 {
+				return nil, "", r.fail("variation before any move")
+			}
+
+			variationMoves, variationComment, err := r.readMoves(game, previous, true)
+			if err != nil {
+				return nil, "", err
+			}
+
+			if len(variationMoves) > 0 {
+				variationMoves[0].preComment = variationComment
+				last := &moves[len(moves)-1]
+				last.variations = append(last.variations, variationMoves)
+			}
+		case ')':
+			if !variation {
+				return nil, "", r.fail("unexpected )")
+			}
+
+			return moves, comment, nil
+		case '.':
+			// Periods only follow move numbers.
+		case pgnSymbol:
+			if isPGNResult(token.text) {
+				if variation {
+					// Let the result end the game when skipping it.
+					r.pending = &token
+					return nil, "", r.fail("unterminated variation")
+				}
+
+				game.result = token.text
+				return finishPGNMoves(moves, comment), comment, nil
+			}
+
+			if isPGNMoveNumber(token.text) {
+				continue
+			}
+
+			move, err := parseSAN(position, token.text)
+			if err != nil {
+				return nil, "", r.fail(err.Error())
+			}
+
+			moves = append(moves, pgnMove{move: move})
+			previous = position
+			makeMove(&position, move)
+		case '[', pgnEOF:
+			// A game without a result ends at the next game's tags.
+			if variation {
+				return nil, "", r.fail("unterminated variation")
+			}
+
+			r.pending = &token
+			return finishPGNMoves(moves, comment), comment, nil
+		default:
+			return nil, "", r.fail("unexpected " + token.text)
+		}
+	}
+}
+
+// Attach a comment before the first move of the game to that move.
+func finishPGNMoves(moves []pgnMove, comment string) []pgnMove {
+	if len(moves) > 0 {
+		moves[0].preComment = comment
+	}
+
+	return moves
+}
+
+// Join two comments on the same move.
+func joinComments(first string, second string) string {
+	if first == "" {
+		return second
+	}
+
+	return first + " " + second
+}
+
+// Is a token the result of a game?
+func isPGNResult(token string) bool {
+	return token == "1-0" || token == "0-1" || token == "1/2-1/2" || token == "*"
+}
+
+// Is a token a move number? These are followed by periods, which are separate
+// tokens.
+func isPGNMoveNumber(token string) bool {
+	return strings.Trim(token, "0123456789") == ""
+}
+
+// Report an error in the current game, then skip to the start of the next.
+func (r *pgnReader) fail(message string) error {
+	err := &pgnError{game: r.games, line: r.line, err: message}
+
+	for {
+		token := r.nextToken()
+
+		if token.kind == pgnEOF {
+			return err
+		}
+
+		if token.kind == pgnSymbol && isPGNResult(token.text) {
+			// Tags may follow, so check for them before returning.
+			next := r.nextToken()
+			r.pending = &next
+			return err
+		}
+	}
+}
+
+// Read the next token, or a token of kind pgnEOF at the end of the file or
+// after an error, which is stored in r.err.
+func (r *pgnReader) nextToken() pgnToken {
+	if r.pending != nil {
+		token := *r.pending
+		r.pending = nil
+		return token
+	}
+
+	for {
+		char, ok := r.readByte()
+		if !ok {
+			return pgnToken{kind: pgnEOF}
+		}
+
+		switch {
+		case char == ' ' || char == '\t' || char == '\r' || char == '\n':
+			continue
+		case char == '%' && r.atLineStart():
+			// Lines starting with % are escaped, and ignored.
+			r.readUntil('\n')
+		case char == ';':
+			return pgnToken{pgnComment, strings.TrimSpace(r.readUntil('\n'))}
+		case char == '{':
+			return pgnToken{pgnComment, strings.Join(strings.Fields(r.readUntil('}')), " ")}
+		case char == '"':
+			return pgnToken{pgnString, r.readString()}
+		case char == '$':
+			return pgnToken{pgnNAG, r.readWhile(func(c byte) bool { return c >= '0' && c <= '9' })}
+		case char == '!' || char == '?':
+			return pgnToken{pgnAnnotation, string(char) + r.readWhile(func(c byte) bool { return c == '!' || c == '?' })}
+		case char == '*':
+			return pgnToken{pgnSymbol, "*"}
+		case isPGNSymbolCharacter(char):
+			return pgnToken{pgnSymbol, string(char) + r.readWhile(isPGNSymbolCharacter)}
+		default:
+			return pgnToken{char, string(char)}
+		}
+	}
+}
+
+// Symbols are made of letters, digits and the characters used in SAN and
+// results.
+func isPGNSymbolCharacter(char byte) bool {
+	return (char >= 'a' && char <= 'z') || (char >= 'A' && char <= 'Z') || (char >= '0' && char <= '9') || strings.IndexByte("_+#=:-/", char) >= 0
+}
+
+func (r *pgnReader) readByte() (byte, bool) {
+	if r.err != nil {
+		return 0, false
+	}
+
+	char, err := r.reader.ReadByte()
+	if err != nil {
+		if err != io.EOF {
+			r.err = err
+		}
+
+		return 0, false
+	}
+
+	if char == '\n' {
+		r.line++
+	}
+
+	r.wasAfterNewline = r.afterNewline
+	r.afterNewline = char == '\n'
+
+	return char, true
+}
+
+func (r *pgnReader) unreadByte(char byte) {
+	r.reader.UnreadByte()
+	r.afterNewline = r.wasAfterNewline
+
+	if char == '\n' {
+		r.line--
+	}
+}
+
+// Is the character just read the first of its line?
+func (r *pgnReader) atLineStart() bool {
+	return r.wasAfterNewline
+}
+
+// Read up to and including a character, returning what came before it.
+func (r *pgnReader) readUntil(end byte) string {
+	var text []byte
+
+	for {
+		char, ok := r.readByte()
+		if !ok || char == end {
+			return string(text)
+		}
+
+		text = append(text, char)
+	}
+}
+
+// Read characters for as long as they match.
+func (r *pgnReader) readWhile(matches func(byte) bool) string {
+	var text []byte
+
+	for {
+		char, ok := r.readByte()
+		if !ok {
+			return string(text)
+		}
+
+		if !matches(char) {
+			r.unreadByte(char)
+			return string(text)
+		}
+
+		text = append(text, char)
+	}
+}
+
+// Read the rest of a string, in which a backslash escapes the next character.
+func (r *pgnReader) readString() string {
+	var text []byte
+
+	for {
+		char, ok := r.readByte()
+		if !ok || char == '"' {
+			return string(text)
+		}
+
+		if char == '\\' {
+			if char, ok = r.readByte(); !ok {
+				return string(text)
+			}
+		}
+
+		text = append(text, char)
+	}
+}
+
+/*
+Write a game in the PGN export format. The Seven Tag Roster is written first, in
+its standard order, then the other tags. The moves are written in SAN, generated
+afresh, with lines of movetext wrapped to pgnLineLength characters.
+*/
+func writePGN(writer io.Writer, game *pgnGame) error {
+	result := game.result
+	if result == "" {
+		result = game.tag("Result")
+	}
+
+	if result == "" {
+		result = "*"
+	}
+
+	var lines []string
+
+	for _, rosterTag := range pgnSevenTagRoster {
+		value := game.tag(rosterTag.name)
+
+		switch {
+		case rosterTag.name == "Result":
+			value = result
+		case value == "":
+			value = rosterTag.value
+		}
+
+		lines = append(lines, formatPGNTag(rosterTag.name, value))
+	}
+
+	for _, tag := range game.tags {
+		if !isSevenTagRoster(tag.name) {
+			lines = append(lines, formatPGNTag(tag.name, tag.value))
+		}
+	}
+
+	lines = append(lines, "")
+
+	var tokens []string
+	if game.comment != "" {
+		tokens = appendPGNComment(tokens, game.comment)
+	}
+
+	initial, err := game.initialPosition()
+	if err != nil {
+		return err
+	}
+
+	tokens = appendPGNMoves(tokens, initial, game.moves)
+	tokens = append(tokens, result)
+
+	line := ""
+	for _, token := range tokens {
+		if line != "" && len(line)+1+len(token) > pgnLineLength {
+			lines = append(lines, line)
+			line = ""
+		}
+
+		if line != "" {
+			line += " "
+		}
+
+		line += token
+	}
+
+	lines = append(lines, line, "")
+
+	_, err = io.WriteString(writer, strings.Join(lines, "\n")+"\n")
+	return err
+}
+
+// Is a tag one of the Seven Tag Roster?
+func isSevenTagRoster(name string) bool {
+	for _, tag := range pgnSevenTagRoster {
+		if tag.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Format a tag pair, escaping its value.
+func formatPGNTag(name string, value string) string {
+	value = strings.NewReplacer("\\", "\\\\", "\"", "\\\"").Replace(value)
+
+	return fmt.Sprintf("[%v \"%v\"]", name, value)
+}
+
+/*
+Add the tokens of a sequence of moves, starting from position, to the movetext.
+White's moves are preceded by their number, as are black's at the start of a
+variation and after a comment or variation, as in 12... Nf6.
+*/
+func appendPGNMoves(tokens []string, position position, moves []pgnMove) []string {
+	needsNumber := true
+
+	for _, pgnMove := range moves {
+		if pgnMove.preComment != "" {
+			tokens = appendPGNComment(tokens, pgnMove.preComment)
+		}
+
+		if position.toMove == White {
+			tokens = append(tokens, fmt.Sprintf("%v.", position.fullmove))
+		} else if needsNumber {
+			tokens = append(tokens, fmt.Sprintf("%v...", position.fullmove))
+		}
+
+		tokens = append(tokens, toSAN(position, pgnMove.move))
+		needsNumber = false
+
+		for _, nag := range pgnMove.nags {
+			tokens = append(tokens, fmt.Sprintf("$%v", nag))
+		}
+
+		if pgnMove.comment != "" {
+			tokens = appendPGNComment(tokens, pgnMove.comment)
+			needsNumber = true
+		}
+
+		for _, variation := range pgnMove.variations {
+			variationTokens := appendPGNMoves(nil, position, variation)
+
+			variationTokens[0] = "(" + variationTokens[0]
+			variationTokens[len(variationTokens)-1] += ")"
+
+			tokens = append(tokens, variationTokens...)
+			needsNumber = true
+		}
+
+		makeMove(&position, pgnMove.move)
+	}
+
+	return tokens
+}
+
+// Add a comment to the movetext, as separate words so that it can be wrapped.
+// Braces can't be escaped, so any in the comment are removed.
+func appendPGNComment(tokens []string, comment string) []string {
+	words := strings.Fields(strings.NewReplacer("{", "", "}", "").Replace(comment))
+	if len(words) == 0 {
+		return tokens
+	}
+
+	words[0] = "{" + words[0]
+	words[len(words)-1] += "}"
+
+	return append(tokens, words...)
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+const testPGN = `[Event "Test \"match\""]
+[Site "?"]
+[White "White"]
+[Black "Black"]
+[Result "1-0"]
+[Annotator "Someone"]
+
+{Opening comment} 1. e4 e5! 2. Nf3 $1 {attacking
+   the pawn} (2. f4 exf4 (2... d5 {the counter gambit}) 3. Nf3) 2...
+Nc6 ; a comment to the end of the line
+3. Bb5 a6?! 4. Ba4 Nf6 5. O-O 1-0
+
+% an escaped line
+[Event "Endgame"]
+[SetUp "1"]
+[FEN "4k3/8/4K3/4P3/8/8/8/8 b - - 0 50"]
+
+50... Kd8 51. Kf7 Kd7 52. e6+ Kd6 53. e7 Kc7 54. e8=Q *
+[Event "No result"]
+
+1.d4 d5 2.c4
+`
+
+func TestReadPGN(t *testing.T) {
+	games := readTestPGN(t, testPGN)
+
+	if len(games) != 3 {
+		t.Fatalf("Reading PGN failed!\nExpected 3 games, got %v\n", len(games))
+	}
+
+	first := games[0]
+	if first.tag("Event") != "Test \"match\"" || first.tag("Annotator") != "Someone" || first.tag("Round") != "" || first.result != "1-0" {
+		t.Errorf("Reading PGN failed!\nWrong tags: %+v\n", first.tags)
+	}
+
+	if line := sanLine(initialPosition(t, first), first.moves); line != "e4 e5 Nf3 Nc6 Bb5 a6 Ba4 Nf6 O-O" {
+		t.Errorf("Reading PGN failed!\nWrong moves: %v\n", line)
+	}
+
+	if first.moves[0].preComment != "Opening comment" || first.moves[2].comment != "attacking the pawn" || first.moves[3].comment != "a comment to the end of the line" {
+		t.Errorf("Reading PGN failed!\nWrong comments: %+v\n", first.moves[:4])
+	}
+
+	if len(first.moves[1].nags) != 1 || first.moves[1].nags[0] != 1 || len(first.moves[2].nags) != 1 || first.moves[5].nags[0] != 6 {
+		t.Errorf("Reading PGN failed!\nWrong NAGs\n")
+	}
+
+	afterE5 := initialPosition(t, first)
+	makeMove(&afterE5, first.moves[0].move)
+	makeMove(&afterE5, first.moves[1].move)
+
+	variations := first.moves[2].variations
+	if len(variations) != 1 || sanLine(afterE5, variations[0]) != "f4 exf4 Nf3" {
+		t.Fatalf("Reading PGN failed!\nWrong variation: %+v\n", variations)
+	}
+
+	afterF4 := afterE5
+	makeMove(&afterF4, variations[0][0].move)
+
+	nested := variations[0][1].variations
+	if len(nested) != 1 || sanLine(afterF4, nested[0]) != "d5" || nested[0][0].comment != "the counter gambit" {
+		t.Errorf("Reading PGN failed!\nWrong nested variation: %+v\n", nested)
+	}
+
+	second := games[1]
+	if initialPosition(t, second).fullmove != 50 || sanLine(initialPosition(t, second), second.moves) != "Kd8 Kf7 Kd7 e6+ Kd6 e7 Kc7 e8=Q" || second.result != "*" {
+		t.Errorf("Reading PGN failed!\nWrong game from FEN: %+v\n", second)
+	}
+
+	third := games[2]
+	if third.tag("Event") != "No result" || sanLine(initialPosition(t, third), third.moves) != "d4 d5 c4" || third.result != "" {
+		t.Errorf("Reading PGN failed!\nWrong game without result: %+v\n", third)
+	}
+}
+
+func TestWritePGN(t *testing.T) {
+	games := readTestPGN(t, testPGN)
+
+	expected := `[Event "Endgame"]
+[Site "?"]
+[Date "????.??.??"]
+[Round "?"]
+[White "?"]
+[Black "?"]
+[Result "*"]
+[SetUp "1"]
+[FEN "4k3/8/4K3/4P3/8/8/8/8 b - - 0 50"]
+
+50... Kd8 51. Kf7 Kd7 52. e6+ Kd6 53. e7 Kc7 54. e8=Q *
+
+`
+
+	var output bytes.Buffer
+	if err := writePGN(&output, games[1]); err != nil || output.String() != expected {
+		t.Errorf("Writing PGN failed!\nExpected:\n%v\nGot:\n%v\n", expected, output.String())
+	}
+
+	// Writing the games and reading them back must give the same games, and
+	// the same output when written again.
+	output.Reset()
+	for _, game := range games {
+		if err := writePGN(&output, game); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, line := range strings.Split(output.String(), "\n") {
+		if len(line) > pgnLineLength {
+			t.Errorf("Writing PGN failed!\nLine is too long: %v\n", line)
+		}
+	}
+
+	if !strings.Contains(output.String(), "[Event \"Test \\\"match\\\"\"]") || !strings.Contains(output.String(), "2... Nc6") {
+		t.Errorf("Writing PGN failed!\nGot:\n%v\n", output.String())
+	}
+
+	var rewritten bytes.Buffer
+	for _, game := range readTestPGN(t, output.String()) {
+		if err := writePGN(&rewritten, game); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if rewritten.String() != output.String() {
+		t.Errorf("Writing PGN failed!\nFirst:\n%v\nSecond:\n%v\n", output.String(), rewritten.String())
+	}
+}
+
+func TestPGNErrors(t *testing.T) {
+	pgn := `[Event "Illegal"]
+
+1. e4 e5 2. Ke3 Nc6 1-0
+
+[Event "Unterminated"]
+
+1. e4 (1. d4 d5 *
+
+[Event "Legal"]
+
+1. e4 1-0
+`
+
+	reader := newPGNReader(strings.NewReader(pgn))
+
+	for _, expected := range []string{"game 1, line 3: illegal move Ke3", "game 2, line 7: unterminated variation"} {
+		if _, err := reader.next(); err == nil || err.Error() != expected {
+			t.Errorf("PGN error test failed!\nExpected: %v\nGot: %v\n", expected, err)
+		}
+	}
+
+	if game, err := reader.next(); err != nil || game.tag("Event") != "Legal" {
+		t.Errorf("PGN error test failed!\nCould not read the game after the errors: %v\n", err)
+	}
+
+	if _, err := reader.next(); err != io.EOF {
+		t.Errorf("PGN error test failed!\nExpected the end of the file, got %v\n", err)
+	}
+}
+
+// Read every game of a PGN string.
+func readTestPGN(t *testing.T, pgn string) []*pgnGame {
+	var games []*pgnGame
+
+	reader := newPGNReader(strings.NewReader(pgn))
+	for {
+		game, err := reader.next()
+		if err == io.EOF {
+			return games
+		} else if err != nil {
+			t.Fatalf("Reading PGN failed!\n%v\n", err)
+		}
+
+		games = append(games, game)
+	}
+}
+
+// Write a sequence of moves from a position in SAN.
+func sanLine(position position, moves []pgnMove) string {
+	var sans []string
+
+	for _, pgnMove := range moves {
+		sans = append(sans, toSAN(position, pgnMove.move))
+		makeMove(&position, pgnMove.move)
+	}
+
+	return strings.Join(sans, " ")
+}
+
+// Find the position a game starts from, which must be valid.
+func initialPosition(t *testing.T, game *pgnGame) position {
+	position, err := game.initialPosition()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return position
+}
@@ -0,0 +1,55 @@
+package main
+
+import "testing"
+
+// The positions and keys given with the Polyglot book format.
+func TestPolyglotKey(t *testing.T) {
+	var tests = []struct {
+		fen string
+		key uint64
+	}{
+		{"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1", 0x463b96181691fc9c},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 0x823c9b50fd114196},
+		{"rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2", 0x0756b94461c50fb0},
+		{"rnbqkbnr/ppp1pppp/8/3pP3/8/8/PPPP1PPP/RNBQKBNR b KQkq - 0 2", 0x662fafb965db29d4},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", 0x22a48b5a8e47ff78},
+		{"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR b kq - 0 3", 0x652a607ca3f242c1},
+		{"rnbq1bnr/ppp1pkpp/8/3pPp2/8/8/PPPPKPPP/RNBQ1BNR w - - 0 4", 0x00fdd303c946bdd9},
+		{"rnbqkbnr/p1pppppp/8/8/PpP4P/8/1P1PPPP1/RNBQKBNR b KQkq c3 0 3", 0x3c8123ea7b067637},
+		{"rnbqkbnr/p1pppppp/8/8/P6P/R1p5/1P1PPPP1/1NBQKBNR b Kkq - 0 4", 0x5c3f9b829b279560},
+	}
+
+	for _, test := range tests {
+		if key := polyglotKey(mustFromFEN(test.fen)); key != test.key {
+			t.Errorf("Polyglot key test failed!\nFEN: %v\nExpected: %016x\nGot: %016x\n", test.fen, test.key, key)
+		}
+	}
+}
+
+func TestPolyglotMoves(t *testing.T) {
+	var tests = []struct {
+		name    string
+		fen     string
+		encoded uint16
+	}{
+		{"Pawn push", startPosition, 12<<6 | 28},
+		{"Knight move", startPosition, 6<<6 | 21},
+		{"White kingside castle", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", 4<<6 | 7},
+		{"Black queenside castle", "r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", 60<<6 | 56},
+		{"Queen promotion", "8/4P3/8/8/8/8/k7/4K3 w - - 0 1", 4<<12 | 52<<6 | 60},
+		{"Knight promotion capture", "8/8/8/8/8/k7/6p1/4K2R b - - 0 1", 1<<12 | 14<<6 | 7},
+	}
+
+	for _, test := range tests {
+		position := mustFromFEN(test.fen)
+		move, ok := decodePolyglotMove(position, test.encoded)
+
+		if !ok || encodePolyglotMove(position, move) != test.encoded {
+			t.Errorf("Polyglot move test failed (%v)!\nFEN: %v\nCould not decode %v\n", test.name, test.fen, test.encoded)
+		}
+	}
+
+	if _, ok := decodePolyglotMove(mustFromFEN(startPosition), 12<<6|36); ok {
+		t.Errorf("Polyglot move test failed!\nDecoded an illegal move\n")
+	}
+}
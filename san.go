@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+Standard Algebraic Notation (SAN) names a move by the piece which moves and the
+square it moves to, such as Nf3. The moving piece is given by its letter, or
+left out for a pawn, and is followed by just enough of its square to tell it
+apart from any other piece of the same kind which could move to the same square:
+the file if that is enough, then the rank, then both. Captures have an x before
+the destination, and a pawn capture starts with the pawn's file. Promotions add
+the promoted piece, such as e8=Q, castles are O-O and O-O-O, and a move which
+gives check or checkmate ends with + or #.
+*/
+
+// The letters of the pieces in SAN, by identity.
+var sanPieces = [8]string{Knight: "N", Bishop: "B", Rook: "R", Queen: "Q", King: "K"}
+
+// Convert a legal move of a position to SAN.
+func toSAN(position position, move move) string {
+	var san string
+
+	switch {
+	case move.isKingCastle():
+		san = "O-O"
+	case move.isQueenCastle():
+		san = "O-O-O"
+	default:
+		p := position.board[move.From()]
+
+		if p.is(Pawn) {
+			if move.isCapture() {
+				san = indexToSquare(move.From())[:1]
+			}
+		} else {
+			san = sanPieces[p.identity()] + sanDisambiguation(position, move)
+		}
+
+		if move.isCapture() {
+			san += "x"
+		}
+
+		san += indexToSquare(move.To())
+
+		if move.isPromotion() {
+			san += "=" + sanPieces[move.getPromotedPiece(p).identity()]
+		}
+	}
+
+	after := position
+	makeMove(&after, move)
+
+	if isKingInCheck(after, position.toMove) {
+		if len(generateLegalMoves(after)) == 0 {
+			san += "#"
+		} else {
+			san += "+"
+		}
+	}
+
+	return san
+}
+
+// Find the part of a move's origin needed to tell it apart from the other legal
+// moves of the same kind of piece to the same square.
+func sanDisambiguation(position position, move move) string {
+	p := position.board[move.From()]
+
+	ambiguous := false
+	sameFile := false
+	sameRank := false
+
+	for _, other := range generateLegalMoves(position) {
+		if other.isCastle() || other.To() != move.To() || other.From() == move.From() || position.board[other.From()] != p {
+			continue
+		}
+
+		ambiguous = true
+		sameFile = sameFile || other.From()%16 == move.From()%16
+		sameRank = sameRank || other.From()/16 == move.From()/16
+	}
+
+	from := indexToSquare(move.From())
+
+	switch {
+	case !ambiguous:
+		return ""
+	case !sameFile:
+		return from[:1]
+	case !sameRank:
+		return from[1:]
+	}
+
+	return from
+}
+
+/*
+Find the legal move of a position given in SAN, such as Nbd7, exd8=Q+ or O-O-O.
+The parser is tolerant of the variations found in the wild: check and annotation
+symbols are ignored, castles may be written with zeros, promotions may leave out
+the = or use a lowercase letter, and moves may give their full origin, with or
+without a hyphen, as in Ng1-f3 or e2e4.
+*/
+func parseSAN(position position, san string) (move, error) {
+	text := strings.TrimRight(strings.TrimSpace(san), "+#!?")
+	text = strings.TrimSuffix(strings.TrimSuffix(text, "e.p."), "ep")
+
+	moves := generateLegalMoves(position)
+
+	switch strings.Replace(text, "0", "O", -1) {
+	case "O-O", "OO":
+		return findCastle(moves, KingCastle, san)
+	case "O-O-O", "OOO":
+		return findCastle(moves, QueenCastle, san)
+	}
+
+	identity := piece(Pawn)
+	if len(text) > 0 && strings.IndexByte("NBRQK", text[0]) >= 0 {
+		identity = fenCodes[text[0]]
+		text = text[1:]
+	}
+
+	// Remove the symbols which don't affect which move is meant.
+	text = strings.NewReplacer("x", "", ":", "", "-", "", "=", "", "(", "", ")", "", "/", "").Replace(text)
+
+	var promotion piece
+	if identity == Pawn && len(text) > 2 && strings.IndexByte("NBRQnbrq", text[len(text)-1]) >= 0 {
+		promotion = fenCodes[strings.ToUpper(text[len(text)-1:])[0]]
+		text = text[:len(text)-1]
+	}
+
+	if len(text) < 2 {
+		return 0, fmt.Errorf("invalid move %v", san)
+	}
+
+	destination := text[len(text)-2:]
+	disambiguation := text[:len(text)-2]
+
+	if destination[0] < 'a' || destination[0] > 'h' || destination[1] < '1' || destination[1] > '8' {
+		return 0, fmt.Errorf("invalid move %v", san)
+	}
+
+	to := int(destination[1]-'1')*16 + int(destination[0]-'a')
+
+	// A move given by its full origin, without a piece letter, can be of any
+	// piece.
+	anyPiece := identity == Pawn && len(disambiguation) == 2
+
+	var matches []move
+	for _, move := range moves {
+		if move.isCastle() || int(move.To()) != to || (!anyPiece && position.board[move.From()].identity() != identity) {
+			continue
+		}
+
+		if move.isPromotion() != (promotion != 0) || (promotion != 0 && move.getPromotedPiece(White) != promotion) {
+			continue
+		}
+
+		from := int(move.From())
+		matchesFrom := true
+
+		for _, char := range disambiguation {
+			if char >= 'a' && char <= 'h' && from%16 != int(char-'a') {
+				matchesFrom = false
+			} else if char >= '1' && char <= '8' && from/16 != int(char-'1') {
+				matchesFrom = false
+			} else if (char < 'a' || char > 'h') && (char < '1' || char > '8') {
+				return 0, fmt.Errorf("invalid move %v", san)
+			}
+		}
+
+		if matchesFrom {
+			matches = append(matches, move)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return 0, fmt.Errorf("illegal move %v", san)
+	case 1:
+		return matches[0], nil
+	}
+
+	return 0, fmt.Errorf("ambiguous move %v", san)
+}
+
+// Find the legal castle of the given side, for parseSAN.
+func findCastle(moves []move, side int, san string) (move, error) {
+	for _, move := range moves {
+		if (side == KingCastle && move.isKingCastle()) || (side == QueenCastle && move.isQueenCastle()) {
+			return move, nil
+		}
+	}
+
+	return 0, fmt.Errorf("illegal move %v", san)
+}
@@ -0,0 +1,172 @@
+package main
+
+import "testing"
+
+func TestToSAN(t *testing.T) {
+	var tests = []struct {
+		fen      string
+		move     string
+		expected string
+	}{
+		{startPosition, "e2e4", "e4"},
+		{startPosition, "g1f3", "Nf3"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e2a6", "Bxa6"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "d5e6", "dxe6"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "e5f7", "Nxf7"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "0-0", "O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", "0-0-0", "O-O-O"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", "b4c3", "bxc3"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", "b6d5", "Nbxd5"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1", "f6d5", "Nfxd5"},
+		{"8/5k2/8/2Pp4/2B5/1K6/8/8 w - d6 0 1", "c5d6", "cxd6+"},
+		{"3r4/4P3/8/8/8/8/8/k3K3 w - - 0 1", "e7d8N", "exd8=N"},
+		{"3r4/4P3/8/8/8/8/8/k3K3 w - - 0 1", "e7e8Q", "e8=Q"},
+		{"R6R/8/8/8/8/8/2k5/4K3 w - - 0 1", "h8d8", "Rhd8"},
+		{"R3R3/8/8/8/8/2k5/8/4R1K1 w - - 0 1", "e8e4", "R8e4"},
+		{"Q1Q5/8/Q7/8/8/8/7k/4K3 w - - 0 1", "a8b7", "Qa8b7"},
+		{"Q1Q5/8/Q7/8/8/8/7k/4K3 w - - 0 1", "a6a4", "Qa4"},
+		{"6k1/5ppp/8/8/8/8/8/R3K3 w - - 0 1", "a1a8", "Ra8#"},
+		{"5k2/8/8/8/8/8/8/4K2R w K - 0 1", "0-0", "O-O+"},
+	}
+
+	for _, test := range tests {
+		position := mustFromFEN(test.fen)
+
+		found := false
+		for _, move := range generateLegalMoves(position) {
+			if toAlgebraic(position, move) != test.move {
+				continue
+			}
+
+			found = true
+			if san := toSAN(position, move); san != test.expected {
+				t.Errorf("SAN test failed!\nFEN: %v\nMove: %v\nExpected: %v\nGot: %v\n", test.fen, test.move, test.expected, san)
+			}
+		}
+
+		if !found {
+			t.Errorf("SAN test failed!\nFEN: %v\nMove %v is not legal\n", test.fen, test.move)
+		}
+	}
+}
+
+func TestParseSAN(t *testing.T) {
+	var tests = []struct {
+		fen  string
+		san  string
+		from string
+		to   string
+	}{
+		{startPosition, "e4", "e2", "e4"},
+		{startPosition, "Nf3", "g1", "f3"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "Bxa6", "e2", "a6"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "Nexf7", "e5", "f7"},
+		{"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1", "dxe6!?", "d5", "e6"},
+		{"3r4/4P3/8/8/8/8/8/k3K3 w - - 0 1", "exd8=N+", "e7", "d8"},
+		{"3r4/4P3/8/8/8/8/8/k3K3 w - - 0 1", "e8=Q", "e7", "e8"},
+		{"R6R/8/8/8/8/8/2k5/4K3 w - - 0 1", "Rhd8", "h8", "d8"},
+	}
+
+	for _, test := range tests {
+		position := mustFromFEN(test.fen)
+		move, err := parseSAN(position, test.san)
+
+		if err != nil || move.isCastle() || toAlgebraic(position, move)[:4] != test.from+test.to {
+			t.Errorf("Parsing SAN failed!\nFEN: %v\nMove: %v\nExpected: %v%v\nGot: %v (%v)\n", test.fen, test.san, test.from, test.to, toAlgebraic(position, move), err)
+		}
+	}
+
+	castling := mustFromFEN("r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1")
+	if move, err := parseSAN(castling, "O-O-O"); err != nil || !move.isQueenCastle() {
+		t.Errorf("Parsing SAN failed!\nCould not parse O-O-O\n")
+	}
+
+	for _, san := range []string{"Nxd7", "Rd1", "e5", "Kz9", "x"} {
+		if _, err := parseSAN(mustFromFEN("8/8/8/8/8/8/8/RK2k3 w - - 0 1"), san); err == nil {
+			t.Errorf("Parsing SAN failed!\nAccepted %v\n", san)
+		}
+	}
+}
+
+func TestParseTolerantSAN(t *testing.T) {
+	position := mustFromFEN("r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1")
+
+	var tests = []struct {
+		san      string
+		expected string
+	}{
+		{"Nf7", "Nxf7"},
+		{"N:f7!", "Nxf7"},
+		{"Ne5xf7", "Nxf7"},
+		{"Ne5-f7", "Nxf7"},
+		{"e5f7", "Nxf7"},
+		{"0-0", "O-O"},
+		{"O-O+", "O-O"},
+		{"Bd2-h6??", "Bh6"},
+		{"g2xh3", "gxh3"},
+		{"g2-g4", "g4"},
+	}
+
+	for _, test := range tests {
+		move, err := parseSAN(position, test.san)
+
+		if err != nil || toSAN(position, move) != test.expected {
+			t.Errorf("Tolerant SAN test failed!\nMove: %v\nExpected: %v\nGot: %v (%v)\n", test.san, test.expected, toSAN(position, move), err)
+		}
+	}
+
+	promotion := mustFromFEN("3r4/4P3/8/8/8/8/8/k3K3 w - - 0 1")
+	for _, san := range []string{"exd8=N", "exd8N", "ed8n", "e7d8(N)", "exd8/N"} {
+		if move, err := parseSAN(promotion, san); err != nil || toSAN(promotion, move) != "exd8=N" {
+			t.Errorf("Tolerant SAN test failed!\nCould not parse %v\n", san)
+		}
+	}
+
+	if _, err := parseSAN(mustFromFEN("R6R/8/8/8/8/8/2k5/4K3 w - - 0 1"), "Rd8"); err == nil {
+		t.Errorf("Tolerant SAN test failed!\nAccepted an ambiguous move\n")
+	}
+}
+
+// Every move of the perft positions, and of the positions following them, must
+// have a unique SAN which parses back to the same move.
+func TestSANRoundTrip(t *testing.T) {
+	fens := []string{
+		startPosition,
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+		"rnbq1k1r/pp1Pbppp/2p5/8/2B5/8/PPP1NnPP/RNBQK2R w KQ - 1 8",
+		"8/8/1k6/2b5/2pP4/8/5K2/8 b - d3 0 1",
+		"2K2r2/4P3/8/8/8/8/8/3k4 w - - 0 1",
+		"8/8/2k5/5q2/5n2/8/5K2/8 b - - 0 1",
+		"r3k2r/1b4bq/8/8/8/8/7B/R3K2R w KQkq - 0 1",
+	}
+
+	for _, fen := range fens {
+		root := mustFromFEN(fen)
+
+		positions := []position{root}
+		for _, move := range generateLegalMoves(root) {
+			child := root
+			makeMove(&child, move)
+			positions = append(positions, child)
+		}
+
+		for _, position := range positions {
+			seen := make(map[string]bool)
+
+			for _, move := range generateLegalMoves(position) {
+				san := toSAN(position, move)
+
+				if seen[san] {
+					t.Errorf("SAN round trip failed!\nFEN: %v\nDuplicate SAN %v\n", toFEN(position), san)
+				}
+				seen[san] = true
+
+				if parsed, err := parseSAN(position, san); err != nil || parsed != move {
+					t.Errorf("SAN round trip failed!\nFEN: %v\nMove: %v\nSAN: %v\nGot: %v (%v)\n", toFEN(position), toAlgebraic(position, move), san, toAlgebraic(position, parsed), err)
+				}
+			}
+		}
+	}
+}
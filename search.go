@@ -28,10 +28,44 @@ func runSearch(ctx context.Context, position position, depth int, ch chan move)
 	}
 }
 
+// The score of a side which is checkmated at the root. A side checkmated deeper
+// in the tree scores a point more for each ply, so that the quickest mate is
+// preferred by the winner and the slowest by the loser. It is above any
+// tablebase score, and below the initial cutoffs of a search.
+const mateScore = 50000
+
+/*
+searchState holds the state of a single search. Each search has its own, so
+that several can run at once, as they do when generating training data.
+
+nodes counts the positions visited. If nodeLimit is above 0, the search stops
+once that many nodes have been visited, leaving its result incomplete.
+*/
+type searchState struct {
+	nodes     int
+	nodeLimit int
+}
+
+// Has the search visited as many nodes as it is allowed to?
+func (state *searchState) outOfNodes() bool {
+	return state.nodeLimit > 0 && state.nodes >= state.nodeLimit
+}
+
 // Search for the best move for a position, to a given depth.
 func search(position position, depth int, alpha int, beta int) move {
-	// Generate all legal moves for the current position.
+	bestMove, _ := searchRoot(&searchState{}, position, depth, alpha, beta)
+	return bestMove
+}
+
+// Search for the best move for a position, to a given depth, returning the move
+// and its score for the side to move.
+func searchRoot(state *searchState, position position, depth int, alpha int, beta int) (move, int) {
+	// Generate all legal moves for the current position. If the position is in
+	// the tablebases, only the moves which keep its result are searched.
 	moves := generateLegalMoves(position)
+	if tablebaseMoves, ok := syzygyRootMoves(position); ok {
+		moves = tablebaseMoves
+	}
 
 	bestScore := -100000
 	var bestMove move
@@ -40,7 +74,7 @@ func search(position position, depth int, alpha int, beta int) move {
 	// identify the best outcome.
 	for _, move := range moves {
 		artifacts := makeMove(&position, move)
-		negamaxScore := -alphaBeta(&position, alpha, beta, depth)
+		negamaxScore := -alphaBeta(state, &position, alpha, beta, depth, 1)
 
 		if negamaxScore >= bestScore {
 			bestScore = negamaxScore
@@ -50,11 +84,34 @@ func search(position position, depth int, alpha int, beta int) move {
 		unmakeMove(&position, move, artifacts)
 	}
 
-	return bestMove
+	return bestMove, bestScore
+}
+
+/*
+Search for the best move for a position until a number of nodes have been
+visited, returning the move and its score for the side to move. The search
+deepens iteratively, and the result of the deepest complete iteration is used.
+If the position has no legal moves, the empty move is returned.
+*/
+func searchNodes(position position, nodeLimit int) (move, int) {
+	state := searchState{nodeLimit: nodeLimit}
+
+	bestMove, bestScore := searchRoot(&state, position, 1, -100000, 100000)
+
+	for depth := 2; state.nodes > 0 && !state.outOfNodes(); depth++ {
+		move, score := searchRoot(&state, position, depth, -100000, 100000)
+
+		if !state.outOfNodes() {
+			bestMove = move
+			bestScore = score
+		}
+	}
+
+	return bestMove, bestScore
 }
 
 /* Run a negamax search of the move tree from a given position, to a given
-depth. The negamax search finds the "least-bad" move; the move that minimises
+depth. ply is the position's distance from the root. The negamax search finds the "least-bad" move; the move that minimises
 the opponents advantage no matter how they play.
 
 An alpha-beta cutoff algorithm prunes the search tree to save time that would be
@@ -64,21 +121,77 @@ candidate.
 This funciton was implemented from the pseudocode at
 https://chessprogramming.wikispaces.com/Alpha-Beta.
 */
-func alphaBeta(position *position, alpha int, beta int, depth int) int {
-	// At the bottom of the tree, return the score of the position for the attacking player.
-	if depth == 0 {
+func alphaBeta(state *searchState, position *position, alpha int, beta int, depth int, ply int) int {
+	state.nodes++
+
+	// The result of a king and pawn against a king is known exactly, so there
+	// is no need to search any further.
+	if score, ok := probeKPKScore(*position); ok {
+		return score
+	}
+
+	// Likewise for positions in the Syzygy tablebases.
+	if score, ok := probeSyzygyScore(*position); ok {
+		return score
+	}
+
+	// When the search has run out of nodes, return the score of the position
+	// for the attacking player. At the bottom of the tree, the exchanges in
+	// progress are played out first.
+	if state.outOfNodes() {
 		return evaluate(*position)
 	}
 
-	// Otherwise, generate all possible moves.
-	moves := generateLegalMoves(*position)
+	if depth == 0 {
+		return quiescence(position, alpha, beta, ply, true, nil)
+	}
+
+	// Otherwise, generate the moves in stages: out of check, every move at
+	// once, and otherwise the captures, then the quiet moves only if none of
+	// the captures causes a cutoff.
+	restrictions := findRestrictions(position)
+
+	// A side in check without a move out of it is checkmated, and a side
+	// without any move otherwise is stalemated.
+	var moves moveList
+	if restrictions.checkers != 0 {
+		generateEvasions(position, &restrictions, &moves)
+
+		if moves.count == 0 {
+			return -mateScore + ply
+		}
+
+		return searchMoves(state, position, moves.slice(), alpha, beta, depth, ply)
+	}
+
+	generateCaptures(position, &restrictions, &moves)
+	orderCaptures(position, &moves)
+	captures := moves.count
+
+	if alpha = searchMoves(state, position, moves.slice(), alpha, beta, depth, ply); alpha >= beta {
+		return beta
+	}
+
+	moves.count = 0
+	generateQuiets(position, &restrictions, &moves)
+
+	if captures == 0 && moves.count == 0 {
+		return 0
+	}
+
+	return searchMoves(state, position, moves.slice(), alpha, beta, depth, ply)
+}
+
+// Search each of a position's moves in turn, as part of alphaBeta, returning
+// the new alpha, or beta if one of them causes a cutoff.
+func searchMoves(state *searchState, position *position, moves []move, alpha int, beta int, depth int, ply int) int {
 	for _, move := range moves {
 
 		// Make the move.
 		artifacts := makeMove(position, move)
 
 		// Recursively call the search function to determine the move's score.
-		score := -alphaBeta(position, -beta, -alpha, depth-1)
+		score := -alphaBeta(state, position, -beta, -alpha, depth-1, ply+1)
 
 		// If the score is higher than the beta cutoff, the rest of the search
 		// tree is irrelevant and the cutoff is returned.
@@ -98,3 +211,102 @@ func alphaBeta(position *position, alpha int, beta int, depth int) int {
 
 	return alpha
 }
+
+/* Run a quiescence search from a given position. Only captures and promotions
+are searched, until the position is quiet, so that the evaluation isn't taken in
+the middle of an exchange of pieces. The side to move can always "stand pat"
+instead of capturing, so the static evaluation is a lower bound on the score.
+
+ply is the position's distance from the root, for scoring checkmates. If checks
+is true, the quiet moves which give check are searched as well, as they are at
+the first ply of the quiescence search. A side in check can't stand pat, and
+searches every move out of check instead, or is checkmated if there are none.
+
+If leaf is not nil, it is set to the quiet position at the end of the principal
+variation, which is the position whose evaluation was returned.
+*/
+func quiescence(position *position, alpha int, beta int, ply int, checks bool, leaf *position) int {
+	if leaf != nil {
+		*leaf = *position
+	}
+
+	restrictions := findRestrictions(position)
+
+	var moves moveList
+
+	if restrictions.checkers != 0 {
+		generateEvasions(position, &restrictions, &moves)
+
+		if moves.count == 0 {
+			return -mateScore + ply
+		}
+
+		return searchQuiescenceMoves(position, moves.slice(), alpha, beta, ply, leaf)
+	}
+
+	standPat := evaluate(*position)
+
+	if standPat >= beta {
+		return beta
+	}
+
+	if standPat > alpha {
+		alpha = standPat
+	}
+
+	generateCaptures(position, &restrictions, &moves)
+	orderCaptures(position, &moves)
+
+	// Captures which lose material in exchange are unlikely to raise the
+	// score above standing pat, so they aren't searched.
+	good := 0
+	for _, move := range moves.slice() {
+		if see(position, move, 0) {
+			moves.moves[good] = move
+			good++
+		}
+	}
+	moves.count = good
+
+	if checks {
+		generateQuietChecks(position, &restrictions, &moves)
+	}
+
+	return searchQuiescenceMoves(position, moves.slice(), alpha, beta, ply, leaf)
+}
+
+// Search each of a position's moves in turn, as part of quiescence, returning
+// the new alpha, or beta if one of them causes a cutoff.
+func searchQuiescenceMoves(position *position, moves []move, alpha int, beta int, ply int, leaf *position) int {
+	for _, move := range moves {
+		// The child search needs its own leaf, since it only replaces this
+		// one if the move is best.
+		childLeaf := leaf
+		if leaf != nil {
+			copied := *leaf
+			childLeaf = &copied
+		}
+
+		artifacts := makeMove(position, move)
+		score := -quiescence(position, -beta, -alpha, ply+1, false, childLeaf)
+		unmakeMove(position, move, artifacts)
+
+		if score >= beta {
+			if leaf != nil {
+				*leaf = *childLeaf
+			}
+
+			return beta
+		}
+
+		if score > alpha {
+			alpha = score
+
+			if leaf != nil {
+				*leaf = *childLeaf
+			}
+		}
+	}
+
+	return alpha
+}
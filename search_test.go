@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestMateScores(t *testing.T) {
+	var tests = []struct {
+		name     string
+		fen      string
+		ply      int
+		expected int
+	}{
+		{"Checkmated", "R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1", 3, -mateScore + 3},
+		{"Stalemated", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", 3, 0},
+	}
+
+	for _, test := range tests {
+		position := mustFromFEN(test.fen)
+
+		if score := alphaBeta(&searchState{}, &position, -100000, 100000, 2, test.ply); score != test.expected {
+			t.Errorf("Mate score test failed!\nPosition: %v\nExpected: %v\nGot: %v\n", test.name, test.expected, score)
+		}
+	}
+
+	checkmated := mustFromFEN("R5k1/5ppp/8/8/8/8/8/6K1 b - - 0 1")
+	if score := quiescence(&checkmated, -100000, 100000, 3, true, nil); score != -mateScore+3 {
+		t.Errorf("Mate score test failed!\nExpected quiescence to score the checkmate %v\nGot: %v\n", -mateScore+3, score)
+	}
+}
+
+func TestSearchFindsMate(t *testing.T) {
+	var tests = []struct {
+		fen      string
+		depth    int
+		expected string
+		score    int
+	}{
+		{"6k1/5ppp/8/8/8/8/8/R5K1 w - - 0 1", 1, "a1a8", mateScore - 1},
+		{"6k1/5ppp/8/8/8/8/5PPP/R5K1 w - - 0 1", 2, "a1a8", mateScore - 1},
+	}
+
+	for _, test := range tests {
+		position := mustFromFEN(test.fen)
+		bestMove, score := searchRoot(&searchState{}, position, test.depth, -100000, 100000)
+
+		if toUCI(position, bestMove) != test.expected || score != test.score {
+			t.Errorf("Search mate test failed!\nFEN: %v\nExpected: %v (%v)\nGot: %v (%v)\n", test.fen, test.expected, test.score, toUCI(position, bestMove), score)
+		}
+	}
+}
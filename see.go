@@ -0,0 +1,255 @@
+package main
+
+import "math/bits"
+
+/*
+Static exchange evaluation (SEE) finds the material won or lost by a capture,
+by playing out the exchange of pieces on its square without searching. After
+the capture, the sides take turns recapturing with their least valuable piece
+which attacks the square, and either side may stop instead of recapturing when
+that would lose material. Pieces behind a slider which attack the square once
+it has captured, like a rook behind a queen on the same file, join the exchange
+as the pieces in front of them leave.
+
+Pins are ignored, so a pinned piece may recapture. The material values are the
+weights of the evaluation.
+*/
+
+// Find the material value of a piece identity, for exchanges.
+func seeValue(identity piece) int {
+	switch identity {
+	case Pawn:
+		return evalParams.PawnWeight
+	case Knight:
+		return evalParams.KnightWeight
+	case Bishop:
+		return evalParams.BishopWeight
+	case Rook:
+		return evalParams.RookWeight
+	case Queen:
+		return evalParams.QueenWeight
+	case King:
+		return evalParams.KingWeight
+	}
+
+	return 0
+}
+
+// Find the least valuable piece of a colour which attacks a standard square,
+// given the occupied squares, returning its square and identity. The square is
+// -1 if there are no attackers.
+func leastValuableAttacker(position *position, square int, occupied uint64, color byte) (int, piece) {
+	attackers := attackersOf(position, square, occupied, color) & occupied
+	pieces := &position.pieces[sideIndex(color)]
+
+	for _, identity := range [...]piece{Pawn, Knight, Bishop, Rook, Queen, King} {
+		if attackers&pieces[identity] != 0 {
+			return bits.TrailingZeros64(attackers & pieces[identity]), identity
+		}
+	}
+
+	return -1, 0
+}
+
+/*
+Find the material the side making a move wins by the exchange it starts on the
+move's square, which is negative if it loses material. The move needn't be a
+capture, in which case it's the material lost if the piece moved is taken.
+
+This is the swap algorithm from https://chessprogramming.wikispaces.com/SEE+-+The+Swap+Algorithm.
+gain[depth] holds the material won by the side making the capture at that
+depth, if the exchange stopped after it, and is assumed until the exchange ends
+that every capture is made. Working back from the end, each side then only
+makes its capture if it does better than stopping before it.
+*/
+func staticExchange(position *position, move move) int {
+	if move.isCastle() {
+		return 0
+	}
+
+	from := int(map0x88ToStandard(int(move.From())))
+	to := int(map0x88ToStandard(int(move.To())))
+	mover := position.board[move.From()]
+	color := mover.color()
+	occupied := position.occupied[0] | position.occupied[1]
+
+	var gain [32]int
+
+	if move.isEnPassantCapture() {
+		gain[0] = seeValue(Pawn)
+		occupied &^= 1 << (from - from%8 + to%8)
+	} else {
+		gain[0] = seeValue(position.board[move.To()].identity())
+	}
+
+	// The piece standing on the square, which the next capture takes.
+	attacker := mover.identity()
+	if move.isPromotion() {
+		attacker = move.getPromotedPiece(mover).identity()
+		gain[0] += seeValue(attacker) - seeValue(Pawn)
+	}
+
+	depth := 0
+	for depth+1 < len(gain) {
+		depth++
+		color = opposingColor(color)
+
+		gain[depth] = seeValue(attacker) - gain[depth-1]
+
+		occupied &^= 1 << from
+		if from, attacker = leastValuableAttacker(position, to, occupied, color); from < 0 {
+			break
+		}
+	}
+
+	// The last entry is the capture which couldn't be made.
+	for depth--; depth > 0; depth-- {
+		gain[depth-1] = -max(-gain[depth-1], gain[depth])
+	}
+
+	return gain[0]
+}
+
+/*
+Determine whether the exchange started by a move wins at least the threshold,
+in material, for the side making it. This gives the same answer as comparing
+staticExchange with the threshold, but stops as soon as the answer is known.
+
+It is based on the implementation in Stockfish. The goal of the side making the
+move is to reach the threshold, and the goal of the other side is to keep it
+below. balance holds how far past its goal a side would be if it made the next
+capture and the exchange then stopped. Since a side can always stop instead of
+recapturing, one which can't reach its goal even then won't capture, and the
+exchange stops, as it does when a side has no attackers left.
+*/
+func see(position *position, move move, threshold int) bool {
+	// Special moves are rare enough to play out in full.
+	if move.isCastle() || move.isPromotion() || move.isEnPassantCapture() {
+		return staticExchange(position, move) >= threshold
+	}
+
+	balance := seeValue(position.board[move.To()].identity()) - threshold
+	if balance < 0 {
+		return false
+	}
+
+	balance = seeValue(position.board[move.From()].identity()) - balance
+	if balance <= 0 {
+		return true
+	}
+
+	from := int(map0x88ToStandard(int(move.From())))
+	to := int(map0x88ToStandard(int(move.To())))
+	color := position.board[move.From()].color()
+
+	occupied := (position.occupied[0]|position.occupied[1])&^(1<<from) | 1<<to
+	attackers := attackersOf(position, to, occupied, White) | attackersOf(position, to, occupied, Black)
+
+	pieces := &position.pieces
+	diagonal := pieces[0][Bishop] | pieces[0][Queen] | pieces[1][Bishop] | pieces[1][Queen]
+	straight := pieces[0][Rook] | pieces[0][Queen] | pieces[1][Rook] | pieces[1][Queen]
+
+	// Whether the side making the move reaches the threshold, if the exchange
+	// stops now.
+	result := true
+
+	for {
+		color = opposingColor(color)
+		attackers &= occupied
+
+		own := attackers & position.occupied[sideIndex(color)]
+		if own == 0 {
+			break
+		}
+
+		result = !result
+
+		var identity piece
+		for _, identity = range [...]piece{Pawn, Knight, Bishop, Rook, Queen, King} {
+			if own&pieces[sideIndex(color)][identity] != 0 {
+				break
+			}
+		}
+
+		// The king can only capture if the other side has no attackers left.
+		if identity == King {
+			if attackers&^position.occupied[sideIndex(color)] != 0 {
+				result = !result
+			}
+
+			break
+		}
+
+		// If the other side can't reach its goal by taking this piece back,
+		// the exchange stops here.
+		balance = seeValue(identity) - balance
+		if balance < 0 || (balance == 0 && result) {
+			break
+		}
+
+		occupied &^= 1 << bits.TrailingZeros64(own&pieces[sideIndex(color)][identity])
+
+		// Sliders behind the capturing piece now attack the square.
+		if identity == Pawn || identity == Bishop || identity == Queen {
+			attackers |= bishopAttacksFrom(to, occupied) & diagonal
+		}
+
+		if identity == Rook || identity == Queen {
+			attackers |= rookAttacksFrom(to, occupied) & straight
+		}
+	}
+
+	return result
+}
+
+// Sort a list of captures by the material they win in exchange, from most to
+// least, so that the best captures are searched first. Captures which win the
+// same material keep their order.
+func orderCaptures(position *position, list *moveList) {
+	var values [maxMoves]int
+	moves := list.slice()
+
+	for i, move := range moves {
+		values[i] = staticExchange(position, move)
+	}
+
+	for i := 1; i < len(moves); i++ {
+		move, value := moves[i], values[i]
+
+		j := i
+		for ; j > 0 && values[j-1] < value; j-- {
+			moves[j], values[j] = moves[j-1], values[j-1]
+		}
+
+		moves[j], values[j] = move, value
+	}
+}
+
+/*
+evaluateThreats returns the score of each side for its hanging pieces: those
+which the enemy wins material by capturing with its least valuable attacker,
+found from the attack map of each side. A capture by a piece worth less than
+the one it takes always wins material, so only the other captures need to be
+played out. Either side's pieces may be hanging, since the side to move can
+only save or take one piece at a time.
+*/
+func evaluateThreats(position *position, attacks *[2]attackMap) [2]score {
+	var scores [2]score
+
+	for side := range scores {
+		enemy := 1 - side
+
+		for _, identity := range [...]piece{Pawn, Knight, Bishop, Rook, Queen} {
+			for remaining := position.pieces[side][identity] & attacks[enemy].attacked; remaining != 0; remaining &= remaining - 1 {
+				square := bits.TrailingZeros64(remaining)
+				from, attacker := attacks[enemy].leastValuableAttacker(&position.pieces[enemy], square)
+
+				if seeValue(attacker) < seeValue(identity) || see(position, createCaptureMove(standardTo0x88(from), standardTo0x88(square)), 1) {
+					scores[side].add(score{evalParams.HangingPieceMg, evalParams.HangingPieceEg})
+				}
+			}
+		}
+	}
+
+	return scores
+}
@@ -0,0 +1,104 @@
+package main
+
+import "testing"
+
+func TestStaticExchange(t *testing.T) {
+	cases := []struct {
+		name     string
+		fen      string
+		san      string
+		expected int
+	}{
+		{"Undefended pawn", "4k3/8/8/3p4/4P3/8/8/4K3 w - - 0 1", "exd5", 100},
+		{"Defended pawn", "4k3/8/2p5/3p4/4P3/8/8/4K3 w - - 0 1", "exd5", 0},
+		{"Knight takes defended pawn", "4k3/8/2p5/3p4/8/2N5/8/4K3 w - - 0 1", "Nxd5", -200},
+		{"Queen behind rook", "3rk3/8/8/3p4/8/8/3R4/3QK3 w - - 0 1", "Rxd5", 100},
+		{"Rooks behind each other", "3rk3/3r4/8/3p4/8/8/3R4/3QK3 w - - 0 1", "Rxd5", -400},
+		{"King recaptures", "3rk3/8/8/8/8/8/3Q4/4K3 b - - 0 1", "Rxd2+", 400},
+		{"King can't recapture", "3rk3/8/8/b7/8/8/3Q4/4K3 b - - 0 1", "Rxd2+", 900},
+		{"Promotion", "4k3/1P6/8/8/8/8/8/4K3 w - - 0 1", "b8=Q+", 800},
+		{"En passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "exd6", 100},
+		{"Quiet move onto an attacked square", "4k3/8/2p5/8/8/8/8/3QK3 w - - 0 1", "Qd5", -900},
+		{"Castling", "4k3/8/8/8/8/8/8/4K2R w K - 0 1", "O-O", 0},
+	}
+
+	for _, test := range cases {
+		position := mustFromFEN(test.fen)
+
+		move, err := parseSAN(position, test.san)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if value := staticExchange(&position, move); value != test.expected {
+			t.Errorf("Static exchange test (%v) failed!\nExpected: %v\nActual: %v\n", test.name, test.expected, value)
+		}
+
+		if !see(&position, move, test.expected) || see(&position, move, test.expected+1) {
+			t.Errorf("SEE threshold test (%v) failed!\nExpected the threshold to be %v\n", test.name, test.expected)
+		}
+	}
+}
+
+func TestSEEMatchesStaticExchange(t *testing.T) {
+	// Check the threshold version against the full exchange for every move,
+	// throughout the first plies of positions with many captures.
+	fens := []string{
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"1k1r3q/1ppn3p/p4b2/4p3/8/P2N2P1/1PP1R1BP/2K1Q3 w - - 0 1",
+		"r1bqkb1r/pppp1ppp/2n2n2/1B2p3/4P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+		"r3k2r/Pppp1ppp/1b3nbN/nP6/BBP1P3/q4N2/Pp1P2PP/R2Q1RK1 w kq - 0 1",
+	}
+
+	var walk func(position position, depth int)
+	walk = func(position position, depth int) {
+		for _, move := range generateLegalMoves(position) {
+			value := staticExchange(&position, move)
+
+			if !see(&position, move, value) || see(&position, move, value+1) {
+				t.Errorf("SEE test failed!\nFEN: %v\nMove: %v\nExchange: %v\n", toFEN(position), toAlgebraic(position, move), value)
+			}
+
+			if depth > 1 {
+				artifacts := makeMove(&position, move)
+				walk(position, depth-1)
+				unmakeMove(&position, move, artifacts)
+			}
+		}
+	}
+
+	for _, fen := range fens {
+		walk(mustFromFEN(fen), 2)
+	}
+}
+
+func TestEvaluateThreats(t *testing.T) {
+	// The number of hanging pieces of each side.
+	cases := []struct {
+		name     string
+		fen      string
+		expected [2]int
+	}{
+		{"Starting position", startPosition, [2]int{0, 0}},
+		{"Undefended pawn", "4k3/8/2p5/3p4/4P3/8/8/4K3 w - - 0 1", [2]int{1, 0}},
+		{"Knight attacked by a pawn", "4k3/8/2p5/3n4/4P3/8/8/4K3 w - - 0 1", [2]int{0, 1}},
+		{"Rooks defended by their kings", "3rk3/8/8/8/8/8/8/3RK3 w - - 0 1", [2]int{0, 0}},
+		{"Undefended rook", "3rk3/8/8/8/8/8/8/3R2K1 w - - 0 1", [2]int{1, 0}},
+		{"Rook defended by a rook", "3rk3/8/8/3r4/8/8/8/3RK3 w - - 0 1", [2]int{1, 0}},
+		{"Knight attacked more often than defended", "4k3/8/5n2/3n4/8/1BN1N3/3P4/4K3 w - - 0 1", [2]int{0, 1}},
+	}
+
+	for _, test := range cases {
+		position := mustFromFEN(test.fen)
+		pieces, _, occupied := evaluationBitboards(position)
+		scores := evaluateThreats(&position, evaluationAttacks(pieces, occupied))
+
+		for side, count := range test.expected {
+			expected := score{count * evalParams.HangingPieceMg, count * evalParams.HangingPieceEg}
+
+			if scores[side] != expected {
+				t.Errorf("Threats test (%v) failed!\nSide: %v\nExpected: %v\nActual: %v\n", test.name, side, expected, scores[side])
+			}
+		}
+	}
+}
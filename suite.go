@@ -0,0 +1,120 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+)
+
+/*
+The perft and suite commands run the records of an EPD file. perft checks the
+move generator against the node counts of each record's D1 to D6 operations, up
+to a maximum depth. suite searches each record for a number of nodes, and
+counts the positions where the engine finds one of the best moves, and none of
+the moves to avoid.
+*/
+
+// Run the perft command, given its command line arguments.
+func runPerft(args []string) {
+	flags := flag.NewFlagSet("perft", flag.ExitOnError)
+	epdPath := flags.String("epd", "", "EPD file of positions with perft node counts")
+	depth := flags.Int("depth", epdMaxPerftDepth, "Maximum depth to check")
+	flags.Parse(args)
+
+	records, err := loadEPD(*epdPath)
+	if err != nil {
+		log.Fatal("Could not load EPD file: ", err)
+	}
+
+	failures := 0
+	for i, record := range records {
+		if err := checkPerftRecord(record, *depth); err != nil {
+			fmt.Printf("%v: %v\n", i+1, err)
+			failures++
+		}
+	}
+
+	fmt.Printf("Passed %v of %v positions\n", len(records)-failures, len(records))
+}
+
+// Check the perft node counts of a record, up to a maximum depth.
+func checkPerftRecord(record epdRecord, maxDepth int) error {
+	for depth := 1; depth <= maxDepth; depth++ {
+		expected, ok := record.perft[depth]
+		if !ok {
+			continue
+		}
+
+		if nodes := perft(record.position, depth).nodes; nodes != expected {
+			return fmt.Errorf("%v: depth %v expected %v nodes, got %v", toFEN(record.position), depth, expected, nodes)
+		}
+	}
+
+	return nil
+}
+
+// Run the suite command, given its command line arguments.
+func runSuite(args []string) {
+	flags := flag.NewFlagSet("suite", flag.ExitOnError)
+	epdPath := flags.String("epd", "", "EPD file of positions with best moves or moves to avoid")
+	nodes := flags.Int("nodes", 100000, "Number of nodes to search for each position")
+	flags.Parse(args)
+
+	records, err := loadEPD(*epdPath)
+	if err != nil {
+		log.Fatal("Could not load EPD file: ", err)
+	}
+
+	solved := 0
+	for i, record := range records {
+		move, ok := solveSuiteRecord(record, *nodes)
+
+		status := "failed"
+		if ok {
+			status = "solved"
+			solved++
+		}
+
+		name := record.id
+		if name == "" {
+			name = fmt.Sprintf("%v", i+1)
+		}
+
+		fmt.Printf("%v: %v %v (expected %v)\n", name, toSAN(record.position, move), status, expectedMoves(record))
+	}
+
+	fmt.Printf("Solved %v of %v positions\n", solved, len(records))
+}
+
+// Search a record's position, returning the move found and whether it is one
+// of the best moves, and none of the moves to avoid.
+func solveSuiteRecord(record epdRecord, nodes int) (move, bool) {
+	found, _ := searchNodes(record.position, nodes)
+
+	solved := len(record.bestMoves) == 0
+	for _, move := range record.bestMoves {
+		solved = solved || move == found
+	}
+
+	for _, move := range record.avoidMoves {
+		solved = solved && move != found
+	}
+
+	return found, solved
+}
+
+// Describe the moves a suite expects, for its output.
+func expectedMoves(record epdRecord) string {
+	var descriptions []string
+
+	for _, move := range record.bestMoves {
+		descriptions = append(descriptions, toSAN(record.position, move))
+	}
+
+	for _, move := range record.avoidMoves {
+		descriptions = append(descriptions, "not "+toSAN(record.position, move))
+	}
+
+	return strings.Join(descriptions, ", ")
+}
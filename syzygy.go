@@ -0,0 +1,1483 @@
+package main
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+The Syzygy tablebases hold the exact result of every position with a few pieces
+left on the board. Each material balance, such as KRPvKR, has two files: a WDL
+file, giving whether the position is won, drawn or lost for the side to move,
+and a DTZ file, giving the number of plies until the next capture or pawn move
+on the way to that result.
+
+The tables are loaded from the directories of the SyzygyPath option. A table is
+read into memory the first time it is probed, so only the tables the search
+reaches cost anything. Since each file is read whole, only tables of up to five
+pieces are used: these are at most a few tens of megabytes, while single files
+of six and seven pieces run to gigabytes, and are ignored.
+
+Results in the tables account for the fifty-move rule. A cursed win is won, but
+only if the fifty-move rule is ignored, and a blessed loss is the opposite.
+
+The file format and the indexing scheme follow the original probing code by
+Ronald de Man, and its port to Stockfish. Positions are indexed by their pieces'
+squares, after the board has been mirrored to bring the leading piece or pawn
+into a canonical part of it, and the tables are stored as blocks of Huffman
+codes, each of which expands into a run of results by recursive pairing.
+*/
+
+const syzygyMaxPieces = 5
+
+const syzygyWDLMagic = "\x71\xe8\x23\x5d"
+const syzygyDTZMagic = "\xd7\x66\x0c\xa5"
+
+// Results in the WDL tables, for the side to move.
+const wdlLoss = -2
+const wdlBlessedLoss = -1
+const wdlDraw = 0
+const wdlCursedWin = 1
+const wdlWin = 2
+
+// The outcomes of probing a table. probeChangeSide means that a DTZ table only
+// holds the other side to move, and probeZeroingBestMove that the best move is
+// a capture or pawn move, so that its DTZ isn't stored.
+const probeFail = 0
+const probeOK = 1
+const probeChangeSide = -1
+const probeZeroingBestMove = 2
+
+// Flags of each table within a file.
+const tbFlagSideToMove = 1
+const tbFlagMapped = 2
+const tbFlagWinPlies = 4
+const tbFlagLossPlies = 8
+const tbFlagWide = 16
+const tbFlagSingleValue = 128
+
+// The score used in the search for a tablebase win. It is above any score of
+// the evaluation, so that a known win is always preferred.
+const tablebaseWinScore = 20000
+
+// The search scores of each WDL result, indexed by the result plus 2.
+var tablebaseScores = [5]int{-tablebaseWinScore, -1, 0, 1, tablebaseWinScore}
+
+/*
+pairsData holds what is needed to read the results of one table in a file.
+There is one for each side to move in the WDL files, unless both sides have the
+same pieces, and one for each file of the leading pawn in tables with pawns.
+
+The offsets are into the file's data. symlen holds the number of results, minus
+one, that each symbol expands into, and base64 the lowest code of each length,
+padded to 64 bits.
+*/
+type pairsData struct {
+	file            []byte
+	flags           byte
+	maxSymLen       int
+	minSymLen       int
+	numBlocks       int
+	blockSize       int
+	span            uint64
+	lowestSym       int
+	btree           int
+	blockLength     int
+	blockLengthSize int
+	sparseIndex     int
+	sparseIndexSize int
+	data            int
+	base64          []uint64
+	symlen          []byte
+	pieces          [syzygyMaxPieces]byte
+	groupIndex      [syzygyMaxPieces + 1]uint64
+	groupLength     [syzygyMaxPieces + 1]int
+	mapIndex        [4]int
+}
+
+/*
+tablebase is a single WDL or DTZ file. name is its canonical material, with the
+stronger side first, which is the side the table is stored for. If the sides
+have pawns, the leading side is the one with fewer, and pawnCount holds the
+number of pawns of the leading side first.
+*/
+type tablebase struct {
+	name            string
+	path            string
+	dtz             bool
+	pieceCount      int
+	hasPawns        bool
+	hasUniquePieces bool
+	symmetric       bool
+	pawnCount       [2]int
+	lock            sync.Mutex
+	loaded          bool
+	failed          bool
+	mapOffset       int
+	items           [2][4]pairsData
+}
+
+// The tables found on the SyzygyPath, by material in both orders, and the
+// largest number of pieces in any WDL table.
+type syzygyTables struct {
+	wdl     map[string]*tablebase
+	dtz     map[string]*tablebase
+	largest int
+}
+
+// The tables in use. The SyzygyPath option can replace them while a search is
+// probing them, so they're swapped as a whole, and each probe works with the
+// set it started with.
+var syzygyInUse atomic.Pointer[syzygyTables]
+
+// Find the tables in use, which are empty until a path has been set.
+func currentSyzygyTables() *syzygyTables {
+	if tables := syzygyInUse.Load(); tables != nil {
+		return tables
+	}
+
+	return &syzygyTables{}
+}
+
+/*
+The tables used to index positions, which are the same for every file:
+
+	mapPawns:        pawn squares to 0-47, highest towards the edge and nearest
+	                 the second rank, so the leading pawn is the highest
+	mapB1H1H7:       squares below the a1-h8 diagonal to 0-27
+	mapA1D1D4:       the a1-d1-d4 triangle to 0-9, the diagonal last
+	mapKK:           legal placements of two kings to 0-461, with the first
+	                 in the a1-d1-d4 triangle
+	binomial:        binomial[k][n] is the number of ways of choosing k of n
+	leadPawnIndex:   the first index of each leading pawn square
+	leadPawnsSize:   the number of indices of leading pawns on each file
+*/
+type syzygyIndexTables struct {
+	mapPawns      [64]int
+	mapB1H1H7     [64]int
+	mapA1D1D4     [64]int
+	mapKK         [10][64]int
+	binomial      [6][64]uint64
+	leadPawnIndex [6][64]uint64
+	leadPawnsSize [6][4]uint64
+}
+
+var syzygyIndices = generateSyzygyIndices()
+
+// How far a square is above the a1-h8 diagonal, negative if it is below.
+func offDiagonal(square int) int {
+	return square/8 - square%8
+}
+
+// Swap a square across the a1-h8 diagonal.
+func flipDiagonal(square int) int {
+	return ((square >> 3) | (square << 3)) & 63
+}
+
+// Generate the tables used to index positions.
+func generateSyzygyIndices() *syzygyIndexTables {
+	tables := &syzygyIndexTables{}
+
+	code := 0
+	for square := 0; square < 64; square++ {
+		if offDiagonal(square) < 0 {
+			tables.mapB1H1H7[square] = code
+			code++
+		}
+	}
+
+	var diagonal []int
+	code = 0
+	for square := 0; square < 28; square++ {
+		if square%8 > 3 {
+			continue
+		}
+
+		if offDiagonal(square) < 0 {
+			tables.mapA1D1D4[square] = code
+			code++
+		} else if offDiagonal(square) == 0 {
+			diagonal = append(diagonal, square)
+		}
+	}
+
+	for _, square := range diagonal {
+		tables.mapA1D1D4[square] = code
+		code++
+	}
+
+	// Placements with both kings on the diagonal come last.
+	var bothOnDiagonal [][2]int
+	code = 0
+	for index := 0; index < 10; index++ {
+		for first := 0; first < 28; first++ {
+			if first%8 > 3 || tables.mapA1D1D4[first] != index || (index == 0 && first != 1) {
+				continue
+			}
+
+			for second := 0; second < 64; second++ {
+				switch {
+				case squareDistance(first, second) <= 1:
+					continue
+				case offDiagonal(first) == 0 && offDiagonal(second) > 0:
+					continue
+				case offDiagonal(first) == 0 && offDiagonal(second) == 0:
+					bothOnDiagonal = append(bothOnDiagonal, [2]int{index, second})
+				default:
+					tables.mapKK[index][second] = code
+					code++
+				}
+			}
+		}
+	}
+
+	for _, placement := range bothOnDiagonal {
+		tables.mapKK[placement[0]][placement[1]] = code
+		code++
+	}
+
+	tables.binomial[0][0] = 1
+	for n := 1; n < 64; n++ {
+		for k := 0; k < 6 && k <= n; k++ {
+			if k > 0 {
+				tables.binomial[k][n] += tables.binomial[k-1][n-1]
+			}
+
+			if k < n {
+				tables.binomial[k][n] += tables.binomial[k][n-1]
+			}
+		}
+	}
+
+	available := 47
+	for leadPawns := 1; leadPawns < 6; leadPawns++ {
+		for file := 0; file < 4; file++ {
+			index := uint64(0)
+
+			for rank := 1; rank < 7; rank++ {
+				square := rank*8 + file
+
+				if leadPawns == 1 {
+					tables.mapPawns[square] = available
+					tables.mapPawns[square^7] = available - 1
+					available -= 2
+				}
+
+				tables.leadPawnIndex[leadPawns][square] = index
+				index += tables.binomial[leadPawns-1][tables.mapPawns[square]]
+			}
+
+			tables.leadPawnsSize[leadPawns][file] = index
+		}
+	}
+
+	return tables
+}
+
+// The order of pieces in the names of tables, and their codes in the files.
+const syzygyPieceLetters = "KQRBNP"
+
+var syzygyPieces = [6]piece{King, Queen, Rook, Bishop, Knight, Pawn}
+var syzygyPieceCodes = [8]byte{Pawn: 1, Knight: 2, Bishop: 3, Rook: 4, Queen: 5, King: 6}
+
+// Find the code of a piece in the table files, where black pieces have the
+// high bit set.
+func syzygyPieceCode(p piece) byte {
+	code := syzygyPieceCodes[p.identity()]
+	if p.color() == Black {
+		code |= 8
+	}
+
+	return code
+}
+
+// Name the material of one side, given its count of each piece.
+func syzygySideName(counts [6]int) string {
+	var name strings.Builder
+
+	for i, count := range counts {
+		name.WriteString(strings.Repeat(syzygyPieceLetters[i:i+1], count))
+	}
+
+	return name.String()
+}
+
+// Name the material of a position, white first.
+func syzygyMaterialName(position position) string {
+	var counts [2][6]int
+
+	for square := 0; square < 64; square++ {
+		p := position.board[standardTo0x88(square)]
+
+		for i, syzygyPiece := range syzygyPieces {
+			if p.exists() && p.is(syzygyPiece) {
+				counts[sideIndex(p.color())][i]++
+			}
+		}
+	}
+
+	return syzygySideName(counts[0]) + "v" + syzygySideName(counts[1])
+}
+
+// Count the pieces on the board, including kings.
+func countPieces(position position) int {
+	count := 0
+
+	for square := 0; square < 64; square++ {
+		if position.board[standardTo0x88(square)].exists() {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Create a table for a file, given the material in its name. False is returned
+// if the name isn't valid material.
+func newTablebase(material string, path string, dtz bool) (*tablebase, bool) {
+	sides := strings.Split(material, "v")
+	if len(sides) != 2 {
+		return nil, false
+	}
+
+	var counts [2][6]int
+	for side, letters := range sides {
+		for _, letter := range letters {
+			index := strings.IndexRune(syzygyPieceLetters, letter)
+			if index == -1 {
+				return nil, false
+			}
+
+			counts[side][index]++
+		}
+
+		if counts[side][0] != 1 {
+			return nil, false
+		}
+	}
+
+	table := &tablebase{
+		name:       syzygySideName(counts[0]) + "v" + syzygySideName(counts[1]),
+		path:       path,
+		dtz:        dtz,
+		pieceCount: len(sides[0]) + len(sides[1]),
+		hasPawns:   counts[0][5]+counts[1][5] > 0,
+		symmetric:  counts[0] == counts[1],
+	}
+
+	if table.pieceCount > syzygyMaxPieces {
+		return nil, false
+	}
+
+	for side := 0; side < 2; side++ {
+		for i := 1; i < 6; i++ {
+			if counts[side][i] == 1 {
+				table.hasUniquePieces = true
+			}
+		}
+	}
+
+	// The side with fewer pawns leads, since it compresses better.
+	whitePawns := counts[0][5]
+	blackPawns := counts[1][5]
+	if blackPawns == 0 || (whitePawns > 0 && blackPawns >= whitePawns) {
+		table.pawnCount = [2]int{whitePawns, blackPawns}
+	} else {
+		table.pawnCount = [2]int{blackPawns, whitePawns}
+	}
+
+	return table, true
+}
+
+// The name of a table's material with the sides swapped.
+func (table *tablebase) swappedName() string {
+	sides := strings.Split(table.name, "v")
+	return sides[1] + "v" + sides[0]
+}
+
+/*
+Find the tables in a list of directories, separated as in the PATH environment
+variable, replacing any found before. Tables in earlier directories take
+precedence. The number of files found is returned.
+*/
+func setSyzygyPath(paths string) int {
+	wdl := map[string]*tablebase{}
+	dtz := map[string]*tablebase{}
+	largest := 0
+	count := 0
+
+	if paths == "<empty>" {
+		paths = ""
+	}
+
+	for _, directory := range filepath.SplitList(paths) {
+		entries, err := os.ReadDir(directory)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			extension := filepath.Ext(entry.Name())
+			if entry.IsDir() || (extension != ".rtbw" && extension != ".rtbz") {
+				continue
+			}
+
+			material := strings.TrimSuffix(entry.Name(), extension)
+			table, ok := newTablebase(material, filepath.Join(directory, entry.Name()), extension == ".rtbz")
+			if !ok {
+				continue
+			}
+
+			tables := wdl
+			if table.dtz {
+				tables = dtz
+			}
+
+			if _, exists := tables[table.name]; exists {
+				continue
+			}
+
+			tables[table.name] = table
+			tables[table.swappedName()] = table
+			count++
+
+			if !table.dtz && table.pieceCount > largest {
+				largest = table.pieceCount
+			}
+		}
+	}
+
+	syzygyInUse.Store(&syzygyTables{wdl: wdl, dtz: dtz, largest: largest})
+
+	return count
+}
+
+// Can the position be found in the tables? Positions with castling rights
+// aren't stored.
+func canProbeSyzygy(position position) bool {
+	largest := currentSyzygyTables().largest
+	return largest > 0 && position.castling == 0 && countPieces(position) <= largest
+}
+
+/*
+Read a table's file, if it hasn't been read already, returning false if it
+can't be. The file is checked against the magic number of its type, and the
+data of each of its tables is located.
+
+The table is locked while it is read, since several searches may probe it at
+once.
+*/
+func (table *tablebase) load() bool {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+
+	if table.loaded || table.failed {
+		return table.loaded
+	}
+
+	table.failed = true
+
+	data, err := os.ReadFile(table.path)
+	if err != nil {
+		return false
+	}
+
+	magic := syzygyWDLMagic
+	if table.dtz {
+		magic = syzygyDTZMagic
+	}
+
+	if len(data) < len(magic) || string(data[:len(magic)]) != magic {
+		return false
+	}
+
+	if !table.parse(data) {
+		return false
+	}
+
+	table.loaded = true
+	table.failed = false
+
+	return true
+}
+
+// Find the data for a side to move and file of the leading pawn.
+func (table *tablebase) get(side int, file int) *pairsData {
+	if table.dtz {
+		side = 0
+	}
+
+	if !table.hasPawns {
+		file = 0
+	}
+
+	return &table.items[side][file]
+}
+
+/*
+Locate the data of each table in a file. The header gives the order of the
+pieces and groups for each table, and is followed by each table's sizes and
+Huffman code, the DTZ value maps, the sparse indices, the block lengths, and
+finally the blocks themselves. False is returned if the file doesn't match its
+name or is cut short.
+*/
+func (table *tablebase) parse(data []byte) (ok bool) {
+	defer func() {
+		if recover() != nil {
+			ok = false
+		}
+	}()
+
+	const hasPawns = 2
+
+	offset := len(syzygyWDLMagic)
+
+	if (data[offset]&hasPawns != 0) != table.hasPawns {
+		return false
+	}
+
+	offset++
+
+	sides := 2
+	if table.dtz || table.symmetric {
+		sides = 1
+	}
+
+	files := 1
+	if table.hasPawns {
+		files = 4
+	}
+
+	bothPawns := table.hasPawns && table.pawnCount[1] > 0
+
+	for file := 0; file < files; file++ {
+		order := [2][2]int{{int(data[offset] & 0xF), 0xF}, {int(data[offset] >> 4), 0xF}}
+
+		if bothPawns {
+			order[0][1] = int(data[offset+1] & 0xF)
+			order[1][1] = int(data[offset+1] >> 4)
+			offset++
+		}
+
+		offset++
+
+		for k := 0; k < table.pieceCount; k++ {
+			for side := 0; side < sides; side++ {
+				code := data[offset] & 0xF
+				if side == 1 {
+					code = data[offset] >> 4
+				}
+
+				table.get(side, file).pieces[k] = code
+			}
+
+			offset++
+		}
+
+		for side := 0; side < sides; side++ {
+			table.setGroups(table.get(side, file), order[side], file)
+		}
+	}
+
+	offset += offset & 1
+
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			offset = table.get(side, file).setSizes(data, offset)
+		}
+	}
+
+	if table.dtz {
+		offset = table.setDTZMap(data, offset, files)
+	}
+
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			d := table.get(side, file)
+			d.sparseIndex = offset
+			offset += d.sparseIndexSize * 6
+		}
+	}
+
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			d := table.get(side, file)
+			d.blockLength = offset
+			offset += d.blockLengthSize * 2
+		}
+	}
+
+	for file := 0; file < files; file++ {
+		for side := 0; side < sides; side++ {
+			d := table.get(side, file)
+			offset = (offset + 63) &^ 63
+			d.data = offset
+			offset += d.numBlocks * d.blockSize
+
+			if d.flags&tbFlagSingleValue == 0 && offset > len(data) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+/*
+Group the pieces of a table as they are indexed. Usually a group is the pieces
+of one type and colour, but the first holds the leading pawns or, without pawns,
+either the three unique pieces or the two kings.
+
+The order of the groups in the index is given by order: the first group is at
+order[0], the remaining pawns at order[1], and the other groups follow in the
+gaps. groupIndex holds the multiplier of each group, and finally the size of the
+table.
+*/
+func (table *tablebase) setGroups(d *pairsData, order [2]int, file int) {
+	n := 0
+	firstLength := 2
+	if table.hasPawns {
+		firstLength = 0
+	} else if table.hasUniquePieces {
+		firstLength = 3
+	}
+
+	d.groupLength[0] = 1
+
+	for i := 1; i < table.pieceCount; i++ {
+		firstLength--
+
+		if firstLength > 0 || d.pieces[i] == d.pieces[i-1] {
+			d.groupLength[n]++
+		} else {
+			n++
+			d.groupLength[n] = 1
+		}
+	}
+
+	n++
+	d.groupLength[n] = 0
+
+	bothPawns := table.hasPawns && table.pawnCount[1] > 0
+	next := 1
+	freeSquares := 64 - d.groupLength[0]
+
+	if bothPawns {
+		next = 2
+		freeSquares -= d.groupLength[1]
+	}
+
+	index := uint64(1)
+
+	for k := 0; next < n || k == order[0] || k == order[1]; k++ {
+		switch {
+		case k == order[0]:
+			d.groupIndex[0] = index
+
+			switch {
+			case table.hasPawns:
+				index *= syzygyIndices.leadPawnsSize[d.groupLength[0]][file]
+			case table.hasUniquePieces:
+				index *= 31332
+			default:
+				index *= 462
+			}
+		case k == order[1]:
+			d.groupIndex[1] = index
+			index *= syzygyIndices.binomial[d.groupLength[1]][48-d.groupLength[0]]
+		default:
+			d.groupIndex[next] = index
+			index *= syzygyIndices.binomial[d.groupLength[next]][freeSquares]
+			freeSquares -= d.groupLength[next]
+			next++
+		}
+	}
+
+	d.groupIndex[n] = index
+}
+
+/*
+Read the sizes and Huffman code of a table, starting at offset, and return the
+offset after them.
+
+The code is canonical, with longer codes having lower values. lowestSym holds
+the lowest symbol of each length, from which base64 is built so that a code of
+length l, padded to 64 bits, lies between base64[l-1] and base64[l].
+*/
+func (d *pairsData) setSizes(data []byte, offset int) int {
+	d.file = data
+	d.flags = data[offset]
+	offset++
+
+	if d.flags&tbFlagSingleValue != 0 {
+		d.minSymLen = int(data[offset])
+		return offset + 1
+	}
+
+	size := uint64(0)
+	for i, length := range d.groupLength {
+		if length == 0 {
+			size = d.groupIndex[i]
+			break
+		}
+	}
+
+	d.blockSize = 1 << data[offset]
+	d.span = 1 << data[offset+1]
+	d.sparseIndexSize = int((size + d.span - 1) / d.span)
+	padding := int(data[offset+2])
+	d.numBlocks = int(binary.LittleEndian.Uint32(data[offset+3:]))
+	d.blockLengthSize = d.numBlocks + padding
+	d.maxSymLen = int(data[offset+7])
+	d.minSymLen = int(data[offset+8])
+	d.lowestSym = offset + 9
+
+	d.base64 = make([]uint64, d.maxSymLen-d.minSymLen+1)
+
+	for i := len(d.base64) - 2; i >= 0; i-- {
+		d.base64[i] = (d.base64[i+1] + uint64(d.lowestSymbol(i)) - uint64(d.lowestSymbol(i+1))) / 2
+	}
+
+	for i := range d.base64 {
+		d.base64[i] <<= uint(64 - i - d.minSymLen)
+	}
+
+	offset = d.lowestSym + 2*len(d.base64)
+
+	d.symlen = make([]byte, binary.LittleEndian.Uint16(data[offset:]))
+	d.btree = offset + 2
+
+	visited := make([]bool, len(d.symlen))
+	for symbol := range d.symlen {
+		if !visited[symbol] {
+			d.symlen[symbol] = d.setSymlen(symbol, visited)
+		}
+	}
+
+	return d.btree + 3*len(d.symlen) + len(d.symlen)&1
+}
+
+// Find the number of results, minus one, that a symbol expands into.
+func (d *pairsData) setSymlen(symbol int, visited []bool) byte {
+	visited[symbol] = true
+
+	left, right := d.children(symbol)
+	if right == 0xFFF {
+		return 0
+	}
+
+	if !visited[left] {
+		d.symlen[left] = d.setSymlen(left, visited)
+	}
+
+	if !visited[right] {
+		d.symlen[right] = d.setSymlen(right, visited)
+	}
+
+	return d.symlen[left] + d.symlen[right] + 1
+}
+
+// Find the pair of symbols a symbol expands into. A symbol which doesn't expand
+// has a right symbol of 0xFFF, and its value as the left symbol.
+func (d *pairsData) children(symbol int) (int, int) {
+	entry := d.file[d.btree+3*symbol:]
+
+	left := int(entry[1]&0xF)<<8 | int(entry[0])
+	right := int(entry[2])<<4 | int(entry[1]>>4)
+
+	return left, right
+}
+
+// Find the lowest symbol of a code length, counted from the minimum length.
+func (d *pairsData) lowestSymbol(length int) int {
+	return int(binary.LittleEndian.Uint16(d.file[d.lowestSym+2*length:]))
+}
+
+// Find the length, minus one, of a block.
+func (d *pairsData) blockLengthOf(block int) int {
+	return int(binary.LittleEndian.Uint16(d.file[d.blockLength+2*block:]))
+}
+
+/*
+Find the result at an index of a table.
+
+The sparse index gives the block and offset of every span'th result, from which
+the block holding the index is found by walking the block lengths. The block's
+symbols are then decoded until the one covering the index, which is expanded
+through its pairs down to the result.
+*/
+func (d *pairsData) decompress(index uint64) int {
+	if d.flags&tbFlagSingleValue != 0 {
+		return d.minSymLen
+	}
+
+	sparse := d.file[d.sparseIndex+6*int(index/d.span):]
+	block := int(binary.LittleEndian.Uint32(sparse))
+	offset := int(binary.LittleEndian.Uint16(sparse[4:]))
+
+	offset += int(index%d.span) - int(d.span/2)
+
+	for offset < 0 {
+		block--
+		offset += d.blockLengthOf(block) + 1
+	}
+
+	for offset > d.blockLengthOf(block) {
+		offset -= d.blockLengthOf(block) + 1
+		block++
+	}
+
+	pointer := d.data + block*d.blockSize
+	buffer := binary.BigEndian.Uint64(d.file[pointer:])
+	bufferSize := 64
+	pointer += 8
+
+	var symbol int
+
+	for {
+		length := 0
+		for buffer < d.base64[length] {
+			length++
+		}
+
+		symbol = int((buffer-d.base64[length])>>uint(64-length-d.minSymLen)) + d.lowestSymbol(length)
+
+		if offset < int(d.symlen[symbol])+1 {
+			break
+		}
+
+		offset -= int(d.symlen[symbol]) + 1
+		length += d.minSymLen
+		buffer <<= uint(length)
+		bufferSize -= length
+
+		if bufferSize <= 32 {
+			bufferSize += 32
+			buffer |= uint64(binary.BigEndian.Uint32(d.file[pointer:])) << uint(64-bufferSize)
+			pointer += 4
+		}
+	}
+
+	for d.symlen[symbol] != 0 {
+		left, right := d.children(symbol)
+
+		if offset < int(d.symlen[left])+1 {
+			symbol = left
+		} else {
+			offset -= int(d.symlen[left]) + 1
+			symbol = right
+		}
+	}
+
+	value, _ := d.children(symbol)
+	return value
+}
+
+/*
+Read the maps of a DTZ file, which turn the stored values of each result back
+into distances, since values are stored in order of how often they occur. There
+is a map for wins, losses, cursed wins and blessed losses, in that order, each
+of bytes or, for wide tables, little endian uint16s.
+*/
+func (table *tablebase) setDTZMap(data []byte, offset int, files int) int {
+	table.mapOffset = offset
+
+	for file := 0; file < files; file++ {
+		d := table.get(0, file)
+
+		if d.flags&tbFlagMapped == 0 {
+			continue
+		}
+
+		if d.flags&tbFlagWide != 0 {
+			offset += offset & 1
+
+			for i := 0; i < 4; i++ {
+				d.mapIndex[i] = (offset-table.mapOffset)/2 + 1
+				offset += 2*int(binary.LittleEndian.Uint16(data[offset:])) + 2
+			}
+		} else {
+			for i := 0; i < 4; i++ {
+				d.mapIndex[i] = offset - table.mapOffset + 1
+				offset += int(data[offset]) + 1
+			}
+		}
+	}
+
+	return offset + offset&1
+}
+
+// Turn a value from a DTZ table into a distance in plies, given the result of
+// the position.
+func (table *tablebase) mapDTZ(file int, value int, wdl int) int {
+	wdlMaps := [5]int{1, 3, 0, 2, 0}
+
+	d := table.get(0, file)
+
+	if d.flags&tbFlagMapped != 0 {
+		index := d.mapIndex[wdlMaps[wdl+2]] + value
+
+		if d.flags&tbFlagWide != 0 {
+			value = int(binary.LittleEndian.Uint16(d.file[table.mapOffset+2*index:]))
+		} else {
+			value = int(d.file[table.mapOffset+index])
+		}
+	}
+
+	if (wdl == wdlWin && d.flags&tbFlagWinPlies == 0) || (wdl == wdlLoss && d.flags&tbFlagLossPlies == 0) ||
+		wdl == wdlCursedWin || wdl == wdlBlessedLoss {
+		value *= 2
+	}
+
+	return value + 1
+}
+
+/*
+Probe a table for a position, returning its value and the outcome of the probe.
+WDL tables give the result for the side to move, and DTZ tables the distance,
+given the result wdl.
+
+The tables are stored with the stronger side as white, and a table for the same
+pieces on both sides only with white to move, so the colours of the position
+are swapped, and the board mirrored vertically, when that isn't the case.
+*/
+func probeTable(position position, dtz bool, wdl int) (int, int) {
+	if countPieces(position) == 2 {
+		return wdlDraw, probeOK
+	}
+
+	found := currentSyzygyTables()
+
+	tables := found.wdl
+	if dtz {
+		tables = found.dtz
+	}
+
+	material := syzygyMaterialName(position)
+
+	table, ok := tables[material]
+	if !ok || !table.load() {
+		return 0, probeFail
+	}
+
+	blackToMove := position.toMove == Black
+	flip := (table.symmetric && blackToMove) || material != table.name
+
+	flipColor := byte(0)
+	flipSquares := 0
+	if flip {
+		flipColor = 8
+		flipSquares = 56
+	}
+
+	side := 0
+	if flip != blackToMove {
+		side = 1
+	}
+
+	var codes [64]byte
+	for square := 0; square < 64; square++ {
+		if p := position.board[standardTo0x88(square)]; p.exists() {
+			codes[square] = syzygyPieceCode(p)
+		}
+	}
+
+	var squares [syzygyMaxPieces]int
+	var pieces [syzygyMaxPieces]byte
+	var leadPawns uint64
+	size := 0
+	leadPawnCount := 0
+	file := 0
+
+	// With pawns, the tables are split by the file of the leading pawn, which
+	// is the leading side's pawn nearest the edge and then the second rank.
+	if table.hasPawns {
+		pawn := table.get(0, 0).pieces[0] ^ flipColor
+
+		for square := 0; square < 64; square++ {
+			if codes[square] == pawn {
+				leadPawns |= 1 << uint(square)
+				squares[size] = square ^ flipSquares
+				size++
+			}
+		}
+
+		leadPawnCount = size
+
+		leading := 0
+		for i := 1; i < leadPawnCount; i++ {
+			if syzygyIndices.mapPawns[squares[i]] > syzygyIndices.mapPawns[squares[leading]] {
+				leading = i
+			}
+		}
+
+		squares[0], squares[leading] = squares[leading], squares[0]
+
+		file = squares[0] % 8
+		if file > 3 {
+			file = (squares[0] ^ 7) % 8
+		}
+	}
+
+	if table.dtz && !table.storesSide(side, file) {
+		return 0, probeChangeSide
+	}
+
+	for square := 0; square < 64; square++ {
+		if codes[square] != 0 && leadPawns&(1<<uint(square)) == 0 {
+			squares[size] = square ^ flipSquares
+			pieces[size] = codes[square] ^ flipColor
+			size++
+		}
+	}
+
+	d := table.get(side, file)
+
+	// Put the pieces in the order the table was indexed in.
+	for i := leadPawnCount; i < size-1; i++ {
+		for j := i + 1; j < size; j++ {
+			if d.pieces[i] == pieces[j] {
+				pieces[i], pieces[j] = pieces[j], pieces[i]
+				squares[i], squares[j] = squares[j], squares[i]
+				break
+			}
+		}
+	}
+
+	// Mirror the board horizontally to bring the leading piece to files a-d.
+	if squares[0]%8 > 3 {
+		for i := 0; i < size; i++ {
+			squares[i] ^= 7
+		}
+	}
+
+	var index uint64
+
+	if table.hasPawns {
+		index = syzygyIndices.leadPawnIndex[leadPawnCount][squares[0]]
+
+		others := squares[1:leadPawnCount]
+		sort.SliceStable(others, func(i int, j int) bool {
+			return syzygyIndices.mapPawns[others[i]] < syzygyIndices.mapPawns[others[j]]
+		})
+
+		for i := 1; i < leadPawnCount; i++ {
+			index += syzygyIndices.binomial[i][syzygyIndices.mapPawns[squares[i]]]
+		}
+	} else {
+		index = pawnlessIndex(squares[:size], d.groupLength[0], table.hasUniquePieces)
+	}
+
+	index *= d.groupIndex[0]
+
+	// Index the remaining groups, skipping over the squares taken by earlier
+	// groups. The remaining pawns can't be on the first or last rank.
+	remainingPawns := table.hasPawns && table.pawnCount[1] > 0
+	start := d.groupLength[0]
+
+	for next := 1; d.groupLength[next] != 0; next++ {
+		group := squares[start : start+d.groupLength[next]]
+		sort.Ints(group)
+
+		n := uint64(0)
+		for i, square := range group {
+			adjust := 0
+			for _, earlier := range squares[:start] {
+				if square > earlier {
+					adjust++
+				}
+			}
+
+			square -= adjust
+			if remainingPawns {
+				square -= 8
+			}
+
+			n += syzygyIndices.binomial[i+1][square]
+		}
+
+		remainingPawns = false
+		index += n * d.groupIndex[next]
+		start += d.groupLength[next]
+	}
+
+	value := d.decompress(index)
+
+	if table.dtz {
+		return table.mapDTZ(file, value, wdl), probeOK
+	}
+
+	return value - 2, probeOK
+}
+
+/*
+Index the leading group of a table without pawns. The board is first mirrored
+so that the leading piece is in the a1-d1-d4 triangle, and the first piece of
+the group off the a1-h8 diagonal is below it. The group is either three unique
+pieces, indexed together, or the two kings.
+*/
+func pawnlessIndex(squares []int, leadingLength int, hasUniquePieces bool) uint64 {
+	if squares[0]/8 > 3 {
+		for i := range squares {
+			squares[i] ^= 56
+		}
+	}
+
+	for i := 0; i < leadingLength; i++ {
+		if offDiagonal(squares[i]) == 0 {
+			continue
+		}
+
+		if offDiagonal(squares[i]) > 0 {
+			for j := i; j < len(squares); j++ {
+				squares[j] = flipDiagonal(squares[j])
+			}
+		}
+
+		break
+	}
+
+	if !hasUniquePieces {
+		return uint64(syzygyIndices.mapKK[syzygyIndices.mapA1D1D4[squares[0]]][squares[1]])
+	}
+
+	adjust1 := 0
+	if squares[1] > squares[0] {
+		adjust1 = 1
+	}
+
+	adjust2 := 0
+	if squares[2] > squares[0] {
+		adjust2++
+	}
+
+	if squares[2] > squares[1] {
+		adjust2++
+	}
+
+	switch {
+	case offDiagonal(squares[0]) != 0:
+		return uint64((syzygyIndices.mapA1D1D4[squares[0]]*63+squares[1]-adjust1)*62 + squares[2] - adjust2)
+	case offDiagonal(squares[1]) != 0:
+		return uint64((6*63+squares[0]/8*28+syzygyIndices.mapB1H1H7[squares[1]])*62 + squares[2] - adjust2)
+	case offDiagonal(squares[2]) != 0:
+		return uint64(6*63*62 + 4*28*62 + squares[0]/8*7*28 + (squares[1]/8-adjust1)*28 + syzygyIndices.mapB1H1H7[squares[2]])
+	default:
+		return uint64(6*63*62 + 4*28*62 + 4*7*28 + squares[0]/8*7*6 + (squares[1]/8-adjust1)*6 + squares[2]/8 - adjust2)
+	}
+}
+
+// Does a DTZ table store positions with the given side to move? Tables with the
+// same pieces on both sides and no pawns can be probed for either.
+func (table *tablebase) storesSide(side int, file int) bool {
+	return int(table.get(side, file).flags&tbFlagSideToMove) == side || (table.symmetric && !table.hasPawns)
+}
+
+// Is a move a capture or pawn move, which resets the fifty-move count?
+func isZeroingMove(position position, move move) bool {
+	return move.isCapture() || position.board[move.From()].is(Pawn)
+}
+
+/*
+Find the result of a position by searching its captures, along with its pawn
+moves if zeroing is set, and probing the table for the rest.
+
+The tables don't need to store the correct result where a capture is best, so
+they hold whatever compresses best there, and the captures must be searched to
+find the real result. Pawn moves are searched for DTZ probes, since the DTZ
+tables don't store the distance where a capture or pawn move wins.
+*/
+func syzygySearch(position position, zeroing bool) (int, int) {
+	best := wdlLoss
+	moves := generateLegalMoves(position)
+	searched := 0
+
+	for _, move := range moves {
+		if !move.isCapture() && (!zeroing || !position.board[move.From()].is(Pawn)) {
+			continue
+		}
+
+		searched++
+
+		child := position
+		makeMove(&child, move)
+
+		value, outcome := syzygySearch(child, false)
+		if outcome == probeFail {
+			return wdlDraw, probeFail
+		}
+
+		value = -value
+
+		if value > best {
+			best = value
+
+			if value >= wdlWin {
+				return value, probeZeroingBestMove
+			}
+		}
+	}
+
+	// If every move has been searched, the table's value may be wrong, for
+	// example when it ignores an en passant capture.
+	allSearched := searched > 0 && searched == len(moves)
+
+	value := best
+	if !allSearched {
+		var outcome int
+		if value, outcome = probeTable(position, false, wdlDraw); outcome == probeFail {
+			return wdlDraw, probeFail
+		}
+	}
+
+	if best >= value {
+		if best > wdlDraw || allSearched {
+			return best, probeZeroingBestMove
+		}
+
+		return best, probeOK
+	}
+
+	return value, probeOK
+}
+
+// Probe the WDL tables for the result of a position for the side to move,
+// returning false if it can't be found.
+func probeWDL(position position) (int, bool) {
+	if !canProbeSyzygy(position) {
+		return wdlDraw, false
+	}
+
+	wdl, outcome := syzygySearch(position, false)
+
+	return wdl, outcome != probeFail
+}
+
+// The DTZ of the position before a winning or losing zeroing move.
+func dtzBeforeZeroing(wdl int) int {
+	switch wdl {
+	case wdlWin:
+		return 1
+	case wdlCursedWin:
+		return 101
+	case wdlBlessedLoss:
+		return -101
+	case wdlLoss:
+		return -1
+	}
+
+	return 0
+}
+
+// Find the sign of a number.
+func sign(value int) int {
+	switch {
+	case value > 0:
+		return 1
+	case value < 0:
+		return -1
+	}
+
+	return 0
+}
+
+/*
+Probe the DTZ tables for a position, returning the number of plies to the next
+capture or pawn move on the way to its result, positive if the side to move wins
+and negative if it loses, or 0 for a draw. Cursed wins and blessed losses are
+reported as beyond 100 plies.
+
+When the table only stores the other side to move, the distance is found by a
+search of one ply.
+*/
+func probeDTZ(position position) (int, bool) {
+	if !canProbeSyzygy(position) {
+		return 0, false
+	}
+
+	return syzygyDTZSearch(position)
+}
+
+// Probe the DTZ tables for a position known to be in them.
+func syzygyDTZSearch(position position) (int, bool) {
+	wdl, outcome := syzygySearch(position, true)
+
+	if outcome == probeFail {
+		return 0, false
+	}
+
+	if wdl == wdlDraw {
+		return 0, true
+	}
+
+	if outcome == probeZeroingBestMove {
+		return dtzBeforeZeroing(wdl), true
+	}
+
+	dtz, outcome := probeTable(position, true, wdl)
+
+	if outcome == probeFail {
+		return 0, false
+	}
+
+	if outcome != probeChangeSide {
+		if wdl == wdlBlessedLoss || wdl == wdlCursedWin {
+			dtz += 100
+		}
+
+		return dtz * sign(wdl), true
+	}
+
+	minimum := 0xFFFF
+
+	for _, move := range generateLegalMoves(position) {
+		zeroing := isZeroingMove(position, move)
+
+		child := position
+		makeMove(&child, move)
+
+		// For zeroing moves, the distance is that before the move, so only
+		// the result after it is needed.
+		var ok bool
+		if zeroing {
+			wdl, outcome := syzygySearch(child, false)
+			dtz, ok = -dtzBeforeZeroing(wdl), outcome != probeFail
+		} else {
+			dtz, ok = syzygyDTZSearch(child)
+			dtz = -dtz
+		}
+
+		if !ok {
+			return 0, false
+		}
+
+		if dtz == 1 && isCheckmate(child) {
+			minimum = 1
+		}
+
+		if !zeroing {
+			dtz += sign(dtz)
+		}
+
+		if dtz < minimum && sign(dtz) == sign(wdl) {
+			minimum = dtz
+		}
+	}
+
+	// Without a legal move, the position is checkmate.
+	if minimum == 0xFFFF {
+		return -1, true
+	}
+
+	return minimum, true
+}
+
+// Is the side to move checkmated?
+func isCheckmate(position position) bool {
+	return isKingInCheck(position, opposingColor(position.toMove)) && len(generateLegalMoves(position)) == 0
+}
+
+const syzygyMaxDTZ = 1 << 18
+
+/*
+Find the moves of a position in the tables which keep its best result, so that
+the search can choose between them. Wins within the fifty-move rule are ranked
+by how quickly they make progress, and losses by how long they hold out.
+False is returned if the position can't be probed.
+*/
+func syzygyRootMoves(position position) ([]move, bool) {
+	if !canProbeSyzygy(position) {
+		return nil, false
+	}
+
+	moves := generateLegalMoves(position)
+	ranks := make([]int, len(moves))
+	distances := make([]int, len(moves))
+	halfmove := int(position.halfmove)
+
+	for i, move := range moves {
+		child := position
+		makeMove(&child, move)
+
+		var dtz int
+		var ok bool
+
+		if child.halfmove == 0 {
+			var wdl int
+			wdl, ok = probeWDL(child)
+			dtz = dtzBeforeZeroing(-wdl)
+		} else {
+			dtz, ok = probeDTZ(child)
+			dtz = -dtz
+			dtz += sign(dtz)
+		}
+
+		if !ok {
+			return nil, false
+		}
+
+		if dtz == 2 && isCheckmate(child) {
+			dtz = 1
+		}
+
+		switch {
+		case dtz > 0 && dtz+halfmove <= 99:
+			ranks[i] = syzygyMaxDTZ
+		case dtz > 0:
+			ranks[i] = syzygyMaxDTZ - (dtz + halfmove)
+		case dtz < 0 && -dtz*2+halfmove < 100:
+			ranks[i] = -syzygyMaxDTZ
+		case dtz < 0:
+			ranks[i] = -syzygyMaxDTZ + (-dtz + halfmove)
+		}
+
+		distances[i] = dtz
+	}
+
+	best := 0
+	for i := range moves {
+		if ranks[i] > ranks[best] || (ranks[i] == ranks[best] && isBetterDTZ(distances[i], distances[best])) {
+			best = i
+		}
+	}
+
+	var bestMoves []move
+	for i, move := range moves {
+		if ranks[i] == ranks[best] && (distances[i] == distances[best] || distances[best] == 0) {
+			bestMoves = append(bestMoves, move)
+		}
+	}
+
+	return bestMoves, len(bestMoves) > 0
+}
+
+// Is a DTZ better than another of the same rank? Wins should be as quick as
+// possible and losses as slow as possible.
+func isBetterDTZ(dtz int, other int) bool {
+	if dtz > 0 {
+		return dtz < other
+	}
+
+	return dtz < 0 && dtz < other
+}
+
+// If the position can be found in the WDL tables, return its score for the side
+// to move. Only positions just after a capture or pawn move are probed, since
+// the tables assume that the fifty-move count has been reset.
+func probeSyzygyScore(position position) (int, bool) {
+	if position.halfmove != 0 || currentSyzygyTables().largest == 0 {
+		return 0, false
+	}
+
+	wdl, ok := probeWDL(position)
+	if !ok {
+		return 0, false
+	}
+
+	return tablebaseScores[wdl+2], true
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyzygyIndices(t *testing.T) {
+	var seen [462]bool
+	count := 0
+
+	for index := 0; index < 10; index++ {
+		for first := 0; first < 28; first++ {
+			if first%8 > 3 || syzygyIndices.mapA1D1D4[first] != index {
+				continue
+			}
+
+			for second := 0; second < 64; second++ {
+				legal := squareDistance(first, second) > 1 && (offDiagonal(first) != 0 || offDiagonal(second) <= 0)
+
+				if code := syzygyIndices.mapKK[index][second]; legal && !seen[code] {
+					seen[code] = true
+					count++
+				}
+			}
+		}
+	}
+
+	if count != 462 {
+		t.Errorf("Syzygy indices test failed!\nExpected 462 king placements, got %v\n", count)
+	}
+
+	var pawns [48]bool
+	for square := 8; square < 56; square++ {
+		pawns[syzygyIndices.mapPawns[square]] = true
+	}
+
+	for code, found := range pawns {
+		if !found {
+			t.Errorf("Syzygy indices test failed!\nNo pawn square has code %v\n", code)
+		}
+	}
+
+	if syzygyIndices.mapPawns[8] != 47 || syzygyIndices.mapPawns[15] != 46 || syzygyIndices.mapPawns[9] != 35 {
+		t.Errorf("Syzygy indices test failed!\nPawns nearest the edge should be highest\n")
+	}
+
+	for file := 0; file < 4; file++ {
+		if size := syzygyIndices.leadPawnsSize[1][file]; size != 6 {
+			t.Errorf("Syzygy indices test failed!\nExpected 6 single pawn squares on file %v, got %v\n", file, size)
+		}
+	}
+
+	if syzygyIndices.binomial[2][5] != 10 || syzygyIndices.binomial[5][62] != 6471002 {
+		t.Errorf("Syzygy indices test failed!\nBinomial coefficients are wrong\n")
+	}
+}
+
+func TestSyzygyMaterial(t *testing.T) {
+	var tests = []struct {
+		fen      string
+		material string
+	}{
+		{"8/8/8/4k3/8/8/8/4KQ2 w - - 0 1", "KQvK"},
+		{"8/8/8/4k3/8/2r5/3P4/4K3 b - - 0 1", "KPvKR"},
+		{"8/3n4/8/4k3/8/7P/B7/3RK3 w - - 0 1", "KRBPvKN"},
+	}
+
+	for _, test := range tests {
+		if material := syzygyMaterialName(mustFromFEN(test.fen)); material != test.material {
+			t.Errorf("Syzygy material test failed!\nFEN: %v\nExpected: %v\nGot: %v\n", test.fen, test.material, material)
+		}
+	}
+
+	table, ok := newTablebase("KPvKR", "", false)
+	if !ok || table.name != "KPvKR" || table.swappedName() != "KRvKP" || !table.hasPawns || table.pawnCount != [2]int{1, 0} {
+		t.Errorf("Syzygy material test failed!\nKPvKR table: %+v\n", table)
+	}
+
+	for _, name := range []string{"KQvKQK", "QvK", "KXvK", "KQRBNPvKQRBNP"} {
+		if _, ok := newTablebase(name, "", false); ok {
+			t.Errorf("Syzygy material test failed!\nAccepted table %v\n", name)
+		}
+	}
+}
+
+// Values encoded by hand, using a code of three bits for each symbol, must be
+// decompressed from any index.
+func TestSyzygyDecompress(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+
+	values := make([]int, 500)
+	for i := range values {
+		values[i] = random.Intn(5)
+
+		if random.Intn(3) == 0 {
+			values[i] = 2
+		}
+	}
+
+	d := encodeTestPairs(values, random)
+
+	for index, value := range values {
+		if decompressed := d.decompress(uint64(index)); decompressed != value {
+			t.Errorf("Syzygy decompression test failed!\nIndex: %v\nExpected: %v\nGot: %v\n", index, value, decompressed)
+		}
+	}
+}
+
+/*
+Encode values in the layout of a table, with symbols 0 to 4 standing for
+themselves and symbol 5 for a pair of 2s. The values are split into blocks of
+random lengths, and every symbol has a three bit code.
+*/
+func encodeTestPairs(values []int, random *rand.Rand) *pairsData {
+	const blockSize = 16
+	const span = 16
+
+	d := &pairsData{minSymLen: 3, maxSymLen: 3, blockSize: blockSize, span: span, base64: []uint64{0}}
+
+	var blocks [][]int
+	var blockStarts []int
+	for start := 0; start < len(values); {
+		end := start + 5 + random.Intn(16)
+		if end > len(values) {
+			end = len(values)
+		}
+
+		blockStarts = append(blockStarts, start)
+		blocks = append(blocks, values[start:end])
+		start = end
+	}
+
+	// The lowest symbol of the only code length, then the pairs of each symbol.
+	file := make([]byte, 2)
+
+	d.btree = len(file)
+	d.symlen = make([]byte, 6)
+	for symbol := 0; symbol < 6; symbol++ {
+		left, right := symbol, 0xFFF
+		if symbol == 5 {
+			left, right = 2, 2
+		}
+
+		file = append(file, byte(left), byte(left>>8)|byte(right<<4), byte(right>>4))
+	}
+
+	visited := make([]bool, 6)
+	d.file = file
+	for symbol := range d.symlen {
+		if !visited[symbol] {
+			d.symlen[symbol] = d.setSymlen(symbol, visited)
+		}
+	}
+
+	// Each entry of the sparse index points to the block holding the middle of
+	// its span.
+	d.sparseIndex = len(file)
+	for k := 0; k*span < len(values); k++ {
+		middle := k*span + span/2
+		block := 0
+		for block+1 < len(blocks) && blockStarts[block+1] <= middle {
+			block++
+		}
+
+		entry := make([]byte, 6)
+		binary.LittleEndian.PutUint32(entry, uint32(block))
+		binary.LittleEndian.PutUint16(entry[4:], uint16(middle-blockStarts[block]))
+		file = append(file, entry...)
+	}
+
+	d.blockLength = len(file)
+	for _, block := range blocks {
+		file = append(file, byte(len(block)-1), 0)
+	}
+
+	d.data = len(file)
+	for _, block := range blocks {
+		encoded := make([]byte, blockSize)
+		bit := 0
+
+		for i := 0; i < len(block); i++ {
+			symbol := block[i]
+			if block[i] == 2 && i+1 < len(block) && block[i+1] == 2 {
+				symbol = 5
+				i++
+			}
+
+			for b := 2; b >= 0; b-- {
+				if symbol&(1<<uint(b)) != 0 {
+					encoded[bit/8] |= 0x80 >> uint(bit%8)
+				}
+
+				bit++
+			}
+		}
+
+		file = append(file, encoded...)
+	}
+
+	d.file = append(file, make([]byte, 8)...)
+
+	return d
+}
+
+// A table holding a single value needs no blocks, which makes it simple enough
+// to write by hand, to test reading and probing a file.
+func TestSyzygySingleValueTable(t *testing.T) {
+	directory := t.TempDir()
+
+	file := []byte(syzygyWDLMagic)
+	file = append(file, 0x01, 0x00, 0x66, 0x22, 0xEE, 0x00)
+	file = append(file, tbFlagSingleValue, wdlDraw+2, tbFlagSingleValue, wdlDraw+2)
+	file = append(file, make([]byte, 64-len(file))...)
+
+	if err := os.WriteFile(filepath.Join(directory, "KNvK.rtbw"), file, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer setSyzygyPath("")
+
+	if count := setSyzygyPath(directory); count != 1 {
+		t.Fatalf("Syzygy single value table test failed!\nExpected 1 table, found %v\n", count)
+	}
+
+	var tests = []struct {
+		fen string
+		ok  bool
+	}{
+		{"8/8/8/4k3/8/8/8/1N2K3 w - - 0 1", true},
+		{"8/8/8/4k3/8/8/8/1N2K3 b - - 0 1", true},
+		{"1n2k3/8/8/8/4K3/8/8/8 w - - 0 1", true},
+		{"7k/8/8/8/8/8/8/N6K b - - 0 1", true},
+		{"8/8/8/4k3/8/8/8/RN2K3 w - - 0 1", false},
+		{"8/8/8/4k3/8/8/8/1B2K3 w - - 0 1", false},
+	}
+
+	for _, test := range tests {
+		wdl, ok := probeWDL(mustFromFEN(test.fen))
+
+		if ok != test.ok || wdl != wdlDraw {
+			t.Errorf("Syzygy single value table test failed!\nFEN: %v\nExpected found: %v\nGot: %v, %v\n", test.fen, test.ok, wdl, ok)
+		}
+	}
+}
+
+/*
+Probe the real tables in testdata/syzygy, or the directories in SYZYGY_PATH if
+it's set. These are files made by the Syzygy generator, rather than by the test
+encoder, so they check the decoder against the real format. The KPvK, KRvK,
+KQvK and KQvKR tables are needed, and the test is skipped without them.
+*/
+func TestSyzygyTables(t *testing.T) {
+	path := os.Getenv("SYZYGY_PATH")
+	if path == "" {
+		path = filepath.Join("testdata", "syzygy")
+	}
+
+	defer setSyzygyPath("")
+	setSyzygyPath(path)
+
+	for _, material := range []string{"KPvK", "KRvK", "KQvK", "KQvKR"} {
+		tables := currentSyzygyTables()
+
+		if tables.wdl[material] == nil || tables.dtz[material] == nil {
+			t.Skipf("The %v tables are missing from %v", material, path)
+		}
+	}
+
+	var tests = []struct {
+		fen string
+		wdl int
+	}{
+		{"4k3/8/8/8/8/8/8/4K2Q w - - 0 1", wdlWin},
+		{"4k3/8/8/8/8/8/8/4K2Q b - - 0 1", wdlLoss},
+		{"8/8/8/4k3/8/8/8/R3K3 b - - 0 1", wdlLoss},
+		{"8/8/8/8/8/8/8/k1K4q w - - 0 1", wdlLoss},
+		{"k7/8/K7/P7/8/8/8/8 w - - 0 1", wdlDraw},
+		{"8/8/8/8/8/8/k3P3/4K3 w - - 0 1", wdlWin},
+		{"7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", wdlDraw},
+		{"r3k3/8/8/8/8/8/8/4K2Q w - - 0 1", wdlWin},
+		{"4k3/8/8/8/8/8/r7/4K2Q b - - 0 1", wdlWin},
+	}
+
+	for _, test := range tests {
+		if wdl, ok := probeWDL(mustFromFEN(test.fen)); !ok || wdl != test.wdl {
+			t.Errorf("Syzygy table test failed!\nFEN: %v\nExpected: %v\nGot: %v, %v\n", test.fen, test.wdl, wdl, ok)
+		}
+	}
+
+	// A mate or pawn move which keeps the win is one ply from zeroing, and
+	// the side about to be mated two.
+	var dtzTests = []struct {
+		fen string
+		dtz int
+	}{
+		{"k7/8/1K6/8/8/8/8/7R w - - 0 1", 1},
+		{"k7/8/1K6/8/8/8/8/7R b - - 0 1", -2},
+		{"8/8/8/8/8/8/k3P3/4K3 w - - 0 1", 1},
+		{"k7/8/K7/P7/8/8/8/8 w - - 0 1", 0},
+		{"r3k3/8/8/8/8/8/8/4K2Q w - - 0 1", 1},
+	}
+
+	for _, test := range dtzTests {
+		if dtz, ok := probeDTZ(mustFromFEN(test.fen)); !ok || dtz != test.dtz {
+			t.Errorf("Syzygy DTZ test failed!\nFEN: %v\nExpected: %v\nGot: %v, %v\n", test.fen, test.dtz, dtz, ok)
+		}
+	}
+
+	// Every KPK result must match the bitbase.
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		kpk, ok := kpkPosition(random.Intn(kpkSize))
+		if !ok {
+			continue
+		}
+
+		wdl, ok := probeWDL(kpk)
+		won := (kpk.toMove == White && wdl == wdlWin) || (kpk.toMove == Black && wdl == wdlLoss)
+
+		if !ok || won != probeKPK(White, kingSquare(bitboardOf(kpk, King|White)), kingSquare(bitboardOf(kpk, Pawn)), kingSquare(bitboardOf(kpk, King|Black)), kpk.toMove) {
+			t.Errorf("Syzygy table test failed!\nFEN: %v\nTables and bitbase disagree, WDL %v\n", toFEN(kpk), wdl)
+		}
+	}
+
+	// Following the tablebase moves must mate within the DTZ.
+	for _, fen := range []string{"8/8/8/4k3/8/8/8/4K2Q w - - 0 1", "8/8/8/3k4/8/8/8/R3K3 w - - 0 1"} {
+		position := mustFromFEN(fen)
+
+		dtz, ok := probeDTZ(position)
+		if !ok || dtz <= 0 {
+			t.Errorf("Syzygy table test failed!\nFEN: %v\nExpected a winning DTZ, got %v, %v\n", fen, dtz, ok)
+			continue
+		}
+
+		for ply := 0; ply < dtz && !isCheckmate(position); ply++ {
+			moves, ok := syzygyRootMoves(position)
+			if !ok {
+				t.Fatalf("Syzygy table test failed!\nFEN: %v\nCould not probe root moves\n", toFEN(position))
+			}
+
+			makeMove(&position, moves[0])
+		}
+
+		if !isCheckmate(position) {
+			t.Errorf("Syzygy table test failed!\nFEN: %v\nNot mated after %v plies: %v\n", fen, dtz, toFEN(position))
+		}
+	}
+}
+
+// Find the bitboard of the squares holding a piece.
+func bitboardOf(position position, p piece) uint64 {
+	var board uint64
+
+	for square := 0; square < 64; square++ {
+		if position.board[standardTo0x88(square)] == p {
+			board |= 1 << uint(square)
+		}
+	}
+
+	return board
+}
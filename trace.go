@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+/*
+An evaluation trace can be displayed as a table, for reading at the console, or
+as JSON, for use by other tools. Both list each term for each side, with its
+middlegame and endgame values, followed by the totals, the game phase, any
+endgame scaling or specialised evaluator, and the final score.
+*/
+
+// Format the trace as a table.
+func (trace evalTrace) table() string {
+	var lines []string
+
+	divider := "-------------+---------------+---------------+---------------"
+
+	lines = append(lines, fmt.Sprintf("%-12s | %13s | %13s | %13s", "Term", "White", "Black", "Total"))
+	lines = append(lines, fmt.Sprintf("%-12s | %6s %6s | %6s %6s | %6s %6s", "", "MG", "EG", "MG", "EG", "MG", "EG"))
+	lines = append(lines, divider)
+
+	for term, scores := range trace.terms {
+		white := scores[0]
+		black := scores[1]
+
+		lines = append(lines, fmt.Sprintf("%-12s | %6d %6d | %6d %6d | %6d %6d", termNames[term], white.mg, white.eg, black.mg, black.eg, white.mg-black.mg, white.eg-black.eg))
+	}
+
+	lines = append(lines, divider)
+	lines = append(lines, fmt.Sprintf("%-12s | %13s | %13s | %6d %6d", "Total", "", "", trace.mg, trace.eg))
+	lines = append(lines, "")
+	lines = append(lines, fmt.Sprintf("Phase: %v/%v", trace.phase, totalPhase))
+	lines = append(lines, fmt.Sprintf("Endgame scale: %v/%v", trace.scale, scaleNormal))
+
+	if trace.endgame != "" {
+		lines = append(lines, fmt.Sprintf("Endgame: %v", trace.endgame))
+	}
+
+	lines = append(lines, fmt.Sprintf("Evaluation (white): %v", trace.white))
+	lines = append(lines, fmt.Sprintf("Evaluation (side to move): %v", trace.final))
+
+	return strings.Join(lines, "\n")
+}
+
+// The structure of the JSON form of a trace.
+type jsonScore struct {
+	Mg int `json:"mg"`
+	Eg int `json:"eg"`
+}
+
+type jsonTerm struct {
+	Name  string    `json:"name"`
+	White jsonScore `json:"white"`
+	Black jsonScore `json:"black"`
+}
+
+type jsonTrace struct {
+	Terms   []jsonTerm `json:"terms"`
+	Mg      int        `json:"mg"`
+	Eg      int        `json:"eg"`
+	Phase   int        `json:"phase"`
+	Scale   int        `json:"scale"`
+	Endgame string     `json:"endgame,omitempty"`
+	White   int        `json:"white"`
+	Final   int        `json:"final"`
+}
+
+// Format the trace as JSON.
+func (trace evalTrace) toJSON() ([]byte, error) {
+	output := jsonTrace{Mg: trace.mg, Eg: trace.eg, Phase: trace.phase, Scale: trace.scale, Endgame: trace.endgame, White: trace.white, Final: trace.final}
+
+	for term, scores := range trace.terms {
+		output.Terms = append(output.Terms, jsonTerm{
+			Name:  termNames[term],
+			White: jsonScore{scores[0].mg, scores[0].eg},
+			Black: jsonScore{scores[1].mg, scores[1].eg},
+		})
+	}
+
+	return json.Marshal(output)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestEvaluationTrace(t *testing.T) {
+	cases := []string{
+		"rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+		"r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R b KQkq - 0 1",
+		"8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+		"6k1/5ppp/8/8/8/5nq1/5PPP/3r2K1 w - - 0 1",
+		"8/5n2/r2r4/8/8/6B1/3B4/8 b - - 0 1",
+		"8/8/4k3/8/8/8/3BN3/4K3 b - - 0 1",
+		"8/2b2k2/8/4p3/4P3/4B3/4K3/8 w - - 0 1",
+	}
+
+	for _, fen := range cases {
+		position := mustParseFEN(fen)
+		trace := traceEvaluation(position)
+
+		// The terms must add up to the totals, and the totals to the score
+		// returned by evaluate.
+		var mg int
+		var eg int
+		for _, term := range trace.terms {
+			mg += term[0].mg - term[1].mg
+			eg += term[0].eg - term[1].eg
+		}
+
+		if mg != trace.mg || eg != trace.eg {
+			t.Errorf("Trace test failed!\nFEN: %v\nTotals: %v %v\nSum of terms: %v %v\n", fen, trace.mg, trace.eg, mg, eg)
+		}
+
+		// A specialised endgame evaluator replaces the totals.
+		white := (mg*trace.phase + eg*trace.scale/scaleNormal*(totalPhase-trace.phase)) / totalPhase
+		if trace.endgame != "" {
+			white = trace.white
+		}
+
+		if position.toMove == Black {
+			white = -white
+		}
+
+		if trace.final != evaluate(position) || white != trace.final {
+			t.Errorf("Trace test failed!\nFEN: %v\nTrace: %v\nRecalculated: %v\nEvaluate: %v\n", fen, trace.final, white, evaluate(position))
+		}
+
+		// The JSON form must contain the same information.
+		output, err := trace.toJSON()
+		if err != nil {
+			t.Fatalf("Trace JSON failed: %v", err)
+		}
+
+		var parsed jsonTrace
+		if err := json.Unmarshal(output, &parsed); err != nil {
+			t.Fatalf("Trace JSON could not be parsed: %v", err)
+		}
+
+		if len(parsed.Terms) != termCount || parsed.Final != trace.final || parsed.Phase != trace.phase || parsed.Endgame != trace.endgame {
+			t.Errorf("Trace JSON test failed!\nFEN: %v\nJSON: %s\n", fen, output)
+		}
+
+		table := trace.table()
+		for _, name := range termNames {
+			if !strings.Contains(table, name) {
+				t.Errorf("Trace table test failed!\nFEN: %v\nMissing term: %v\nTable:\n%v\n", fen, name, table)
+			}
+		}
+	}
+}
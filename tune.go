@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+/*
+The tune command fits the evaluation parameters to a set of quiet positions
+labelled with the results of the games they came from, using Texel's tuning
+method (https://chessprogramming.wikispaces.com/Texel%27s+Tuning+Method).
+
+The score of each position is converted to an expected result between 0 and 1
+with a sigmoid function, scaled by the constant K. The error of a set of
+parameters is the mean squared difference between the expected and actual
+results, and the parameters are adjusted by local search to minimise it.
+
+Each line of the data file holds a position and the result of its game, in any
+of these forms:
+
+	<fen> [1.0]
+	<fen> 1/2-1/2
+	<epd> c9 "0-1";
+	<fen> | <score> | <result>
+
+Results are from white's perspective: 1 for a win, 0.5 for a draw and 0 for a
+loss. Blank lines and lines starting with # are ignored. The binary output of
+the datagen command can also be read.
+*/
+type labelledPosition struct {
+	position position
+	result   float64
+}
+
+// Run the tune command, given its command line arguments.
+func runTune(args []string) {
+	flags := flag.NewFlagSet("tune", flag.ExitOnError)
+	dataPath := flags.String("data", "", "File of positions labelled with game results")
+	outputPath := flags.String("output", "tuned.json", "Location to write the tuned evaluation parameters")
+	k := flags.Float64("k", 0, "Sigmoid scaling constant, or 0 to fit it to the data")
+	iterations := flags.Int("iterations", 100, "Maximum number of passes over the parameters")
+	flags.Parse(args)
+
+	if *dataPath == "" {
+		log.Fatal("No data file given")
+	}
+
+	data, err := loadLabelledPositions(*dataPath)
+	if err != nil {
+		log.Fatal("Could not load data: ", err)
+	}
+
+	log.Printf("Loaded %v positions", len(data))
+
+	// The quiescence search is run once, with the starting parameters, and
+	// the quiet positions it finds are evaluated from then on.
+	data = resolveQuietPositions(data)
+
+	if *k == 0 {
+		*k = fitK(data)
+	}
+
+	log.Printf("K = %.4f, error = %.6f", *k, meanSquaredError(data, *k))
+
+	params := evalParams
+	tuneParameters(data, &params, *k, *iterations, func(iteration int, err float64) {
+		log.Printf("Iteration %v, error = %.6f", iteration, err)
+
+		if saveErr := saveEvalParameters(*outputPath, params); saveErr != nil {
+			log.Fatal("Could not save parameters: ", saveErr)
+		}
+	})
+
+	if err := saveEvalParameters(*outputPath, params); err != nil {
+		log.Fatal("Could not save parameters: ", err)
+	}
+}
+
+// Read every labelled position in a data file. Files with the .bin extension
+// are read in the binary format written by the datagen command.
+func loadLabelledPositions(path string) ([]labelledPosition, error) {
+	if filepath.Ext(path) == ".bin" {
+		positions, err := loadPackedPositions(path)
+		if err != nil {
+			return nil, err
+		}
+
+		data := make([]labelledPosition, len(positions))
+		for i, trainingPosition := range positions {
+			data[i] = labelledPosition{trainingPosition.position, trainingPosition.result}
+		}
+
+		return data, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var data []labelledPosition
+
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		labelled, err := parseLabelledPosition(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %v: %v", lineNumber, err)
+		}
+
+		data = append(data, labelled)
+	}
+
+	return data, scanner.Err()
+}
+
+// Parse a single line of a data file.
+func parseLabelledPosition(line string) (labelledPosition, error) {
+	var fen string
+	var result float64
+	var ok bool
+
+	if strings.Contains(line, "|") {
+		fields := strings.Split(line, "|")
+
+		fen = strings.TrimSpace(fields[0])
+		result, ok = parseResult(strings.TrimSpace(fields[len(fields)-1]))
+	} else {
+		tokens := strings.Fields(line)
+
+		// An EPD result is quoted in a c9 operation, which may have been
+		// split from its closing semicolon.
+		last := len(tokens) - 1
+		if tokens[last] == ";" {
+			last--
+		}
+
+		if last < 1 {
+			return labelledPosition{}, errors.New("no result found")
+		}
+
+		result, ok = parseResult(tokens[last])
+
+		fenTokens := tokens[:last]
+		if len(fenTokens) > 0 && fenTokens[len(fenTokens)-1] == "c9" {
+			fenTokens = fenTokens[:len(fenTokens)-1]
+		}
+
+		fen = strings.Join(fenTokens, " ")
+	}
+
+	if !ok {
+		return labelledPosition{}, errors.New("could not read result")
+	}
+
+	// EPD positions don't have move counters, which fromFEN accepts. A FEN with
+	// only one of them is more likely to have lost its result.
+	if fields := len(strings.Fields(fen)); fields != 4 && fields != 6 {
+		return labelledPosition{}, fmt.Errorf("invalid position %q", fen)
+	}
+
+	position, err := fromFEN(fen)
+	if err != nil {
+		return labelledPosition{}, fmt.Errorf("invalid position %q: %v", fen, err)
+	}
+
+	return labelledPosition{position, result}, nil
+}
+
+// Convert a game result to a score from white's perspective, returning false
+// if it isn't a valid result.
+func parseResult(token string) (float64, bool) {
+	switch strings.Trim(token, "[]\";") {
+	case "1-0", "1.0", "1":
+		return 1, true
+	case "1/2-1/2", "0.5":
+		return 0.5, true
+	case "0-1", "0.0", "0":
+		return 0, true
+	}
+
+	return 0, false
+}
+
+// Replace each position with the quiet position at the end of the principal
+// variation of its quiescence search.
+func resolveQuietPositions(data []labelledPosition) []labelledPosition {
+	resolved := make([]labelledPosition, len(data))
+
+	for i, labelled := range data {
+		leaf := labelled.position
+		quiescence(&labelled.position, -100000, 100000, 0, false, &leaf)
+
+		resolved[i] = labelledPosition{leaf, labelled.result}
+	}
+
+	return resolved
+}
+
+// Convert a score in centipawns from white's perspective to an expected result.
+func sigmoid(score float64, k float64) float64 {
+	return 1 / (1 + math.Pow(10, -k*score/400))
+}
+
+// Find the mean squared error of the evaluation over the data, with the
+// evaluation parameters currently in use.
+func meanSquaredError(data []labelledPosition, k float64) float64 {
+	var total float64
+
+	for _, labelled := range data {
+		// The piece scores stored in the position were calculated with the
+		// parameters in use when it was loaded.
+		position := labelled.position
+		initialisePieceScores(&position)
+
+		score := evaluate(position)
+		if position.toMove == Black {
+			score = -score
+		}
+
+		difference := labelled.result - sigmoid(float64(score), k)
+		total += difference * difference
+	}
+
+	return total / float64(len(data))
+}
+
+// Find the value of K which minimises the error with the current parameters, by
+// moving it in steps for as long as the error falls, then with smaller steps.
+func fitK(data []labelledPosition) float64 {
+	k := 1.0
+	best := meanSquaredError(data, k)
+
+	for step := 0.5; step > 0.0001; step /= 2 {
+		for improved := true; improved; {
+			improved = false
+
+			for _, candidate := range []float64{k - step, k + step} {
+				if candidate <= 0 {
+					continue
+				}
+
+				if err := meanSquaredError(data, candidate); err < best {
+					k = candidate
+					best = err
+					improved = true
+				}
+			}
+		}
+	}
+
+	return k
+}
+
+/*
+Tune the parameters by local search. Each parameter in turn is increased by 1,
+and if that doesn't reduce the error, decreased by 1; the change is kept if the
+error goes down. This repeats until a full pass makes no improvement, or the
+maximum number of passes is reached. progress is called after every pass.
+
+The tuned parameters are left in both params and evalParams.
+*/
+func tuneParameters(data []labelledPosition, params *evalParameters, k float64, iterations int, progress func(int, float64)) {
+	setEvalParameters(*params)
+	best := meanSquaredError(data, k)
+
+	values := tunableParameters(params)
+
+	for iteration := 1; iteration <= iterations; iteration++ {
+		improved := false
+
+		for _, value := range values {
+			for _, step := range []int{1, -2} {
+				*value += step
+				setEvalParameters(*params)
+
+				if err := meanSquaredError(data, k); err < best {
+					best = err
+					improved = true
+					break
+				}
+
+				// Undo the step, leaving the original value if both
+				// directions failed.
+				if step == -2 {
+					*value++
+					setEvalParameters(*params)
+				}
+			}
+		}
+
+		progress(iteration, best)
+
+		if !improved {
+			break
+		}
+	}
+}
+
+// Collect pointers to every tunable value in the parameters, including each
+// element of the tables.
+func tunableParameters(params *evalParameters) []*int {
+	var values []*int
+
+	fields := reflect.ValueOf(params).Elem()
+
+	for i := 0; i < fields.NumField(); i++ {
+		if fields.Type().Field(i).Tag.Get("tune") == "-" {
+			continue
+		}
+
+		field := fields.Field(i)
+
+		switch field.Kind() {
+		case reflect.Int:
+			values = append(values, field.Addr().Interface().(*int))
+		case reflect.Array:
+			for j := 0; j < field.Len(); j++ {
+				values = append(values, field.Index(j).Addr().Interface().(*int))
+			}
+		}
+	}
+
+	return values
+}
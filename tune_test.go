@@ -0,0 +1,83 @@
+package main
+
+import "testing"
+
+func TestParseLabelledPosition(t *testing.T) {
+	var tests = []struct {
+		line   string
+		fen    string
+		result float64
+	}{
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1 [1.0]", "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1", 1},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1 1/2-1/2", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", 0.5},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - c9 \"0-1\";", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", 0},
+		{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1 | 57 | 1.0", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", 1},
+	}
+
+	for _, test := range tests {
+		labelled, err := parseLabelledPosition(test.line)
+
+		if err != nil {
+			t.Errorf("Parsing labelled position failed!\nLine: %v\nError: %v\n", test.line, err)
+			continue
+		}
+
+		if labelled.position != mustFromFEN(test.fen) || labelled.result != test.result {
+			t.Errorf("Parsing labelled position failed!\nLine: %v\nExpected: %v %v\nGot: %v %v\n", test.line, test.fen, test.result, toFEN(labelled.position), labelled.result)
+		}
+	}
+
+	for _, line := range []string{"4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1 2-0", "1-0"} {
+		if _, err := parseLabelledPosition(line); err == nil {
+			t.Errorf("Parsing invalid labelled position failed!\nLine: %v\nExpected an error\n", line)
+		}
+	}
+}
+
+func TestTuneParameters(t *testing.T) {
+	defer setEvalParameters(defaultEvalParameters())
+
+	var data []labelledPosition
+	for _, line := range []string{
+		"4k3/8/8/8/8/8/PPP5/4K3 w - - 0 1 [1.0]",
+		"4k3/ppp5/8/8/8/8/8/4K3 w - - 0 1 [0.0]",
+		"4k3/pp6/8/8/8/8/PP6/4K3 b - - 0 1 [0.5]",
+		"r3k3/8/8/8/8/8/8/4K2R w - - 0 1 [0.5]",
+	} {
+		labelled, err := parseLabelledPosition(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data = append(data, labelled)
+	}
+
+	data = resolveQuietPositions(data)
+
+	k := fitK(data)
+	if k <= 0 {
+		t.Fatalf("Fitting K failed!\nGot: %v\n", k)
+	}
+
+	for _, other := range []float64{k / 2, k * 2} {
+		if meanSquaredError(data, other) < meanSquaredError(data, k) {
+			t.Errorf("Fitting K failed!\nK = %v has a lower error than the fitted K = %v\n", other, k)
+		}
+	}
+
+	before := meanSquaredError(data, k)
+
+	params := defaultEvalParameters()
+	var after float64
+	tuneParameters(data, &params, k, 1, func(iteration int, err float64) {
+		after = err
+	})
+
+	if after > before || meanSquaredError(data, k) != after {
+		t.Errorf("Tuning failed!\nError before: %v\nError after: %v\n", before, after)
+	}
+
+	if evalParams != params {
+		t.Errorf("Tuning failed!\nTuned parameters are not in use\n")
+	}
+}
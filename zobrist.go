@@ -0,0 +1,57 @@
+package main
+
+/*
+Zobrist hashing assigns a random 64-bit key to each piece on each square. The
+hash of a position is the XOR of the keys of everything present, which means it
+can be updated cheaply as pieces move: XOR the key out of the old square, and
+into the new one.
+
+The keys are generated from a fixed seed, so hashes are the same every time the
+engine runs.
+*/
+
+// pawnZobrist holds a key for a pawn of each colour on each square, in standard
+// 8x8 form. It is used to build the pawn-only hash stored in position.pawnKey.
+var pawnZobrist = generateZobristKeys()
+
+// Generate the table of pawn keys using a xorshift pseudo-random generator.
+func generateZobristKeys() [2][64]uint64 {
+	var keys [2][64]uint64
+
+	state := uint64(0x9E3779B97F4A7C15)
+
+	for side := 0; side < 2; side++ {
+		for square := 0; square < 64; square++ {
+			state ^= state << 13
+			state ^= state >> 7
+			state ^= state << 17
+
+			keys[side][square] = state
+		}
+	}
+
+	return keys
+}
+
+// Find the key contributed to the pawn hash by a piece on the given 0x88 index.
+// Pieces other than pawns don't contribute, so their key is 0.
+func pawnHashKey(p piece, index int) uint64 {
+	if !p.is(Pawn) {
+		return 0
+	}
+
+	return pawnZobrist[sideIndex(p.color())][map0x88ToStandard(index)]
+}
+
+// Calculate the pawn hash of a position from scratch.
+func generatePawnKey(position position) uint64 {
+	var key uint64
+
+	for i := 0; i < BoardSize; i++ {
+		if isOnBoard(i) {
+			key ^= pawnHashKey(position.board[i], i)
+		}
+	}
+
+	return key
+}